@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurpd"
+)
+
+// client talks to the slurpd HTTP API.
+type client struct {
+	addr string
+	http *http.Client
+
+	// token is sent as a bearer token when set. Otherwise requests are
+	// signed when hmacKey is set.
+	token      string
+	hmacKey    string
+	hmacSecret []byte
+}
+
+func newClient(addr string) *client {
+	return &client{
+		addr: strings.TrimRight(addr, "/"),
+		http: http.DefaultClient,
+	}
+}
+
+// request sends a request to the API. A JSON body is sent when body is not
+// nil. Error responses are returned as an *slurpd.APIError.
+func (c *client) request(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.hmacKey != "":
+		if err := slurpd.SignRequest(req, c.hmacKey, c.hmacSecret, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		var e slurpd.ErrorDTO
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Error == nil {
+			return nil, fmt.Errorf("%s %s: %s", method, u, res.Status)
+		}
+		e.Error.Status = res.StatusCode
+		return nil, e.Error
+	}
+	return res, nil
+}
+
+// do sends a request to the API and decodes the JSON response in to v.
+func (c *client) do(method string, path string, query url.Values, body interface{}, v interface{}) error {
+	res, err := c.request(context.Background(), method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// sseEvent is an event read from a server-sent event stream.
+type sseEvent struct {
+	Type string          `json:"event"`
+	Data json.RawMessage `json:"data"`
+}
+
+// events calls f for each event sent by the stream at path until the
+// stream ends or f returns an error.
+func (c *client) events(path string, query url.Values, f func(e sseEvent) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, err := c.request(ctx, "GET", path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var e sseEvent
+	sc := bufio.NewScanner(res.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			e.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.Data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+		case line == "":
+			if e.Type != "" {
+				if err := f(e); err != nil {
+					return err
+				}
+			}
+			e = sseEvent{}
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+	"github.com/williambailey/go-slurp/slurpd"
+)
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeTable writes rows lined up in columns under a header.
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printError writes err to stderr along with every problem listed in an
+// API error.
+func printError(err error) {
+	if e, ok := err.(*slurpd.APIError); ok {
+		fmt.Fprintf(os.Stderr, "slurpctl: %s (%s)\n", e.Message, e.Code)
+		for _, d := range e.Details {
+			fmt.Fprintf(os.Stderr, "  %s\n", d)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "slurpctl: %s\n", err)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return formatTime(*t)
+}
+
+// formatDuration rounds d so that it is easy to read.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(100 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
+
+// formatParams describes the parameters taken by an analyst.
+func formatParams(schema slurp.ParamSchema) string {
+	if len(schema) == 0 {
+		return "-"
+	}
+	s := make([]string, len(schema))
+	for i, p := range schema {
+		s[i] = p.Name + " (" + p.Type
+		if p.Required {
+			s[i] += ", required"
+		}
+		s[i] += ")"
+	}
+	return strings.Join(s, ", ")
+}
+
+// formatData writes result data as compact JSON.
+func formatData(data map[string]interface{}) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// formatProgress describes how far a running job has got.
+func formatProgress(p *slurpd.JobProgressDTO) string {
+	s := fmt.Sprintf("%5.1f%%  %d items  %.1f items/s", p.Progress.Percent, p.Stat.Count, p.Stat.Rate)
+	if p.Progress.ETA != nil {
+		s += "  eta " + formatTime(*p.Progress.ETA)
+	}
+	if p.Bottleneck != "" {
+		s += "  bottleneck " + p.Bottleneck
+	}
+	return s
+}
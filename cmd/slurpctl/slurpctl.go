@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurpd"
+)
+
+var (
+	flagAddr       string
+	flagJSON       bool
+	flagToken      string
+	flagHMACKey    string
+	flagHMACSecret string
+	flagCert       string
+	flagKey        string
+	flagCA         string
+)
+
+func init() {
+	flag.StringVar(&flagAddr, "addr", "http://127.0.0.1:9000/api", "address of the slurpd HTTP API")
+	flag.BoolVar(&flagJSON, "json", false, "write JSON instead of tables")
+	flag.StringVar(&flagToken, "token", os.Getenv("SLURPCTL_TOKEN"), "bearer token, defaults to $SLURPCTL_TOKEN")
+	flag.StringVar(&flagHMACKey, "hmacKey", "", "ID of the HMAC key to sign requests with")
+	flag.StringVar(&flagHMACSecret, "hmacSecret", os.Getenv("SLURPCTL_HMAC_SECRET"), "secret of the HMAC key, defaults to $SLURPCTL_HMAC_SECRET")
+	flag.StringVar(&flagCert, "cert", "", "TLS client certificate file")
+	flag.StringVar(&flagKey, "key", "", "key file for -cert")
+	flag.StringVar(&flagCA, "ca", "", "CA file used to verify the server, instead of the system roots")
+	flag.Usage = usage
+}
+
+// command is a slurpctl sub command.
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(c *client, args []string) error
+}
+
+// commands is set up in init as the commands use it for their usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"analysts", "", "List the analysts.", runAnalysts},
+		{"producers", "", "List the producers.", runProducers},
+		{"data-loaders", "", "List the data loaders and their stats.", runDataLoaders},
+		{"range", "-analyst name -time time", "Show the range an analyst analyses for a point in time.", runRange},
+		{"submit", "[flags]", "Submit a point in time or range analysis request.", runSubmit},
+		{"jobs", "", "List queued, running and finished jobs.", runJobs},
+		{"watch", "[job]", "Watch the progress of a job, or of every job.", runWatch},
+		{"cancel", "job", "Cancel a queued or running job.", runCancel},
+		{"results", "[flags] job", "Fetch the results of a job.", runResults},
+		{"audit", "[flags]", "Show the audit log, newest first.", runAudit},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: slurpctl [flags] command [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"slurpctl command -h\" for the flags of a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name != flag.Arg(0) {
+			continue
+		}
+		c, err := newClientFromFlags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "slurpctl: %s\n", err)
+			os.Exit(2)
+		}
+		if err := cmd.run(c, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "slurpctl: unknown command %q\n\n", flag.Arg(0))
+	flag.Usage()
+	os.Exit(2)
+}
+
+// newClientFromFlags returns a client set up with the credentials given by
+// the flags.
+func newClientFromFlags() (*client, error) {
+	c := newClient(flagAddr)
+	c.token = flagToken
+	c.hmacKey = flagHMACKey
+	c.hmacSecret = []byte(flagHMACSecret)
+	if flagHMACKey != "" && flagHMACSecret == "" {
+		return nil, fmt.Errorf("-hmacKey needs -hmacSecret")
+	}
+	if flagCert == "" && flagCA == "" {
+		return c, nil
+	}
+	tc := &tls.Config{}
+	if flagCert != "" {
+		cert, err := tls.LoadX509KeyPair(flagCert, flagKey)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if flagCA != "" {
+		pem, err := ioutil.ReadFile(flagCA)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", flagCA)
+		}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tc
+	c.http = &http.Client{Transport: t}
+	return c, nil
+}
+
+// newFlagSet returns the flags for a command. Parsing exits on error.
+func newFlagSet(name string) *flag.FlagSet {
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: slurpctl %s %s\n\n%s\n", c.name, c.args, c.description)
+			fs.PrintDefaults()
+		}
+		return fs
+	}
+	panic("unknown command " + name)
+}
+
+// parseArgs parses the flags for a command and checks that it was given n
+// arguments.
+func parseArgs(fs *flag.FlagSet, args []string, n int) []string {
+	fs.Parse(args)
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+func runAnalysts(c *client, args []string) error {
+	parseArgs(newFlagSet("analysts"), args, 0)
+	var v slurpd.AnalystMapDTO
+	if err := c.do("GET", "/analysts", nil, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{k, v[k].Name, formatParams(v[k].RequestParams), v[k].Description}
+	}
+	return writeTable(os.Stdout, []string{"ANALYST", "NAME", "PARAMS", "DESCRIPTION"}, rows)
+}
+
+func runProducers(c *client, args []string) error {
+	parseArgs(newFlagSet("producers"), args, 0)
+	var v slurpd.ProducerMapDTO
+	if err := c.do("GET", "/producers", nil, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{k, v[k].Name, v[k].Description}
+	}
+	return writeTable(os.Stdout, []string{"PRODUCER", "NAME", "DESCRIPTION"}, rows)
+}
+
+func runDataLoaders(c *client, args []string) error {
+	parseArgs(newFlagSet("data-loaders"), args, 0)
+	var v slurpd.DataLoaderMapDTO
+	if err := c.do("GET", "/data-loaders", nil, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{k, v[k].Name, "-", "-", "-", "-"}
+		if st := v[k].Stat; st != nil {
+			rows[i][2] = strconv.FormatInt(st.Called.Count, 10)
+			rows[i][3] = formatDuration(st.Called.DurationAvg)
+			rows[i][4] = formatDuration(st.Called.Percentile.P99)
+			rows[i][5] = strconv.FormatInt(st.ReturnNilData.Count, 10)
+		}
+	}
+	return writeTable(os.Stdout, []string{"DATA LOADER", "NAME", "CALLS", "AVG", "P99", "NIL DATA"}, rows)
+}
+
+func runRange(c *client, args []string) error {
+	fs := newFlagSet("range")
+	analyst := fs.String("analyst", "", "the analyst")
+	at := fs.String("time", "now", "the point in time, RFC 3339 or an expression such as \"today 00:00\"")
+	parseArgs(fs, args, 0)
+	t, err := slurpd.ParseFlagTime("time", *at, time.Now())
+	if err != nil {
+		return err
+	}
+	var v slurpd.AnalysisRangeDTO
+	req := slurpd.AnalysisRangeRequestDTO{Analyst: *analyst, Time: t}
+	if err := c.do("POST", "/analysis-range", nil, req, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	return writeTable(os.Stdout, []string{"ANALYST", "TIME", "FROM", "UNTIL"}, [][]string{
+		{*analyst, formatTime(t), formatTime(v.TimeFrom), formatTime(v.TimeUntil)},
+	})
+}
+
+func runSubmit(c *client, args []string) error {
+	fs := newFlagSet("submit")
+	rf := slurpd.NewJobRequestFlags(fs)
+	watch := fs.Bool("watch", false, "watch the job once it has been submitted")
+	parseArgs(fs, args, 0)
+
+	req, err := rf.JobRequest(time.Now())
+	if err != nil {
+		return err
+	}
+	var v slurpd.JobDTO
+	if err := c.do("POST", "/analysis-request", nil, req, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		if err := writeJSON(os.Stdout, v); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(v.Job)
+	}
+	if *watch {
+		return watchJob(c, v.Job, "")
+	}
+	return nil
+}
+
+func runJobs(c *client, args []string) error {
+	parseArgs(newFlagSet("jobs"), args, 0)
+	var v slurpd.JobMapDTO
+	if err := c.do("GET", "/jobs", nil, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return v[keys[i]].Queued.Before(v[keys[j]].Queued)
+	})
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		j := v[k]
+		state := j.State
+		if j.Position > 0 {
+			state += fmt.Sprintf(" (#%d)", j.Position)
+		}
+		by := "-"
+		if j.Identity != nil {
+			by = j.Identity.String()
+		}
+		rows[i] = []string{k, state, j.Producer, strconv.Itoa(j.Priority), by, formatTime(j.Queued), formatTimePtr(j.Started), formatTimePtr(j.Finished)}
+	}
+	return writeTable(os.Stdout, []string{"JOB", "STATE", "PRODUCER", "PRIORITY", "BY", "QUEUED", "STARTED", "FINISHED"}, rows)
+}
+
+func runWatch(c *client, args []string) error {
+	fs := newFlagSet("watch")
+	interval := fs.String("interval", "1s", "how often to show progress")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return watchJob(c, fs.Arg(0), *interval)
+}
+
+// watchJob writes the events for job k, or for every job when k is empty,
+// until the stream ends. With -json each event is written as a line of
+// JSON.
+func watchJob(c *client, k string, interval string) error {
+	path := "/events"
+	if k != "" {
+		path = "/jobs/" + url.PathEscape(k) + "/events"
+	}
+	q := url.Values{}
+	if interval != "" {
+		q.Set("interval", interval)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	return c.events(path, q, func(e sseEvent) error {
+		if flagJSON {
+			return enc.Encode(e)
+		}
+		switch e.Type {
+		case slurpd.EventProgress:
+			var p slurpd.JobProgressDTO
+			if err := json.Unmarshal(e.Data, &p); err != nil {
+				return err
+			}
+			fmt.Printf("%s  %s  %s\n", formatTime(time.Now()), p.Job, formatProgress(&p))
+		case slurpd.EventLoaders:
+			var d slurpd.DataLoaderDeltaMapDTO
+			if err := json.Unmarshal(e.Data, &d); err != nil {
+				return err
+			}
+			keys := make([]string, 0, len(d))
+			for l := range d {
+				keys = append(keys, l)
+			}
+			sort.Strings(keys)
+			for _, l := range keys {
+				fmt.Printf("%s  data loader %s: %d calls, avg %s\n", formatTime(time.Now()), l, d[l].Called, formatDuration(d[l].DurationAvg))
+			}
+		default:
+			var j slurpd.JobEventDTO
+			if err := json.Unmarshal(e.Data, &j); err != nil {
+				return err
+			}
+			if j.Error != "" {
+				fmt.Printf("%s  %s  error: %s\n", formatTime(j.Time), j.Job, j.Error)
+				break
+			}
+			fmt.Printf("%s  %s  %s\n", formatTime(j.Time), j.Job, j.State)
+		}
+		return nil
+	})
+}
+
+func runCancel(c *client, args []string) error {
+	k := parseArgs(newFlagSet("cancel"), args, 1)[0]
+	var v slurpd.JobStatusDTO
+	if err := c.do("POST", "/jobs/"+url.PathEscape(k)+"/cancel", nil, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	if v.State == "running" {
+		fmt.Printf("%s  cancelling, it finishes once the items already taken have been analysed\n", k)
+		return nil
+	}
+	fmt.Printf("%s  %s\n", k, v.State)
+	return nil
+}
+
+func runResults(c *client, args []string) error {
+	fs := newFlagSet("results")
+	format := fs.String("format", "", "export every result as \"csv\", \"ndjson\" or \"parquet\"")
+	out := fs.String("o", "", "file to write an export to, defaults to stdout")
+	offset := fs.Int("offset", 0, "number of results to skip")
+	limit := fs.Int("limit", 100, "number of results to show")
+	k := parseArgs(fs, args, 1)[0]
+	path := "/jobs/" + url.PathEscape(k) + "/results"
+
+	if *format != "" {
+		return exportResults(c, path, *format, *out)
+	}
+	q := url.Values{}
+	q.Set("offset", strconv.Itoa(*offset))
+	q.Set("limit", strconv.Itoa(*limit))
+	var v slurpd.JobResultsDTO
+	if err := c.do("GET", path, q, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	rows := make([][]string, len(v.Results))
+	for i, r := range v.Results {
+		rows[i] = []string{r.Analyst, formatTime(r.From), formatTime(r.Until), formatTime(r.At), formatData(r.Data)}
+	}
+	if err := writeTable(os.Stdout, []string{"ANALYST", "FROM", "UNTIL", "AT", "DATA"}, rows); err != nil {
+		return err
+	}
+	if !v.Finished {
+		fmt.Fprintf(os.Stderr, "Job %s has not finished, there could be more results.\n", k)
+	} else if len(v.Results) == v.Limit {
+		fmt.Fprintf(os.Stderr, "There could be more results, use -offset %d to see them.\n", v.Offset+v.Limit)
+	}
+	return nil
+}
+
+// exportResults writes every result for a job in format to the file at out,
+// or to stdout.
+func exportResults(c *client, path string, format string, out string) error {
+	q := url.Values{}
+	q.Set("format", format)
+	res, err := c.request(context.Background(), "GET", path, q, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == "" {
+		_, err = io.Copy(os.Stdout, res.Body)
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, res.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func runAudit(c *client, args []string) error {
+	fs := newFlagSet("audit")
+	q := url.Values{}
+	for _, name := range []string{"action", "job", "identity"} {
+		name := name
+		fs.Func(name, "only entries for this "+name, func(v string) error {
+			q.Set(name, v)
+			return nil
+		})
+	}
+	since := fs.String("since", "", "only entries at or after this time, RFC 3339 or an expression such as \"today 00:00\"")
+	until := fs.String("until", "", "only entries before this time")
+	offset := fs.Int("offset", 0, "number of entries to skip")
+	limit := fs.Int("limit", 100, "number of entries to show")
+	parseArgs(fs, args, 0)
+	now := time.Now()
+	for name, v := range map[string]string{"since": *since, "until": *until} {
+		if v == "" {
+			continue
+		}
+		t, err := slurpd.ParseFlagTime(name, v, now)
+		if err != nil {
+			return err
+		}
+		q.Set(name, t.Format(time.RFC3339))
+	}
+	q.Set("offset", strconv.Itoa(*offset))
+	q.Set("limit", strconv.Itoa(*limit))
+	var v slurpd.AuditDTO
+	if err := c.do("GET", "/audit", q, nil, &v); err != nil {
+		return err
+	}
+	if flagJSON {
+		return writeJSON(os.Stdout, v)
+	}
+	rows := make([][]string, len(v.Entries))
+	for i, e := range v.Entries {
+		by := "-"
+		if e.Identity != nil {
+			by = e.Identity.String()
+		}
+		what := e.Job
+		switch {
+		case e.Component != "":
+			what = e.Component + " " + e.Name
+		case e.Name != "":
+			what = "schedule " + e.Name
+		}
+		rows[i] = []string{formatTime(e.Time), e.Action, by, what, e.State, e.Error}
+	}
+	if err := writeTable(os.Stdout, []string{"TIME", "ACTION", "BY", "SUBJECT", "STATE", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if len(v.Entries) == v.Limit {
+		fmt.Fprintf(os.Stderr, "There could be more entries, use -offset %d to see them.\n", v.Offset+v.Limit)
+	}
+	return nil
+}
@@ -1,14 +1,52 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/williambailey/go-slurp/slurp"
 	"github.com/williambailey/go-slurp/slurpd"
 )
 
+func init() {
+	slurpd.RegisterDataLoaderFactory("example", &slurpd.DataLoaderFactory{
+		Name:        "Example Loader",
+		Description: "This is just an example.",
+		New: func(p slurp.Params) (slurp.DataLoader, error) {
+			return &exampleLoader{}, nil
+		},
+	})
+	slurpd.RegisterProducerFactory("example", &slurpd.ProducerFactory{
+		Name:        "Example Producer",
+		Description: "This is just an example.",
+		Params: slurp.ParamSchema{
+			{
+				Name:        "interval",
+				Type:        slurp.ParamDuration,
+				Default:     "1s",
+				Description: "Time between the items produced.",
+			},
+		},
+		New: func(p slurp.Params) (slurp.Producer, error) {
+			if p.Duration("interval") <= 0 {
+				return nil, fmt.Errorf("interval must be positive")
+			}
+			return &exampleProducer{interval: p.Duration("interval")}, nil
+		},
+	})
+	slurpd.RegisterAnalystFactory("example", &slurpd.AnalystFactory{
+		Name:        "Example Analyst",
+		Description: "This is just an example.",
+		New: func(p slurp.Params, dataLoaders []slurp.DataLoader) (slurp.Analyst, error) {
+			return &exampleAnalyst{dataLoaders: dataLoaders}, nil
+		},
+	})
+}
+
 func init() {
 	loaderFunc = append(loaderFunc, func(s *slurpd.Slurpd) {
 		l := slurp.NewDataLoaderStatWrapper(&exampleLoader{})
@@ -18,7 +56,7 @@ func init() {
 				l,
 			},
 		})
-		s.RegisterProducer("ex", &exampleProducer{})
+		s.RegisterProducer("ex", &exampleProducer{interval: time.Second})
 		slurpd.HTTPHandlerList = append(
 			slurpd.HTTPHandlerList,
 			&httpHandlerExample{},
@@ -38,32 +76,110 @@ func (a *exampleAnalyst) Description() string {
 	return "This is just an example."
 }
 
-func (a *exampleAnalyst) slurpFunc(items <-chan *slurp.Item) {
-	for _ = range items {
-		// blah...
-		time.Sleep(time.Duration(rand.Intn(1000000)) * time.Nanosecond)
+func (a *exampleAnalyst) ParamSchema() slurp.ParamSchema {
+	return slurp.ParamSchema{
+		{
+			Name:        "label",
+			Type:        slurp.ParamString,
+			Default:     "example",
+			Description: "Label added to the results.",
+		},
 	}
 }
 
-func (a *exampleAnalyst) AnalysisRequest(pointInTime time.Time) *slurp.AnalysisRequest {
-	from, until := a.RangeForAnalysisRequest(pointInTime)
-	return &slurp.AnalysisRequest{
-		Analyst:     a,
-		TimeFrom:    from,
-		TimeUntil:   until,
-		DataLoader:  a.dataLoaders,
-		SlurperFunc: a.slurpFunc,
+// exampleState is what an example analysis has counted so far. It is
+// checkpointed so that the analysis can be resumed after a restart. Items
+// at the time of the latest item are kept apart until an item with a later
+// time arrives, as more items at that time may still be to come.
+type exampleState struct {
+	mutex   sync.Mutex
+	at      time.Time
+	Items   int `json:"items"`
+	Example int `json:"example"`
+	last    time.Time
+	items   int
+	example int
+}
+
+// advance counts the items at the time of the latest item once no more can
+// arrive. The caller must hold mutex.
+func (s *exampleState) advance() {
+	if s.items == 0 {
+		return
 	}
+	s.at = s.last
+	s.Items += s.items
+	s.Example += s.example
+	s.items, s.example = 0, 0
+}
+
+func (s *exampleState) Checkpoint() (time.Time, []byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, err := json.Marshal(s)
+	return s.at, b, err
+}
+
+func (s *exampleState) Restore(at time.Time, state []byte) error {
+	var v exampleState
+	if err := json.Unmarshal(state, &v); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.at, s.Items, s.Example = at, v.Items, v.Example
+	s.last, s.items, s.example = at, 0, 0
+	return nil
+}
+
+func (a *exampleAnalyst) slurpFunc(r *slurp.AnalysisRequest, st *exampleState) slurp.SlurperFunc {
+	return func(items <-chan *slurp.Item) {
+		for i := range items {
+			// blah...
+			time.Sleep(time.Duration(rand.Intn(1000000)) * time.Nanosecond)
+			_, example := i.Data["example"].(int)
+			st.mutex.Lock()
+			if i.At.After(st.last) {
+				st.advance()
+				st.last = i.At
+			}
+			st.items++
+			if example {
+				st.example++
+			}
+			st.mutex.Unlock()
+		}
+		st.mutex.Lock()
+		st.advance()
+		data := map[string]interface{}{
+			"items":   st.Items,
+			"example": st.Example,
+			"label":   r.Params.String("label"),
+		}
+		st.mutex.Unlock()
+		r.Emit(r.TimeUntil, data)
+	}
+}
+
+func (a *exampleAnalyst) DataLoaders() []slurp.DataLoader {
+	return a.dataLoaders
+}
+
+func (a *exampleAnalyst) AnalysisRequest(pointInTime time.Time) *slurp.AnalysisRequest {
+	return a.AnalysisRangeRequest(a.RangeForAnalysisRequest(pointInTime))
 }
 
 func (a *exampleAnalyst) AnalysisRangeRequest(from time.Time, until time.Time) *slurp.AnalysisRequest {
-	return &slurp.AnalysisRequest{
-		Analyst:     a,
-		TimeFrom:    from,
-		TimeUntil:   until,
-		DataLoader:  a.dataLoaders,
-		SlurperFunc: a.slurpFunc,
+	r := &slurp.AnalysisRequest{
+		Analyst:    a,
+		TimeFrom:   from,
+		TimeUntil:  until,
+		DataLoader: a.dataLoaders,
 	}
+	st := &exampleState{}
+	r.SlurperFunc = a.slurpFunc(r, st)
+	r.Checkpointer = st
+	return r
 }
 
 func (a *exampleAnalyst) RangeForAnalysisRequest(pointInTime time.Time) (time.Time, time.Time) {
@@ -75,6 +191,7 @@ func (a *exampleAnalyst) RangeForAnalysisRangeRequest(from time.Time, until time
 }
 
 type exampleProducer struct {
+	interval time.Duration
 }
 
 func (a *exampleProducer) Name() string {
@@ -88,7 +205,7 @@ func (a *exampleProducer) Description() string {
 func (a *exampleProducer) Produce(from time.Time, until time.Time) slurp.ProductionRun {
 	var f slurp.ProductionRunFunc
 	f = func(ch chan<- *slurp.Item) {
-		for i := from.UnixNano(); i < until.UnixNano(); i += int64(time.Second) {
+		for i := from.UnixNano(); i < until.UnixNano(); i += int64(a.interval) {
 			time.Sleep(time.Duration(rand.Intn(1000000)) * time.Nanosecond)
 			item := slurp.NewItem(time.Unix(0, i))
 			ch <- item
@@ -137,15 +254,38 @@ func (h *httpHandlerExample) Readme() string {
 	return "Saves having to use the other APIs :-)"
 }
 
+func (h *httpHandlerExample) Role() slurpd.Role {
+	return slurpd.RoleSubmitter
+}
+
+func (h *httpHandlerExample) Params() []slurpd.HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerExample) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerExample) Response() interface{} {
+	return slurpd.JobDTO{}
+}
+
 func (h *httpHandlerExample) HandlerFunc(s *slurpd.Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		p, _ := s.Producer("ex")
-		a, _ := s.Analyst("ex")
-		go s.SlurpAnalysisRequest(
-			p,
-			a.AnalysisRequest(time.Now().Add(-24*time.Hour)),
-			a.AnalysisRequest(time.Now().Add(-36*time.Hour)),
-		)
-		slurpd.WriteJSONResponse(w, "OK")
+		now := time.Now()
+		k, err := s.SubmitJobAs(slurpd.RequestIdentity(r), &slurpd.JobRequestDTO{
+			Producer: "ex",
+			PointInTimeAnalysis: []slurpd.PointInTimeAnalysisDTO{
+				{Analyst: "ex", Time: now.Add(-24 * time.Hour)},
+				{Analyst: "ex", Time: now.Add(-36 * time.Hour)},
+			},
+		})
+		if err != nil {
+			slurpd.WriteError(w, r, err)
+			return
+		}
+		slurpd.WriteJSONResponse(w, slurpd.JobDTO{
+			Job: k,
+		})
 	}
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+	"github.com/williambailey/go-slurp/slurpd"
+)
+
+// run performs a single analysis request in-process without the HTTP API
+// and returns the exit code, 2 when the command line or request is not
+// valid and 1 when the job fails. NDJSON and CSV results are written out as
+// they arrive, Parquet results are kept in memory until the request has
+// finished.
+func run(sd *slurpd.Slurpd, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	rf := slurpd.NewJobRequestFlags(fs)
+	out := fs.String("o", "", "file to write the results to, defaults to stdout")
+	format := fs.String("format", slurp.ExportNDJSON, "format of the results, \"csv\", \"ndjson\" or \"parquet\"")
+	interval := fs.Duration("progress", time.Second, "how often to log progress, 0 for never")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: slurpd [flags] run [run flags]\n\nRun flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if _, ok := slurp.ExportContentType[*format]; !ok {
+		log.Printf("Unknown results format %q.\n", *format)
+		return 2
+	}
+	req, err := rf.JobRequest(time.Now())
+	if err != nil {
+		log.Printf("Invalid job request: %s.\n", err)
+		return 2
+	}
+	// Checked before the results file is created so that an invalid
+	// request does not overwrite the results of an earlier run.
+	if err = sd.ValidateJobRequest(req); err != nil {
+		logRequestError(err)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			log.Printf("Unable to create results file: %s.\n", err)
+			return 1
+		}
+		w = f
+	}
+	var (
+		rs    slurp.ResultSink
+		store *slurp.MemoryResultStore
+	)
+	if *format == slurp.ExportParquet {
+		store = slurp.NewMemoryResultStore()
+		rs = store
+	} else if rs, err = slurp.NewResultWriter(w, *format); err != nil {
+		log.Printf("Unable to write results: %s.\n", err)
+		return 2
+	}
+
+	// Interrupting stops the job early, the results so far are still
+	// written out.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	k, err := sd.RunJob(ctx, req, rs, *interval, logProgress)
+	code := 0
+	switch {
+	case k == "":
+		logRequestError(err)
+		code = 2
+	case err == context.Canceled:
+		log.Printf("Job %s was interrupted, the results so far have been written.\n", k)
+		code = 1
+	case err != nil:
+		log.Printf("Job %s failed: %s.\n", k, err)
+		code = 1
+	}
+	if store != nil && k != "" {
+		if err := slurp.ExportResults(w, *format, store, k); err != nil {
+			log.Printf("Unable to write results: %s.\n", err)
+			code = 1
+		}
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			log.Printf("Unable to write results: %s.\n", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+func logProgress(v slurpd.SlurperDTO) {
+	eta := ""
+	if v.Progress.ETA != nil {
+		eta = ", eta " + v.Progress.ETA.Local().Format("15:04:05")
+	}
+	log.Printf("Progress: %.1f%%, %d items, %.1f items/s%s.\n", v.Progress.Percent, v.Stat.Count, v.Stat.Rate, eta)
+}
+
+// logRequestError logs why a job request was not valid.
+func logRequestError(err error) {
+	ve, ok := err.(slurpd.ValidationError)
+	if !ok {
+		log.Printf("Invalid job request: %s.\n", err)
+		return
+	}
+	log.Printf("Invalid job request:\n")
+	for _, e := range ve {
+		log.Printf("- %s\n", e)
+	}
+}
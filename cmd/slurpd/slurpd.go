@@ -1,11 +1,19 @@
 package main
 
 import (
-	_ "expvar"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -22,26 +30,190 @@ var (
 	loaderFunc      = make([]func(s *slurpd.Slurpd), 0)
 	flagListen      string
 	flagSlurpBuffer int
+	flagRateWindow  int
+	flagResults     string
+	flagMaxJobs     int
+	flagJobQueue    string
+	flagSchedules   string
+	flagConfig      string
+	flagAuth        string
+	flagTLSCert     string
+	flagTLSKey      string
+	flagTLSClientCA string
+	flagAudit       string
+	flagAuditSize   int64
+	flagAuditFiles  int
+	flagDrain       time.Duration
+	flagCheckpoint  time.Duration
 )
 
 func init() {
 	flag.StringVar(&flagListen, "listen", "127.0.0.1:9000", "where should we listen for http requests")
 	flag.IntVar(&flagSlurpBuffer, "slurpBuffer", 100, "default buffer size to use when slurping")
+	flag.StringVar(&flagResults, "results", "", "NDJSON file to keep analysis results in, results are kept in memory when empty")
+	flag.IntVar(&flagMaxJobs, "maxJobs", 4, "number of jobs that can run at the same time, 0 for no limit")
+	flag.StringVar(&flagJobQueue, "jobQueue", "", "file to keep queued jobs in so that they survive a restart")
+	flag.StringVar(&flagConfig, "config", "", "JSON config file wiring component factories in to producers, data loaders and analysts")
+	flag.StringVar(&flagSchedules, "schedules", "", "JSON file of scheduled recurring analyses to register")
+	flag.IntVar(&flagRateWindow, "rateWindow", slurp.DefaultRateWindow, "number of recent items used to work out slurp rates")
+	flag.StringVar(&flagAuth, "auth", "", "JSON auth config file, the API is open to everyone when empty")
+	flag.StringVar(&flagTLSCert, "tlsCert", "", "certificate file to serve HTTPS with")
+	flag.StringVar(&flagTLSKey, "tlsKey", "", "key file for -tlsCert")
+	flag.StringVar(&flagTLSClientCA, "tlsClientCA", "", "CA file used to verify TLS client certificates, when given")
+	flag.StringVar(&flagAudit, "audit", "", "NDJSON file to keep the audit log in, nothing is audited when empty")
+	flag.Int64Var(&flagAuditSize, "auditMaxSize", 100<<20, "size in bytes at which the audit log is rotated, 0 to never rotate")
+	flag.IntVar(&flagAuditFiles, "auditFiles", 10, "number of rotated audit log files to keep, at least 1 when the audit log is rotated")
+	flag.DurationVar(&flagDrain, "drainTimeout", time.Minute, "how long running jobs get to finish when shutting down before they are cancelled")
+	flag.DurationVar(&flagCheckpoint, "checkpoint", time.Minute, "how often running jobs in the job queue save how far they have got so that they resume from there after a restart, 0 to only save on shutdown")
 }
 
 func init() {
 	// add items to loaderFunc
 }
 
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: slurpd [flags]\n       slurpd [flags] run [run flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Without a command the HTTP API is served. run performs a single\nanalysis request in-process and exits.\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+}
+
 func main() {
 	flag.Parse()
-	if len(flag.Args()) != 0 {
-		flag.PrintDefaults()
-		os.Exit(1)
+	switch {
+	case flag.NArg() > 0 && flag.Arg(0) == "run":
+		os.Exit(run(newSlurpd(), flag.Args()[1:]))
+	case flag.NArg() != 0:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sd := newSlurpd()
+	sd.MaxConcurrentJobs(flagMaxJobs)
+	sd.CheckpointInterval(flagCheckpoint)
+	var closers []io.Closer
+	if flagResults != "" {
+		rs, err := slurp.NewNDJSONResultStore(flagResults)
+		if err != nil {
+			log.Fatalf("Unable to open results file: %s.\n", err)
+		}
+		closers = append(closers, rs)
+		sd.ResultStore(rs)
+	}
+
+	if flagAudit != "" {
+		al, err := slurpd.NewAuditLog(flagAudit, flagAuditSize, flagAuditFiles)
+		if err != nil {
+			log.Fatalf("Unable to open audit log: %s.\n", err)
+		}
+		closers = append(closers, al)
+		sd.AuditLog(al)
+	}
+
+	if flagJobQueue != "" {
+		log.Printf("Restoring job queue from %s.\n", flagJobQueue)
+		if err := sd.JobQueueFile(flagJobQueue); err != nil {
+			log.Fatalf("Unable to restore job queue: %s.\n", err)
+		}
+	}
+
+	if flagSchedules != "" {
+		log.Printf("Loading schedules from %s.\n", flagSchedules)
+		if err := sd.LoadSchedules(flagSchedules); err != nil {
+			log.Fatalf("Unable to load schedules: %s.\n", err)
+		}
+	}
+	stopScheduler := sd.StartScheduler(time.Second)
+
+	if flagAuth != "" {
+		log.Printf("Loading auth config from %s.\n", flagAuth)
+		if err := sd.LoadAuthConfig(flagAuth); err != nil {
+			log.Fatalf("Unable to load auth config: %s.\n", err)
+		}
+	}
+
+	// Wire up the HTTP API.
+	log.Printf("Configuring HTTP API.\n")
+	router := mux.NewRouter()
+	slurpd.ConfigureRouter(sd, router.PathPrefix("/api").Subrouter())
+	router.HandleFunc("/metrics", slurpd.MetricsHandlerFunc(sd)).Methods("GET")
+	router.Handle("/debug/vars", sd.Authorize(slurpd.RoleViewer, expvar.Handler())).Methods("GET")
+	router.PathPrefix("/").Handler(slurpd.DashboardHandler()).Methods("GET")
+
+	srv := &http.Server{
+		Addr:    flagListen,
+		Handler: router,
+	}
+	if flagTLSClientCA != "" {
+		pem, err := ioutil.ReadFile(flagTLSClientCA)
+		if err != nil {
+			log.Fatalf("Unable to read client CA: %s.\n", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s.\n", flagTLSClientCA)
+		}
+		// Clients without a certificate can still use other credentials.
+		srv.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+		}
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	serveErr := make(chan error, 1)
+	go func() {
+		if flagTLSCert != "" {
+			log.Printf("Starting HTTPS server on %s\n", flagListen)
+			serveErr <- srv.ListenAndServeTLS(flagTLSCert, flagTLSKey)
+			return
+		}
+		log.Printf("Starting HTTP server on %s\n", flagListen)
+		serveErr <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		log.Panic(err)
+	case <-ctx.Done():
+	}
+	stop()
+	stopScheduler()
+	shutdown(sd, srv, closers)
+}
 
+// shutdown drains sd, stops the HTTP server and then closes the result store
+// and audit log. The HTTP API stays up while draining so that jobs can still
+// be watched. Interrupting again cancels the running jobs straight away.
+func shutdown(sd *slurpd.Slurpd, srv *http.Server, closers []io.Closer) {
+	log.Printf("Shutting down, running jobs have %s to finish. Interrupt again to cancel them now.\n", flagDrain)
+	ctx, cancel := context.WithTimeout(context.Background(), flagDrain)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, k := range sd.Drain(ctx) {
+		log.Printf("Cancelled job %s.\n", k)
+	}
+
+	log.Printf("Stopping HTTP server.\n")
+	ctx, cancelHTTP := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Unable to stop HTTP server cleanly: %s.\n", err)
+	}
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Printf("Unable to close %T: %s.\n", c, err)
+		}
+	}
+	log.Printf("Stopped.\n")
+}
+
+// newSlurpd returns a Slurpd with the components from the loader functions
+// and the config file registered.
+func newSlurpd() *slurpd.Slurpd {
 	sd := slurpd.NewSlurpd()
 	sd.SlurpBuffer(flagSlurpBuffer)
+	sd.SlurpRateWindow(flagRateWindow)
 
 	// Call any loader functions that we might have.
 	log.Printf("Calling loader functions (%d).\n", len(loaderFunc))
@@ -51,12 +223,11 @@ func main() {
 	}
 	loaderFunc = nil
 
-	// Wire up the HTTP API.
-	log.Printf("Configuring HTTP API.\n")
-	router := mux.NewRouter()
-	slurpd.ConfigureRouter(sd, router.PathPrefix("/api").Subrouter())
-
-	log.Printf("Starting HTTP server on %s\n", flagListen)
-	http.Handle("/", router)
-	log.Panic(http.ListenAndServe(flagListen, nil))
+	if flagConfig != "" {
+		log.Printf("Loading config from %s.\n", flagConfig)
+		if err := sd.LoadConfig(flagConfig); err != nil {
+			log.Fatalf("Unable to load config: %s.\n", err)
+		}
+	}
+	return sd
 }
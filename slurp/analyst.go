@@ -1,7 +1,9 @@
 package slurp
 
 import (
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,29 +21,98 @@ type Analyst interface {
 	RangeForAnalysisRangeRequest(from time.Time, until time.Time) (f time.Time, u time.Time)
 }
 
+// ParamAnalyst is an Analyst that takes parameters with its analysis
+// requests.
+type ParamAnalyst interface {
+	Analyst
+	//ParamSchema describes the parameters that analysis requests can have.
+	ParamSchema() ParamSchema
+}
+
+// DataLoaderAnalyst is an Analyst that tells us which data loaders its
+// analysis requests use.
+type DataLoaderAnalyst interface {
+	Analyst
+	//DataLoaders returns the data loaders that analysis requests will use.
+	DataLoaders() []DataLoader
+}
+
 // AnalysisRequest contains information about how the Analyst wants its data.
+// Params are set after the request has been made, so they should be read
+// from the request when slurping.
 type AnalysisRequest struct {
 	Analyst     Analyst
 	TimeFrom    time.Time
 	TimeUntil   time.Time
+	Params      Params
 	DataLoader  []DataLoader
 	SlurperFunc SlurperFunc
+	Results     ResultSink
+	// Checkpointer saves and restores the state of the analysis, nil when
+	// the analysis has no state to keep between items.
+	Checkpointer Checkpointer
+}
+
+// Emit writes a result for the analysis request to its Results sink. The
+// result is discarded when there is no sink.
+func (r *AnalysisRequest) Emit(at time.Time, data map[string]interface{}) error {
+	if r.Results == nil {
+		return nil
+	}
+	return r.Results.WriteResult(&AnalysisResult{
+		From:  r.TimeFrom,
+		Until: r.TimeUntil,
+		At:    at,
+		Data:  data,
+	})
 }
 
 // AnalysisRequestSlurper coordinates a Slurp for multiple AnalysisRequests.
+//
+// Set TrackCheckpoints to use Checkpoints while slurping. It follows the
+// items that each request has analysed, which costs an extra goroutine per
+// request, so it is only done when it is set, Resume is set or a request
+// has a Checkpointer.
 type AnalysisRequestSlurper struct {
-	Requests        []*AnalysisRequest
-	slurpChanRate   *ItemChannelStatWrapper
-	analystChanRate []*ItemChannelStatWrapper
+	Requests         []*AnalysisRequest
+	Clock            Clock        // Used for stats, SystemClock is used when nil.
+	RateWindow       int          // Items used for rates, DefaultRateWindow when 0.
+	Tracer           Tracer       // NopTracer is used when nil.
+	TraceParent      Span         // Parent of the spans started by the slurp.
+	TraceLoadData    int          // Trace LoadData for every nth item, 0 disables.
+	Resume           []Checkpoint // Where each request got to, when resuming.
+	TrackCheckpoints bool         // Follow the requests while slurping for Checkpoints.
+	mutex            sync.RWMutex
+	slurpChanRate    *ItemChannelStatWrapper
+	analystChanRate  []*ItemChannelStatWrapper
+	requestBlocked   []time.Duration
+	loadDuration     time.Duration
+	delivered        []delivery
+}
+
+// delivery follows the items handed to an analysis request. Analysis
+// requests take one item at a time, so once an item has been handed over
+// those before it have been analysed. Times are in Unix nanoseconds and are
+// read and written atomically, math.MinInt64 when there is no item yet.
+type delivery struct {
+	last int64 // Time of the last item handed over.
+	done int64 // Time up to which every item has been analysed.
 }
 
 // SlurpStat returns the stat of main item channel.
 func (s *AnalysisRequestSlurper) SlurpStat() ItemChannelStat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.slurpChanRate == nil {
+		return ItemChannelStat{}
+	}
 	return s.slurpChanRate.Stat()
 }
 
 // RequestStat return the stats of the channels for the analysis requests.
 func (s *AnalysisRequestSlurper) RequestStat() []ItemChannelStat {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	r := make([]ItemChannelStat, len(s.Requests))
 	for i, rate := range s.analystChanRate {
 		if rate != nil {
@@ -51,6 +122,136 @@ func (s *AnalysisRequestSlurper) RequestStat() []ItemChannelStat {
 	return r
 }
 
+// RequestBlocked returns the time that the slurp has spent waiting to send
+// items to each of the analysis requests. An analysis request that is not
+// keeping up will hold up all of the others.
+func (s *AnalysisRequestSlurper) RequestBlocked() []time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	r := make([]time.Duration, len(s.Requests))
+	copy(r, s.requestBlocked)
+	return r
+}
+
+// LoadDuration returns the time that the slurp has spent loading data.
+func (s *AnalysisRequestSlurper) LoadDuration() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.loadDuration
+}
+
+// Checkpoints returns how far each of the analysis requests has got, which
+// can be used as Resume for a later slurp. Items up to and including the
+// time of the checkpoint of a request in Resume are not sent to it again.
+// The time and state come from the Checkpointer of the request when it has
+// one, otherwise items are analysed at least once as described by
+// Checkpoint. It is safe to call while slurping, as long as the
+// Checkpointers are.
+func (s *AnalysisRequestSlurper) Checkpoints() ([]Checkpoint, error) {
+	r := make([]Checkpoint, len(s.Requests))
+	s.mutex.RLock()
+	delivered := s.delivered
+	s.mutex.RUnlock()
+	for i := range r {
+		if i < len(s.Resume) {
+			r[i].At = s.Resume[i].At
+		}
+		if i >= len(delivered) {
+			continue
+		}
+		if done := atomic.LoadInt64(&delivered[i].done); done != math.MinInt64 && done > r[i].At.UnixNano() {
+			r[i].At = time.Unix(0, done).UTC()
+		}
+	}
+	for i, req := range s.Requests {
+		if req.Checkpointer == nil {
+			continue
+		}
+		at, state, err := req.Checkpointer.Checkpoint()
+		if err != nil {
+			return nil, err
+		}
+		r[i] = Checkpoint{At: at, State: state}
+	}
+	return r, nil
+}
+
+// TimeRange returns the min from and max until values of the requests,
+// leaving out the items that Resume says the requests have already had.
+func (s *AnalysisRequestSlurper) TimeRange() (time.Time, time.Time) {
+	var timeFrom time.Time
+	_, timeUntil := AnalysisRequestTimeRange(s.Requests...)
+	for i, r := range s.Requests {
+		from := r.TimeFrom
+		if i < len(s.Resume) && s.Resume[i].At.After(from) {
+			from = s.Resume[i].At
+		}
+		if from.Before(timeFrom) || timeFrom.IsZero() {
+			timeFrom = from
+		}
+	}
+	if timeFrom.After(timeUntil) {
+		timeFrom = timeUntil
+	}
+	return timeFrom, timeUntil
+}
+
+// deliver records that an item at the given time has been handed to a
+// request. Only the goroutine handing items to the request may call it.
+func (d *delivery) deliver(at int64) {
+	last := atomic.LoadInt64(&d.last)
+	if last != math.MinInt64 && at > last {
+		atomic.StoreInt64(&d.done, last)
+	}
+	atomic.StoreInt64(&d.last, at)
+}
+
+// tracksCheckpoints tells us if the items analysed by each request need to
+// be followed while slurping.
+func (s *AnalysisRequestSlurper) tracksCheckpoints() bool {
+	if s.TrackCheckpoints || len(s.Resume) > 0 {
+		return true
+	}
+	for _, r := range s.Requests {
+		if r.Checkpointer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Stages of a slurp that can be returned by AnalysisRequestSlurper.Bottleneck
+const (
+	BottleneckNone            = ""
+	BottleneckProducer        = "producer"
+	BottleneckDataLoader      = "dataLoader"
+	BottleneckAnalysisRequest = "analysisRequest"
+)
+
+// Bottleneck works out which stage of the slurp has held it up the most by
+// comparing the time spent waiting for the producer, loading data and
+// waiting on each analysis request. The request index is only meaningful
+// when the stage is BottleneckAnalysisRequest, otherwise it is -1.
+func (s *AnalysisRequestSlurper) Bottleneck() (stage string, request int) {
+	var (
+		waited time.Duration
+		stat   = s.SlurpStat()
+	)
+	stage, request = BottleneckNone, -1
+	if stat.InBlocked > waited {
+		stage, waited = BottleneckProducer, stat.InBlocked
+	}
+	if d := s.LoadDuration(); d > waited {
+		stage, waited = BottleneckDataLoader, d
+	}
+	for i, d := range s.RequestBlocked() {
+		if d > waited {
+			stage, request, waited = BottleneckAnalysisRequest, i, d
+		}
+	}
+	return stage, request
+}
+
 // Slurp pull items and send to AnalysisRequests as required.
 func (s *AnalysisRequestSlurper) Slurp(items <-chan *Item) {
 	var (
@@ -61,14 +262,48 @@ func (s *AnalysisRequestSlurper) Slurp(items <-chan *Item) {
 		uAt        int64
 		uFrom      int64
 		uUntil     int64
+		uResume    []int64
 		item       *Item
 		itemLoaded bool
 		loaders    []DataLoader
+		loadCount  int
+		t          time.Time
 	)
-	s.slurpChanRate = NewItemChannelStatWrapper(items)
+	clock := s.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	tracer := s.Tracer
+	if tracer == nil {
+		tracer = NopTracer
+	}
+	newStatWrapper := func(ch <-chan *Item) *ItemChannelStatWrapper {
+		w := NewItemChannelStatWrapperWithClock(ch, clock)
+		if s.RateWindow > 0 {
+			w.SetRateWindow(s.RateWindow)
+		}
+		return w
+	}
+	span := tracer.StartSpan("slurp.AnalysisRequestSlurper", s.TraceParent)
+	defer span.End()
+	span.SetAttribute("requests", len(s.Requests))
 	wg := sync.WaitGroup{}
 	analystChan := make([]chan *Item, len(s.Requests))
+	s.mutex.Lock()
+	s.slurpChanRate = newStatWrapper(items)
 	s.analystChanRate = make([]*ItemChannelStatWrapper, len(s.Requests))
+	s.requestBlocked = make([]time.Duration, len(s.Requests))
+	s.loadDuration = 0
+	s.delivered = nil
+	track := s.tracksCheckpoints()
+	if track {
+		s.delivered = make([]delivery, len(s.Requests))
+		for i := range s.delivered {
+			s.delivered[i] = delivery{last: math.MinInt64, done: math.MinInt64}
+		}
+	}
+	delivered := s.delivered
+	s.mutex.Unlock()
 	hasLoader := func(l DataLoader) bool {
 		for _, v := range loaders {
 			if l == v {
@@ -78,19 +313,47 @@ func (s *AnalysisRequestSlurper) Slurp(items <-chan *Item) {
 		return false
 	}
 	timeFrom, timeUntil = AnalysisRequestTimeRange(s.Requests...)
+	uResume = make([]int64, len(s.Requests))
 	for i, r = range s.Requests {
+		uResume[i] = math.MinInt64
+		if i < len(s.Resume) && !s.Resume[i].At.IsZero() {
+			uResume[i] = s.Resume[i].At.UnixNano()
+		}
 		for _, l := range r.DataLoader {
 			if !hasLoader(l) {
 				loaders = append(loaders, l)
 			}
 		}
 		analystChan[i] = make(chan *Item, cap(items))
-		s.analystChanRate[i] = NewItemChannelStatWrapper(analystChan[i])
+		rate := newStatWrapper(analystChan[i])
+		s.mutex.Lock()
+		s.analystChanRate[i] = rate
+		s.mutex.Unlock()
+		rSpan := tracer.StartSpan("slurp.AnalysisRequest", span)
+		rSpan.SetAttribute("request", i)
+		rSpan.SetAttribute("analyst", describedName(r.Analyst))
+		rSpan.SetAttribute("from", r.TimeFrom)
+		rSpan.SetAttribute("until", r.TimeUntil)
+		var ch <-chan *Item = rate.Out
+		if track && r.Checkpointer == nil {
+			// Items are handed over one at a time so that we know when
+			// the request has finished with the one before.
+			out := make(chan *Item)
+			go func(d *delivery, ch <-chan *Item) {
+				defer close(out)
+				for item := range ch {
+					out <- item
+					d.deliver(item.At.UnixNano())
+				}
+			}(&delivered[i], rate.Out)
+			ch = out
+		}
 		wg.Add(1)
-		go func(s Slurper, ch <-chan *Item) {
+		go func(s Slurper, ch <-chan *Item, span Span) {
 			defer wg.Done()
+			defer span.End()
 			s.Slurp(ch)
-		}(r.SlurperFunc, s.analystChanRate[i].Out)
+		}(r.SlurperFunc, ch, rSpan)
 	}
 	uFrom = timeFrom.UnixNano()
 	uUntil = timeUntil.UnixNano()
@@ -101,21 +364,33 @@ func (s *AnalysisRequestSlurper) Slurp(items <-chan *Item) {
 		}
 		itemLoaded = len(loaders) == 0
 		for i, r = range s.Requests {
-			if uAt < r.TimeFrom.UnixNano() || uAt >= r.TimeUntil.UnixNano() {
+			if uAt < r.TimeFrom.UnixNano() || uAt >= r.TimeUntil.UnixNano() || uAt <= uResume[i] {
 				continue
 			}
 			if !itemLoaded {
-				LoadData(item, loaders...)
+				t = clock.Now()
+				if s.TraceLoadData > 0 && loadCount%s.TraceLoadData == 0 {
+					TraceLoadData(tracer, span, item, loaders...)
+				} else {
+					LoadData(item, loaders...)
+				}
+				d := clock.Now().Sub(t)
+				s.mutex.Lock()
+				s.loadDuration += d
+				s.mutex.Unlock()
+				loadCount++
 				itemLoaded = true
 			}
+			t = clock.Now()
 			analystChan[i] <- item
+			d := clock.Now().Sub(t)
+			s.mutex.Lock()
+			s.requestBlocked[i] += d
+			s.mutex.Unlock()
 		}
 	}
-	for i, rate := range s.analystChanRate {
-		if rate != nil {
-			close(analystChan[i])
-		}
-		s.analystChanRate[i] = nil
+	for i := range analystChan {
+		close(analystChan[i])
 	}
 	wg.Wait()
 }
@@ -0,0 +1,79 @@
+package slurp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalysisRequestSlurperBottleneck(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	fast := func(items <-chan *Item) {
+		for _ = range items {
+		}
+	}
+	slow := func(items <-chan *Item) {
+		for _ = range items {
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	s := NewAnalysisRequestSlurper(
+		&AnalysisRequest{
+			TimeFrom:    base,
+			TimeUntil:   base.Add(time.Hour),
+			SlurperFunc: fast,
+		},
+		&AnalysisRequest{
+			TimeFrom:    base,
+			TimeUntil:   base.Add(time.Hour),
+			SlurperFunc: slow,
+		},
+	)
+	s.RateWindow = 10
+	ch := make(chan *Item, 5)
+	go func() {
+		for i := 0; i < 50; i++ {
+			ch <- NewItem(base.Add(time.Duration(i) * time.Second))
+		}
+		close(ch)
+	}()
+	s.Slurp(ch)
+	stage, request := s.Bottleneck()
+	if stage != BottleneckAnalysisRequest || request != 1 {
+		t.Errorf("Expecting analysis request 1 to be the bottleneck, got %q %d.", stage, request)
+	}
+	blocked := s.RequestBlocked()
+	if blocked[1] <= blocked[0] {
+		t.Errorf("Expecting request 1 to have blocked for longer than request 0, got %s and %s.", blocked[1], blocked[0])
+	}
+	stat := s.RequestStat()
+	if stat[1].OutBlocked < 40*time.Millisecond {
+		t.Errorf("Expecting request 1 to have spent at least 40ms waiting for items to be taken, got %s.", stat[1].OutBlocked)
+	}
+	if stat[1].Count != 50 {
+		t.Errorf("Expecting request 1 stats to be kept after the slurp, got a count of %d.", stat[1].Count)
+	}
+}
+
+func TestAnalysisRequestSlurperProducerBottleneck(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewAnalysisRequestSlurper(&AnalysisRequest{
+		TimeFrom:  base,
+		TimeUntil: base.Add(time.Hour),
+		SlurperFunc: func(items <-chan *Item) {
+			for _ = range items {
+			}
+		},
+	})
+	ch := make(chan *Item)
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(2 * time.Millisecond)
+			ch <- NewItem(base.Add(time.Duration(i) * time.Second))
+		}
+		close(ch)
+	}()
+	s.Slurp(ch)
+	if stage, _ := s.Bottleneck(); stage != BottleneckProducer {
+		t.Errorf("Expecting the producer to be the bottleneck, got %q.", stage)
+	}
+}
@@ -0,0 +1,35 @@
+package slurp
+
+import (
+	"time"
+)
+
+// Checkpoint is how far an analysis request had got with a slurp. Items up
+// to and including At are not sent to the request again when resuming from
+// it. State is from the Checkpointer of the request, if it has one.
+//
+// Without a Checkpointer, At is the time of the items before the last one
+// handed to the request, as that one may still have been being analysed. It
+// is sent again when resuming even if its analysis had finished, so items
+// are analysed at least once and their results may be written twice.
+type Checkpoint struct {
+	At    time.Time `json:"at"`
+	State []byte    `json:"state,omitempty"`
+}
+
+// Checkpointer can be set on an AnalysisRequest to save and restore the
+// state of its analysis, so that a slurp that was interrupted can be resumed.
+// Analysis requests that keep state between items need one, as a resumed
+// slurp only sends them the items after their checkpoint.
+type Checkpointer interface {
+	// Checkpoint returns the state of the analysis along with the time
+	// of the last item that the state includes. It is called from
+	// another goroutine while slurping, and after the slurp has ended.
+	// Items with the same time as at that have not been analysed yet are
+	// not sent when resuming, so at should only move on once an item
+	// with a later time has arrived when many items share a time.
+	Checkpoint() (at time.Time, state []byte, err error)
+	// Restore sets the state of the analysis from a checkpoint before
+	// the slurp starts. The state should be left as it was on error.
+	Restore(at time.Time, state []byte) error
+}
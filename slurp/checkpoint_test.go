@@ -0,0 +1,179 @@
+package slurp
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countCheckpointer counts the items that an analysis request has had.
+type countCheckpointer struct {
+	mutex sync.Mutex
+	at    time.Time
+	count int
+}
+
+func (c *countCheckpointer) slurp(items <-chan *Item) {
+	for item := range items {
+		c.mutex.Lock()
+		c.at = item.At
+		c.count++
+		c.mutex.Unlock()
+	}
+}
+
+func (c *countCheckpointer) Checkpoint() (time.Time, []byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.at, []byte(strconv.Itoa(c.count)), nil
+}
+
+func (c *countCheckpointer) Restore(at time.Time, state []byte) error {
+	n, err := strconv.Atoi(string(state))
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.at, c.count = at, n
+	return nil
+}
+
+func expectCheckpointAt(t *testing.T, s *AnalysisRequestSlurper, at time.Time) {
+	var got time.Time
+	for i := 0; i < 100; i++ {
+		cps, err := s.Checkpoints()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = cps[0].At; got.Equal(at) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("Expecting a checkpoint at %s, got %s.", at, got)
+}
+
+func TestAnalysisRequestSlurperCheckpoints(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := make(chan *Item)
+	next := make(chan struct{})
+	s := NewAnalysisRequestSlurper(&AnalysisRequest{
+		TimeFrom:  base,
+		TimeUntil: base.Add(time.Hour),
+		SlurperFunc: func(items <-chan *Item) {
+			for item := range items {
+				got <- item
+				<-next
+			}
+		},
+	})
+	s.TrackCheckpoints = true
+	ch := make(chan *Item)
+	done := make(chan struct{})
+	go func() {
+		s.Slurp(ch)
+		close(done)
+	}()
+	at := []time.Time{base, base.Add(time.Second), base.Add(time.Second), base.Add(2 * time.Second)}
+	go func() {
+		for _, t := range at {
+			ch <- NewItem(t)
+		}
+		close(ch)
+	}()
+
+	// Items that share a time are only done once a later item is taken.
+	want := []time.Time{{}, at[0], at[0], at[2]}
+	for i := range at {
+		<-got
+		expectCheckpointAt(t, s, want[i])
+		next <- struct{}{}
+	}
+	<-done
+	expectCheckpointAt(t, s, at[2])
+}
+
+func TestAnalysisRequestSlurperResume(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mutex sync.Mutex
+	var plain []time.Time
+	c := &countCheckpointer{}
+	s := NewAnalysisRequestSlurper(
+		&AnalysisRequest{
+			TimeFrom:  base,
+			TimeUntil: base.Add(time.Hour),
+			SlurperFunc: func(items <-chan *Item) {
+				for item := range items {
+					mutex.Lock()
+					plain = append(plain, item.At)
+					mutex.Unlock()
+				}
+			},
+		},
+		&AnalysisRequest{
+			TimeFrom:     base,
+			TimeUntil:    base.Add(time.Hour),
+			SlurperFunc:  c.slurp,
+			Checkpointer: c,
+		},
+	)
+	if err := c.Restore(base.Add(time.Second), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	s.Resume = []Checkpoint{
+		{At: base.Add(3 * time.Second)},
+		{At: base.Add(time.Second), State: []byte("2")},
+	}
+	from, until := s.TimeRange()
+	if !from.Equal(base.Add(time.Second)) || !until.Equal(base.Add(time.Hour)) {
+		t.Errorf("Expecting to resume from the earliest checkpoint, got %s to %s.", from, until)
+	}
+
+	ch := make(chan *Item, 10)
+	for i := 0; i < 6; i++ {
+		ch <- NewItem(base.Add(time.Duration(i) * time.Second))
+	}
+	close(ch)
+	s.Slurp(ch)
+	if len(plain) != 2 || !plain[0].Equal(base.Add(4*time.Second)) {
+		t.Errorf("Expecting only the items after the checkpoint, got %v.", plain)
+	}
+	cps, err := s.Checkpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cps[0].At.Equal(base.Add(4*time.Second)) || string(cps[1].State) != "6" || !cps[1].At.Equal(base.Add(5*time.Second)) {
+		t.Errorf("Expecting checkpoints from the slurp and the checkpointer, got %+v.", cps)
+	}
+}
+
+func TestAnalysisRequestSlurperUntracked(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := 0
+	s := NewAnalysisRequestSlurper(&AnalysisRequest{
+		TimeFrom:  base,
+		TimeUntil: base.Add(time.Hour),
+		SlurperFunc: func(items <-chan *Item) {
+			for range items {
+				n++
+			}
+		},
+	})
+	ch := make(chan *Item, 2)
+	ch <- NewItem(base)
+	ch <- NewItem(base.Add(time.Second))
+	close(ch)
+	s.Slurp(ch)
+	if n != 2 {
+		t.Errorf("Expecting 2 items, got %d.", n)
+	}
+	cps, err := s.Checkpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cps[0].At.IsZero() {
+		t.Errorf("Expecting no checkpoint when it is not being tracked, got %s.", cps[0].At)
+	}
+}
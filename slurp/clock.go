@@ -0,0 +1,21 @@
+package slurp
+
+import "time"
+
+// Clock tells the time. It allows the time used for stats and rate
+// calculations to be controlled.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter that allow you to use
+// an ordinary function as a Clock.
+type ClockFunc func() time.Time
+
+// Now calls f()
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is a Clock that uses the system time.
+var SystemClock Clock = ClockFunc(time.Now)
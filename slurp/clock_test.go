@@ -0,0 +1,81 @@
+package slurp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+	"github.com/williambailey/go-slurp/slurp/slurptest"
+)
+
+func TestItemChannelStatWrapperRate(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := slurptest.NewClock(base)
+	ch := make(chan *slurp.Item)
+	w := slurp.NewItemChannelStatWrapperWithClock(ch, clock)
+	if rate := w.Stat().Rate; rate != 0 {
+		t.Errorf("Expecting a rate of 0 before any items, got %v.", rate)
+	}
+	for n := 0; n < 150; n++ {
+		clock.Advance(100 * time.Millisecond)
+		ch <- slurp.NewItem(base.Add(time.Duration(n) * time.Second))
+		<-w.Out
+	}
+	// Only the most recent 100 items are used. The oldest of those was
+	// received at 5.1s and we are now at 15.1s.
+	clock.Advance(100 * time.Millisecond)
+	stat := w.Stat()
+	if want := 10.0; stat.Rate != want {
+		t.Errorf("Expecting a rate of %v, got %v.", want, stat.Rate)
+	}
+	itemAt := base.Add(149 * time.Second)
+	slurptest.AssertItemChannelStat(t, stat, slurp.ItemChannelStat{
+		ItemAt: &itemAt,
+		Count:  150,
+	})
+	// The oldest of the 10 most recent items was received at 14.1s and
+	// we are now at 16.1s.
+	w.SetRateWindow(10)
+	clock.Advance(time.Second)
+	if want := 5.0; w.Stat().Rate != want {
+		t.Errorf("Expecting a rate of %v with a smaller window, got %v.", want, w.Stat().Rate)
+	}
+	close(ch)
+	for _ = range w.Out {
+	}
+	if rate := w.Stat().Rate; rate != 0 {
+		t.Errorf("Expecting a rate of 0 once closed, got %v.", rate)
+	}
+}
+
+func TestDataLoaderStatWrapperClock(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := slurptest.NewClock(base)
+	calls := 0
+	w := slurp.NewDataLoaderStatWrapperWithClock(slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+		calls++
+		clock.Advance(time.Duration(calls) * time.Millisecond)
+		return "k", calls
+	}), clock)
+	for n := 0; n < 3; n++ {
+		w.LoadData(slurp.NewItem(base))
+		clock.Advance(time.Second)
+	}
+	stat := w.Stat()
+	slurptest.AssertDataLoaderStatCount(t, stat, 3, 0, 0, 3)
+	if want := base; !stat.Called.FirstCallAt.Equal(want) {
+		t.Errorf("Expecting first call at %s, got %s.", want, stat.Called.FirstCallAt)
+	}
+	if want := base.Add(2*time.Second + 3*time.Millisecond); !stat.Called.LastCallAt.Equal(want) {
+		t.Errorf("Expecting last call at %s, got %s.", want, stat.Called.LastCallAt)
+	}
+	if want := time.Millisecond; stat.Called.DurationMin != want {
+		t.Errorf("Expecting min duration of %s, got %s.", want, stat.Called.DurationMin)
+	}
+	if want := 2 * time.Millisecond; stat.Called.DurationAvg != want {
+		t.Errorf("Expecting avg duration of %s, got %s.", want, stat.Called.DurationAvg)
+	}
+	if want := 3 * time.Millisecond; stat.Called.DurationMax != want {
+		t.Errorf("Expecting max duration of %s, got %s.", want, stat.Called.DurationMax)
+	}
+}
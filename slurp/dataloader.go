@@ -28,15 +28,25 @@ func (f DataLoaderFunc) LoadData(item *Item) (string, interface{}) {
 	return f(item)
 }
 
+// DefaultDataLoaderStatWindow is the length of the rolling window that
+// DataLoaderStatWrapper provides stats for, in addition to the totals.
+const DefaultDataLoaderStatWindow = time.Minute
+
+// dataLoaderStatWindowSlots is the number of slots that the rolling window
+// is broken up in to. Stats move out of the window one slot at a time.
+const dataLoaderStatWindowSlots = 6
+
 // DataLoaderStatValue provices a standard set of stat counters.
 type DataLoaderStatValue struct {
-	FirstCallAt   *time.Time    `json:"firstCallAt,omitempty"`
-	LastCallAt    *time.Time    `json:"lastCallAt,omitempty"`
-	Count         int64         `json:"count"`
-	DurationTotal time.Duration `json:"durationTotal"`
-	DurationMin   time.Duration `json:"durationMin"`
-	DurationAvg   time.Duration `json:"durationAvg"`
-	DurationMax   time.Duration `json:"durationMax"`
+	FirstCallAt   *time.Time         `json:"firstCallAt,omitempty"`
+	LastCallAt    *time.Time         `json:"lastCallAt,omitempty"`
+	Count         int64              `json:"count"`
+	DurationTotal time.Duration      `json:"durationTotal"`
+	DurationMin   time.Duration      `json:"durationMin"`
+	DurationAvg   time.Duration      `json:"durationAvg"`
+	DurationMax   time.Duration      `json:"durationMax"`
+	Percentile    DurationPercentile `json:"percentile"`
+	histogram     *durationHistogram
 }
 
 // Called updates *DataLoaderStat
@@ -56,22 +66,104 @@ func (s *DataLoaderStatValue) called(t time.Time, d time.Duration) {
 	if d > s.DurationMax {
 		s.DurationMax = d
 	}
+	if s.histogram == nil {
+		s.histogram = &durationHistogram{}
+	}
+	s.histogram.record(d)
+}
+
+// merge adds the counters from o to *DataLoaderStatValue
+func (s *DataLoaderStatValue) merge(o *DataLoaderStatValue) {
+	if o.Count == 0 {
+		return
+	}
+	if s.FirstCallAt == nil || o.FirstCallAt.Before(*s.FirstCallAt) {
+		s.FirstCallAt = o.FirstCallAt
+	}
+	if s.LastCallAt == nil || o.LastCallAt.After(*s.LastCallAt) {
+		s.LastCallAt = o.LastCallAt
+	}
+	if o.DurationMin < s.DurationMin || s.DurationMin == 0 {
+		s.DurationMin = o.DurationMin
+	}
+	if o.DurationMax > s.DurationMax {
+		s.DurationMax = o.DurationMax
+	}
+	s.Count += o.Count
+	s.DurationTotal += o.DurationTotal
+	s.DurationAvg = time.Duration(int64(s.DurationTotal) / s.Count)
+	if s.histogram == nil {
+		s.histogram = &durationHistogram{}
+	}
+	s.histogram.merge(o.histogram)
+}
+
+// snapshot returns a copy of the value with the percentiles filled in.
+func (s *DataLoaderStatValue) snapshot() DataLoaderStatValue {
+	v := *s
+	v.histogram = nil
+	if s.histogram != nil {
+		v.Percentile = s.histogram.durationPercentile()
+	}
+	return v
+}
+
+// dataLoaderStatValues groups the values that DataLoaderStatWrapper keeps.
+type dataLoaderStatValues struct {
+	called         DataLoaderStatValue
+	returnEmptyKey DataLoaderStatValue
+	returnNilData  DataLoaderStatValue
+	returnData     DataLoaderStatValue
+}
+
+func (v *dataLoaderStatValues) record(t time.Time, d time.Duration, k string, data interface{}) {
+	v.called.called(t, d)
+	if k == "" {
+		v.returnEmptyKey.called(t, d)
+	} else {
+		if data == nil {
+			v.returnNilData.called(t, d)
+		} else {
+			v.returnData.called(t, d)
+		}
+	}
+}
+
+func (v *dataLoaderStatValues) merge(o *dataLoaderStatValues) {
+	v.called.merge(&o.called)
+	v.returnEmptyKey.merge(&o.returnEmptyKey)
+	v.returnNilData.merge(&o.returnNilData)
+	v.returnData.merge(&o.returnData)
+}
+
+// dataLoaderStatSlot holds the values for one slot of the rolling window.
+type dataLoaderStatSlot struct {
+	epoch  int64
+	values dataLoaderStatValues
 }
 
 // DataLoaderStatWrapper wraps a DataLoader and provides stats about it.
 type DataLoaderStatWrapper struct {
-	Loader         DataLoader
-	mutex          sync.RWMutex
-	called         *DataLoaderStatValue
-	returnEmptyKey *DataLoaderStatValue
-	returnNilData  *DataLoaderStatValue
-	returnData     *DataLoaderStatValue
+	Loader DataLoader
+	clock  Clock
+	mutex  sync.RWMutex
+	total  *dataLoaderStatValues
+	window time.Duration
+	slots  []*dataLoaderStatSlot
 }
 
 // NewDataLoaderStatWrapper allows you to wrap DataLoader for stat collection.
 func NewDataLoaderStatWrapper(loader DataLoader) *DataLoaderStatWrapper {
+	return NewDataLoaderStatWrapperWithClock(loader, SystemClock)
+}
+
+// NewDataLoaderStatWrapperWithClock allows you to wrap DataLoader for stat
+// collection using clock to time the calls.
+func NewDataLoaderStatWrapperWithClock(loader DataLoader, clock Clock) *DataLoaderStatWrapper {
 	w := &DataLoaderStatWrapper{
 		Loader: loader,
+		clock:  clock,
+		window: DefaultDataLoaderStatWindow,
 	}
 	w.Reset()
 	return w
@@ -79,43 +171,86 @@ func NewDataLoaderStatWrapper(loader DataLoader) *DataLoaderStatWrapper {
 
 // LoadData calls the origional loader and updates its stats.
 func (w *DataLoaderStatWrapper) LoadData(item *Item) (string, interface{}) {
-	t := time.Now()
+	t := w.clock.Now()
 	k, v := w.Loader.LoadData(item)
-	d := time.Now().Sub(t)
+	d := w.clock.Now().Sub(t)
 	w.mutex.Lock()
-	w.called.called(t, d)
-	if k == "" {
-		w.returnEmptyKey.called(t, d)
-	} else {
-		if v == nil {
-			w.returnNilData.called(t, d)
-		} else {
-			w.returnData.called(t, d)
-		}
-	}
+	w.total.record(t, d, k, v)
+	w.slot(t).values.record(t, d, k, v)
 	w.mutex.Unlock()
 	return k, v
 }
 
+// slotDuration is the length of time covered by a single window slot.
+func (w *DataLoaderStatWrapper) slotDuration() int64 {
+	d := int64(w.window) / int64(len(w.slots))
+	if d < 1 {
+		return 1
+	}
+	return d
+}
+
+// slot returns the window slot for t, clearing it out if it has expired.
+// The caller must hold the write lock.
+func (w *DataLoaderStatWrapper) slot(t time.Time) *dataLoaderStatSlot {
+	epoch := t.UnixNano() / w.slotDuration()
+	sl := w.slots[int(epoch%int64(len(w.slots)))]
+	if sl.epoch != epoch {
+		sl.epoch = epoch
+		sl.values = dataLoaderStatValues{}
+	}
+	return sl
+}
+
+// SetWindow changes the length of the rolling window and clears the current
+// window stats.
+func (w *DataLoaderStatWrapper) SetWindow(d time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.window = d
+	w.resetWindow()
+}
+
+func (w *DataLoaderStatWrapper) resetWindow() {
+	w.slots = make([]*dataLoaderStatSlot, dataLoaderStatWindowSlots)
+	for i := range w.slots {
+		w.slots[i] = &dataLoaderStatSlot{
+			epoch: -1,
+		}
+	}
+}
+
 // Reset clears current stats.
 func (w *DataLoaderStatWrapper) Reset() {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
-	w.called = &DataLoaderStatValue{}
-	w.returnEmptyKey = &DataLoaderStatValue{}
-	w.returnNilData = &DataLoaderStatValue{}
-	w.returnData = &DataLoaderStatValue{}
+	w.total = &dataLoaderStatValues{}
+	w.resetWindow()
 }
 
 // Stat returns information about the data loader.
 func (w *DataLoaderStatWrapper) Stat() *DataLoaderStat {
 	w.mutex.RLock()
 	defer w.mutex.RUnlock()
+	window := &dataLoaderStatValues{}
+	epoch := w.clock.Now().UnixNano() / w.slotDuration()
+	for _, sl := range w.slots {
+		if sl.epoch >= 0 && sl.epoch <= epoch && sl.epoch > epoch-int64(len(w.slots)) {
+			window.merge(&sl.values)
+		}
+	}
 	return &DataLoaderStat{
-		Called:         *w.called,
-		ReturnEmptyKey: *w.returnEmptyKey,
-		ReturnNilData:  *w.returnNilData,
-		ReturnData:     *w.returnData,
+		Called:         w.total.called.snapshot(),
+		ReturnEmptyKey: w.total.returnEmptyKey.snapshot(),
+		ReturnNilData:  w.total.returnNilData.snapshot(),
+		ReturnData:     w.total.returnData.snapshot(),
+		Window: &DataLoaderStatWindow{
+			Duration:       w.window,
+			Called:         window.called.snapshot(),
+			ReturnEmptyKey: window.returnEmptyKey.snapshot(),
+			ReturnNilData:  window.returnNilData.snapshot(),
+			ReturnData:     window.returnData.snapshot(),
+		},
 	}
 }
 
@@ -141,6 +276,18 @@ type DataLoaderStat struct {
 	ReturnEmptyKey DataLoaderStatValue `json:"returnEmptyKey"`
 	ReturnNilData  DataLoaderStatValue `json:"returnNilData"`
 	ReturnData     DataLoaderStatValue `json:"returnData"`
+	// Window only covers recent calls where the totals above cover
+	// all calls since the last reset.
+	Window *DataLoaderStatWindow `json:"window,omitempty"`
+}
+
+// DataLoaderStatWindow provides the stats for a rolling window of time.
+type DataLoaderStatWindow struct {
+	Duration       time.Duration       `json:"duration"`
+	Called         DataLoaderStatValue `json:"called"`
+	ReturnEmptyKey DataLoaderStatValue `json:"returnEmptyKey"`
+	ReturnNilData  DataLoaderStatValue `json:"returnNilData"`
+	ReturnData     DataLoaderStatValue `json:"returnData"`
 }
 
 // LoadData will load data for item concurrently for
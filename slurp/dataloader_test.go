@@ -86,3 +86,35 @@ func TestLoadData(t *testing.T) {
 		t.Errorf("Expecting l5 value to be \"b\", got %v.", v)
 	}
 }
+
+func TestDataLoaderStatWrapperWindow(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time {
+		return now
+	})
+	w := NewDataLoaderStatWrapperWithClock(&simpleDataLoader{k: "k", v: 1}, clock)
+	w.SetWindow(time.Minute)
+	for i := 0; i < 12; i++ {
+		w.LoadData(NewItem(now))
+		now = now.Add(10 * time.Second)
+	}
+	stat := w.Stat()
+	if stat.Called.Count != 12 {
+		t.Errorf("Expecting a total count of 12, got %d.", stat.Called.Count)
+	}
+	if stat.Window.Duration != time.Minute {
+		t.Errorf("Expecting a window of 1m, got %s.", stat.Window.Duration)
+	}
+	// We are now at the start of a new slot so only the 5 previous
+	// slots are in the window.
+	if stat.Window.Called.Count != 5 {
+		t.Errorf("Expecting a window count of 5, got %d.", stat.Window.Called.Count)
+	}
+	if stat.Window.ReturnData.Count != 5 {
+		t.Errorf("Expecting a window return data count of 5, got %d.", stat.Window.ReturnData.Count)
+	}
+	now = now.Add(time.Hour)
+	if c := w.Stat().Window.Called.Count; c != 0 {
+		t.Errorf("Expecting an empty window after an hour, got %d.", c)
+	}
+}
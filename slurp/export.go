@@ -0,0 +1,195 @@
+package slurp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Result export formats understood by ExportResults.
+const (
+	ExportCSV     = "csv"
+	ExportNDJSON  = "ndjson"
+	ExportParquet = "parquet"
+)
+
+// ExportContentType maps the export formats to their MIME types.
+var ExportContentType = map[string]string{
+	ExportCSV:     "text/csv; charset=utf-8",
+	ExportNDJSON:  "application/x-ndjson",
+	ExportParquet: "application/vnd.apache.parquet",
+}
+
+// exportPageSize is the number of results in each Parquet row group.
+const exportPageSize = 1000
+
+// exportColumns are the columns that come before the result data columns.
+var exportColumns = []string{"job", "analyst", "from", "until", "at"}
+
+// ExportResults writes all of the results for job from store to w in the
+// given format. Results are streamed from the store so that large jobs do
+// not need to fit in memory.
+//
+// CSV and Parquet exports flatten the result data so that nested maps become
+// columns named after the path to the value, i.e. "data.foo.bar".
+func ExportResults(w io.Writer, format string, store ResultStore, job string) error {
+	switch format {
+	case ExportCSV:
+		return exportCSV(w, store, job)
+	case ExportNDJSON:
+		return exportNDJSON(w, store, job)
+	case ExportParquet:
+		return exportParquet(w, store, job)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// eachResultPage calls f for each page of up to exportPageSize results for
+// job. The results are read from the store in a single pass.
+func eachResultPage(store ResultStore, job string, f func([]*AnalysisResult) error) error {
+	page := make([]*AnalysisResult, 0, exportPageSize)
+	err := store.Each(job, func(r *AnalysisResult) error {
+		page = append(page, r)
+		if len(page) < exportPageSize {
+			return nil
+		}
+		err := f(page)
+		page = page[:0]
+		return err
+	})
+	if err != nil || len(page) == 0 {
+		return err
+	}
+	return f(page)
+}
+
+func exportNDJSON(w io.Writer, store ResultStore, job string) error {
+	e := json.NewEncoder(w)
+	return store.Each(job, func(r *AnalysisResult) error {
+		return e.Encode(r)
+	})
+}
+
+// flattenResult returns the values of a result keyed by column name.
+func flattenResult(r *AnalysisResult) map[string]interface{} {
+	v := map[string]interface{}{
+		"job":     r.Job,
+		"analyst": r.Analyst,
+		"from":    r.From,
+		"until":   r.Until,
+		"at":      r.At,
+	}
+	flattenData("data", r.Data, v)
+	return v
+}
+
+func flattenData(prefix string, data map[string]interface{}, into map[string]interface{}) {
+	for k, v := range data {
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenData(prefix+"."+k, m, into)
+			continue
+		}
+		into[prefix+"."+k] = v
+	}
+}
+
+// resultDataColumns works out the sorted data columns for all results of job.
+func resultDataColumns(store ResultStore, job string) ([]string, map[string][]interface{}, error) {
+	seen := make(map[string][]interface{})
+	err := store.Each(job, func(r *AnalysisResult) error {
+		for k, v := range flattenResult(r) {
+			if _, ok := seen[k]; !ok {
+				seen[k] = make([]interface{}, 0, 1)
+			}
+			// Keep a sample of each type seen for the column.
+			if v != nil && !hasSameType(seen[k], v) {
+				seen[k] = append(seen[k], v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, 0, len(seen))
+	for k := range seen {
+		if !isExportColumn(k) {
+			columns = append(columns, k)
+		}
+	}
+	sort.Strings(columns)
+	return columns, seen, nil
+}
+
+func isExportColumn(k string) bool {
+	for _, c := range exportColumns {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSameType(values []interface{}, v interface{}) bool {
+	t := fmt.Sprintf("%T", v)
+	for _, s := range values {
+		if fmt.Sprintf("%T", s) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// formatExportValue formats a flattened value as text.
+func formatExportValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return fmt.Sprint(t)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func exportCSV(w io.Writer, store ResultStore, job string) error {
+	columns, _, err := resultDataColumns(store, job)
+	if err != nil {
+		return err
+	}
+	columns = append(append([]string{}, exportColumns...), columns...)
+	c := csv.NewWriter(w)
+	if err = c.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	err = store.Each(job, func(r *AnalysisResult) error {
+		v := flattenResult(r)
+		for i, k := range columns {
+			record[i] = formatExportValue(v[k])
+		}
+		return c.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	c.Flush()
+	return c.Error()
+}
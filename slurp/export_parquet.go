@@ -0,0 +1,451 @@
+package slurp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// This is a minimal Parquet writer. It only writes uncompressed, PLAIN
+// encoded, flat schemas, which is all that is needed to export results.
+
+// Parquet physical types.
+const (
+	parquetBoolean   int32 = 0
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Parquet converted types.
+const (
+	parquetNoConvertedType int32 = -1
+	parquetUTF8            int32 = 0
+	parquetTimestampMicros int32 = 10
+)
+
+// Parquet encodings.
+const (
+	parquetPlain int32 = 0
+	parquetRLE   int32 = 3
+)
+
+// Thrift compact protocol types.
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter writes Thrift structs using the compact protocol.
+type thriftWriter struct {
+	bytes.Buffer
+	lastID []int16
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := t.lastID[len(t.lastID)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.lastID[len(t.lastID)-1] = id
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.lastID = append(t.lastID, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.WriteByte(0)
+	t.lastID = t.lastID[:len(t.lastID)-1]
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.uvarint(uint64(len(v)))
+	t.WriteString(v)
+}
+
+func (t *thriftWriter) structField(id int16, f func()) {
+	t.field(id, thriftStruct)
+	t.beginStruct()
+	f()
+	t.endStruct()
+}
+
+func (t *thriftWriter) list(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		t.WriteByte(0xf0 | elemType)
+		t.uvarint(uint64(n))
+	}
+}
+
+// parquetColumn describes a column of a flat schema.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32
+	optional  bool
+}
+
+// parquetColumnChunk records where a column chunk was written.
+type parquetColumnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// parquetWriter writes row groups and then the file footer.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []parquetColumn
+	numRows   int64
+	rowGroups [][]parquetColumnChunk
+	rowSizes  []int64
+	rowCounts []int64
+}
+
+func newParquetWriter(w io.Writer, columns []parquetColumn) (*parquetWriter, error) {
+	p := &parquetWriter{
+		w:       w,
+		columns: columns,
+	}
+	return p, p.write([]byte("PAR1"))
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// writeRowGroup writes a row group. values holds the values for each column.
+func (p *parquetWriter) writeRowGroup(values [][]interface{}) error {
+	var (
+		rows   int64
+		size   int64
+		chunks = make([]parquetColumnChunk, len(p.columns))
+	)
+	for i, c := range p.columns {
+		rows = int64(len(values[i]))
+		page := parquetPage(c, values[i])
+		h := &thriftWriter{}
+		h.beginStruct()
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(page)))
+		h.i32(3, int32(len(page)))
+		h.structField(5, func() {
+			h.i32(1, int32(len(values[i])))
+			h.i32(2, parquetPlain)
+			h.i32(3, parquetRLE)
+			h.i32(4, parquetRLE)
+		})
+		h.endStruct()
+		chunks[i] = parquetColumnChunk{
+			offset:    p.offset,
+			size:      int64(h.Len() + len(page)),
+			numValues: rows,
+		}
+		size += chunks[i].size
+		if err := p.write(h.Bytes()); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+	}
+	p.numRows += rows
+	p.rowGroups = append(p.rowGroups, chunks)
+	p.rowSizes = append(p.rowSizes, size)
+	p.rowCounts = append(p.rowCounts, rows)
+	return nil
+}
+
+// parquetPage builds the body of a data page.
+func parquetPage(c parquetColumn, values []interface{}) []byte {
+	var b bytes.Buffer
+	if c.optional {
+		levels := parquetDefinitionLevels(values)
+		binary.Write(&b, binary.LittleEndian, int32(len(levels)))
+		b.Write(levels)
+	}
+	var (
+		bits  byte
+		nbits uint
+	)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		switch c.typ {
+		case parquetBoolean:
+			if v.(bool) {
+				bits |= 1 << nbits
+			}
+			nbits++
+			if nbits == 8 {
+				b.WriteByte(bits)
+				bits, nbits = 0, 0
+			}
+		case parquetInt64:
+			binary.Write(&b, binary.LittleEndian, v.(int64))
+		case parquetDouble:
+			binary.Write(&b, binary.LittleEndian, math.Float64bits(v.(float64)))
+		case parquetByteArray:
+			s := v.(string)
+			binary.Write(&b, binary.LittleEndian, int32(len(s)))
+			b.WriteString(s)
+		}
+	}
+	if nbits > 0 {
+		b.WriteByte(bits)
+	}
+	return b.Bytes()
+}
+
+// parquetDefinitionLevels encodes 1 bit definition levels as RLE runs.
+func parquetDefinitionLevels(values []interface{}) []byte {
+	var b bytes.Buffer
+	var buf [binary.MaxVarintLen64]byte
+	for i := 0; i < len(values); {
+		defined := values[i] != nil
+		j := i + 1
+		for j < len(values) && (values[j] != nil) == defined {
+			j++
+		}
+		b.Write(buf[:binary.PutUvarint(buf[:], uint64(j-i)<<1)])
+		if defined {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+		i = j
+	}
+	return b.Bytes()
+}
+
+// close writes the file footer.
+func (p *parquetWriter) close() error {
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(p.columns)+1)
+	t.beginStruct()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.endStruct()
+	for _, c := range p.columns {
+		t.beginStruct()
+		t.i32(1, c.typ)
+		if c.optional {
+			t.i32(3, 1)
+		} else {
+			t.i32(3, 0)
+		}
+		t.binary(4, c.name)
+		if c.converted != parquetNoConvertedType {
+			t.i32(6, c.converted)
+		}
+		t.endStruct()
+	}
+	t.i64(3, p.numRows)
+	t.list(4, thriftStruct, len(p.rowGroups))
+	for g, chunks := range p.rowGroups {
+		t.beginStruct()
+		t.list(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			c := p.columns[i]
+			t.beginStruct()
+			t.i64(2, chunk.offset)
+			t.structField(3, func() {
+				t.i32(1, c.typ)
+				t.list(2, thriftI32, 2)
+				t.varint(int64(parquetPlain))
+				t.varint(int64(parquetRLE))
+				t.list(3, thriftBinary, 1)
+				t.uvarint(uint64(len(c.name)))
+				t.WriteString(c.name)
+				t.i32(4, 0) // UNCOMPRESSED
+				t.i64(5, chunk.numValues)
+				t.i64(6, chunk.size)
+				t.i64(7, chunk.size)
+				t.i64(9, chunk.offset)
+			})
+			t.endStruct()
+		}
+		t.i64(2, p.rowSizes[g])
+		t.i64(3, p.rowCounts[g])
+		t.endStruct()
+	}
+	t.binary(6, "go-slurp")
+	t.endStruct()
+	if err := p.write(t.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(p.w, binary.LittleEndian, int32(t.Len())); err != nil {
+		return err
+	}
+	return p.write([]byte("PAR1"))
+}
+
+// parquetColumnFor works out the column type from the sample values seen.
+// Numbers become doubles, booleans stay as booleans and anything else, or
+// a mix of types, is written as text.
+func parquetColumnFor(name string, samples []interface{}) parquetColumn {
+	c := parquetColumn{
+		name:      name,
+		typ:       parquetByteArray,
+		converted: parquetUTF8,
+		optional:  true,
+	}
+	if len(samples) == 0 {
+		return c
+	}
+	numbers, bools := true, true
+	for _, v := range samples {
+		if _, ok := parquetNumber(v); !ok {
+			numbers = false
+		}
+		if _, ok := v.(bool); !ok {
+			bools = false
+		}
+	}
+	switch {
+	case numbers:
+		c.typ, c.converted = parquetDouble, parquetNoConvertedType
+	case bools:
+		c.typ, c.converted = parquetBoolean, parquetNoConvertedType
+	}
+	return c
+}
+
+func parquetNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int8:
+		return float64(t), true
+	case int16:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint8:
+		return float64(t), true
+	case uint16:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// parquetValue converts a flattened value to the type needed for c. A value
+// of another type, such as one written to a running job after the column
+// types were worked out, becomes null.
+func parquetValue(c parquetColumn, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch c.typ {
+	case parquetInt64:
+		if t, ok := v.(time.Time); ok {
+			return t.UnixNano() / int64(time.Microsecond)
+		}
+		return nil
+	case parquetDouble:
+		if f, ok := parquetNumber(v); ok {
+			return f
+		}
+		return nil
+	case parquetBoolean:
+		if b, ok := v.(bool); ok {
+			return b
+		}
+		return nil
+	}
+	return formatExportValue(v)
+}
+
+func exportParquet(w io.Writer, store ResultStore, job string) error {
+	dataColumns, samples, err := resultDataColumns(store, job)
+	if err != nil {
+		return err
+	}
+	columns := []parquetColumn{
+		{name: "job", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "analyst", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "from", typ: parquetInt64, converted: parquetTimestampMicros},
+		{name: "until", typ: parquetInt64, converted: parquetTimestampMicros},
+		{name: "at", typ: parquetInt64, converted: parquetTimestampMicros},
+	}
+	for _, k := range dataColumns {
+		columns = append(columns, parquetColumnFor(k, samples[k]))
+	}
+	p, err := newParquetWriter(w, columns)
+	if err != nil {
+		return err
+	}
+	// Each page of results becomes a row group.
+	err = eachResultPage(store, job, func(results []*AnalysisResult) error {
+		values := make([][]interface{}, len(columns))
+		for i := range values {
+			values[i] = make([]interface{}, len(results))
+		}
+		for j, r := range results {
+			v := flattenResult(r)
+			for i, c := range columns {
+				values[i][j] = parquetValue(c, v[c.name])
+			}
+		}
+		return p.writeRowGroup(values)
+	})
+	if err != nil {
+		return err
+	}
+	return p.close()
+}
@@ -0,0 +1,262 @@
+package slurp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func exportTestStore() ResultStore {
+	at := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryResultStore()
+	s.WriteResult(&AnalysisResult{
+		Job:     "j",
+		Analyst: "a",
+		From:    at,
+		Until:   at.Add(time.Hour),
+		At:      at,
+		Data: map[string]interface{}{
+			"count": 1,
+			"nested": map[string]interface{}{
+				"name": "one, two",
+			},
+		},
+	})
+	s.WriteResult(&AnalysisResult{
+		Job:     "j",
+		Analyst: "a",
+		From:    at,
+		Until:   at.Add(time.Hour),
+		At:      at.Add(time.Minute),
+		Data: map[string]interface{}{
+			"count": 2.5,
+			"list":  []int{1, 2},
+		},
+	})
+	s.WriteResult(&AnalysisResult{
+		Job: "other",
+	})
+	return s
+}
+
+func TestExportCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := ExportResults(&b, ExportCSV, exportTestStore(), "j"); err != nil {
+		t.Fatal(err)
+	}
+	want := `job,analyst,from,until,at,data.count,data.list,data.nested.name
+j,a,2015-01-01T00:00:00Z,2015-01-01T01:00:00Z,2015-01-01T00:00:00Z,1,,"one, two"
+j,a,2015-01-01T00:00:00Z,2015-01-01T01:00:00Z,2015-01-01T00:01:00Z,2.5,"[1,2]",
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected CSV.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := ExportResults(&b, ExportNDJSON, exportTestStore(), "j"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"job":"j","analyst":"a","from":"2015-01-01T00:00:00Z","until":"2015-01-01T01:00:00Z","at":"2015-01-01T00:00:00Z","data":{"count":1,"nested":{"name":"one, two"}}}
+{"job":"j","analyst":"a","from":"2015-01-01T00:00:00Z","until":"2015-01-01T01:00:00Z","at":"2015-01-01T00:01:00Z","data":{"count":2.5,"list":[1,2]}}
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected NDJSON.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	var b bytes.Buffer
+	if err := ExportResults(&b, ExportParquet, exportTestStore(), "j"); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatal("Expecting the Parquet magic number at the start and end of the file.")
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		t.Fatalf("Unexpected footer length %d.", footer)
+	}
+	if !bytes.Contains(data[len(data)-8-footer:], []byte("data.nested.name")) {
+		t.Error("Expecting the footer to contain the flattened column names.")
+	}
+	col := parquetColumnFor("x", []interface{}{1, 2.5})
+	if col.typ != parquetDouble {
+		t.Errorf("Expecting numbers to be written as doubles, got type %d.", col.typ)
+	}
+	col = parquetColumnFor("x", []interface{}{1, "a"})
+	if col.typ != parquetByteArray {
+		t.Errorf("Expecting mixed values to be written as text, got type %d.", col.typ)
+	}
+}
+
+// thriftReader reads Thrift compact protocol structs in to maps keyed by
+// field id, which is enough to check what the Parquet writer wrote.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.b[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.b[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			l[i] = r.value(h & 0x0f)
+		}
+		return l
+	case thriftStruct:
+		return r.structure()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	m := make(map[int16]interface{})
+	var last int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return m
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.varint())
+		}
+		m[id] = r.value(h & 0x0f)
+		last = id
+	}
+}
+
+// parquetColumnPage finds the column called name in the file metadata and
+// returns the schema element of the column along with the header and body
+// of the data page in its first column chunk.
+func parquetColumnPage(t *testing.T, data []byte, meta map[int16]interface{}, name string) (map[int16]interface{}, map[int16]interface{}, []byte) {
+	schema := meta[2].([]interface{})
+	for i, v := range schema[1:] {
+		el := v.(map[int16]interface{})
+		if el[4] != name {
+			continue
+		}
+		groups := meta[4].([]interface{})
+		chunk := groups[0].(map[int16]interface{})[1].([]interface{})[i].(map[int16]interface{})
+		cmeta := chunk[3].(map[int16]interface{})
+		if path := cmeta[3].([]interface{}); len(path) != 1 || path[0] != name {
+			t.Fatalf("Expecting the column chunk for %s, got %v.", name, path)
+		}
+		r := &thriftReader{b: data, pos: int(cmeta[9].(int64))}
+		header := r.structure()
+		size := int(header[3].(int64))
+		return el, header, data[r.pos : r.pos+size]
+	}
+	t.Fatalf("Expecting a column called %s.", name)
+	return nil, nil, nil
+}
+
+func TestExportParquetRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	if err := ExportResults(&b, ExportParquet, exportTestStore(), "j"); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{b: data[len(data)-8-footer : len(data)-8]}).structure()
+	if meta[1] != int64(1) || meta[3] != int64(2) {
+		t.Errorf("Expecting version 1 with 2 rows, got %v and %v.", meta[1], meta[3])
+	}
+	if n := len(meta[2].([]interface{})); n != 9 {
+		t.Errorf("Expecting a root and 8 columns in the schema, got %d elements.", n)
+	}
+
+	el, header, body := parquetColumnPage(t, data, meta, "job")
+	if el[1] != int64(parquetByteArray) || el[3] != int64(0) || el[6] != int64(parquetUTF8) {
+		t.Errorf("Expecting job to be required UTF8 text, got %v.", el)
+	}
+	if header[1] != int64(0) || header[5].(map[int16]interface{})[1] != int64(2) {
+		t.Errorf("Expecting a data page with 2 values, got %v.", header)
+	}
+	if want := "\x01\x00\x00\x00j\x01\x00\x00\x00j"; string(body) != want {
+		t.Errorf("Expecting two plain encoded values of j, got %q.", body)
+	}
+
+	el, _, body = parquetColumnPage(t, data, meta, "data.count")
+	if el[1] != int64(parquetDouble) || el[3] != int64(1) {
+		t.Errorf("Expecting data.count to be an optional double, got %v.", el)
+	}
+	n := int(binary.LittleEndian.Uint32(body))
+	if levels := body[4 : 4+n]; !bytes.Equal(levels, []byte{2 << 1, 1}) {
+		t.Errorf("Expecting a run of 2 defined values, got %v.", levels)
+	}
+	var got []float64
+	for v := body[4+n:]; len(v) >= 8; v = v[8:] {
+		got = append(got, math.Float64frombits(binary.LittleEndian.Uint64(v)))
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2.5 {
+		t.Errorf("Expecting the values 1 and 2.5, got %v.", got)
+	}
+
+	_, _, body = parquetColumnPage(t, data, meta, "data.list")
+	n = int(binary.LittleEndian.Uint32(body))
+	if levels := body[4 : 4+n]; !bytes.Equal(levels, []byte{1 << 1, 0, 1 << 1, 1}) {
+		t.Errorf("Expecting a null followed by a defined value, got %v.", levels)
+	}
+}
+
+func TestParquetValueMismatch(t *testing.T) {
+	for _, c := range []parquetColumn{
+		{typ: parquetBoolean, optional: true},
+		{typ: parquetDouble, optional: true},
+	} {
+		if v := parquetValue(c, "yes"); v != nil {
+			t.Errorf("Expecting a value of the wrong type to be null, got %v.", v)
+		}
+	}
+	if v := parquetValue(parquetColumn{typ: parquetBoolean}, true); v != true {
+		t.Errorf("Expecting true, got %v.", v)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if err := ExportResults(&bytes.Buffer{}, "xml", exportTestStore(), "j"); err == nil {
+		t.Error("Expecting an error for an unknown format.")
+	}
+}
@@ -0,0 +1,133 @@
+package slurp
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// durationHistogramSubBuckets is the number of linear sub buckets used for
+// each power of two. Recorded values are accurate to within 1/8 (12.5%).
+const durationHistogramSubBuckets = 8
+
+// durationHistogram counts durations in log-linear buckets. Each power of two
+// is split into a number of linear sub buckets, as with an HDR histogram.
+type durationHistogram struct {
+	counts []int64
+	total  int64
+	min    time.Duration
+	max    time.Duration
+}
+
+func durationHistogramIndex(d time.Duration) int {
+	if d < durationHistogramSubBuckets {
+		if d < 0 {
+			return 0
+		}
+		return int(d)
+	}
+	v := uint64(d)
+	exp := bits.Len64(v) - 1
+	shift := uint(exp - 3)
+	return (exp-2)*durationHistogramSubBuckets + int((v>>shift)&(durationHistogramSubBuckets-1))
+}
+
+// durationHistogramUpper returns the highest duration that is counted in
+// the bucket at index i.
+func durationHistogramUpper(i int) time.Duration {
+	if i < durationHistogramSubBuckets {
+		return time.Duration(i)
+	}
+	exp := uint(i/durationHistogramSubBuckets + 2)
+	sub := uint64(i % durationHistogramSubBuckets)
+	width := uint64(1) << (exp - 3)
+	upper := (durationHistogramSubBuckets+sub)*width + width - 1
+	if upper > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(upper)
+}
+
+func (h *durationHistogram) record(d time.Duration) {
+	i := durationHistogramIndex(d)
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if h.total == 0 || d > h.max {
+		h.max = d
+	}
+	h.total++
+}
+
+func (h *durationHistogram) merge(o *durationHistogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		counts := make([]int64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if h.total == 0 || o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+}
+
+// percentile returns the duration at or below which q (0 to 1) of the
+// recorded durations fall.
+func (h *durationHistogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen < rank {
+			continue
+		}
+		d := durationHistogramUpper(i)
+		if d > h.max {
+			d = h.max
+		}
+		if d < h.min {
+			d = h.min
+		}
+		return d
+	}
+	return h.max
+}
+
+// DurationPercentile provides commonly used percentiles of a set of
+// durations.
+type DurationPercentile struct {
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+}
+
+func (h *durationHistogram) durationPercentile() DurationPercentile {
+	return DurationPercentile{
+		P50:  h.percentile(0.5),
+		P90:  h.percentile(0.9),
+		P99:  h.percentile(0.99),
+		P999: h.percentile(0.999),
+	}
+}
@@ -0,0 +1,50 @@
+package slurp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationHistogramIndex(t *testing.T) {
+	for i := 0; i < 400; i++ {
+		upper := durationHistogramUpper(i)
+		if got := durationHistogramIndex(upper); got != i {
+			t.Errorf("Expecting the upper bound of bucket %d (%d) to be in bucket %d, got %d.", i, upper, i, got)
+		}
+		if got := durationHistogramIndex(upper + 1); got != i+1 {
+			t.Errorf("Expecting %d to be in bucket %d, got %d.", upper+1, i+1, got)
+		}
+	}
+}
+
+func TestDurationHistogramPercentile(t *testing.T) {
+	h := &durationHistogram{}
+	if p := h.percentile(0.5); p != 0 {
+		t.Errorf("Expecting an empty histogram to have a p50 of 0, got %s.", p)
+	}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	p := h.durationPercentile()
+	check := func(name string, got time.Duration, want time.Duration) {
+		// Buckets are accurate to within 1/8.
+		if got < want || got > want+want/8 {
+			t.Errorf("Expecting %s to be about %s, got %s.", name, want, got)
+		}
+	}
+	check("p50", p.P50, 500*time.Millisecond)
+	check("p90", p.P90, 900*time.Millisecond)
+	check("p99", p.P99, 990*time.Millisecond)
+	if p.P999 != time.Second {
+		t.Errorf("Expecting p999 to be capped at the max of 1s, got %s.", p.P999)
+	}
+	o := &durationHistogram{}
+	o.record(time.Nanosecond)
+	h.merge(o)
+	if h.total != 1001 {
+		t.Errorf("Expecting a total of 1001 after merge, got %d.", h.total)
+	}
+	if p := h.percentile(0); p != time.Nanosecond {
+		t.Errorf("Expecting the lowest value to be 1ns after merge, got %s.", p)
+	}
+}
@@ -0,0 +1,245 @@
+package slurp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Parameter types.
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamFloat    = "float"
+	ParamBool     = "bool"
+	ParamDuration = "duration"
+	ParamTime     = "time"
+)
+
+// ParamSpec describes a parameter. Default is given in the same form as the
+// parameter would be in JSON, so "1m" for a duration and RFC 3339 for a time.
+type ParamSpec struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Description string      `json:"description"`
+}
+
+// ParamSchema describes the parameters taken by something.
+type ParamSchema []ParamSpec
+
+// Params is a set of named parameters. Once checked by a ParamSchema the
+// values have the Go type of the parameter: string, int, float64, bool,
+// time.Duration or time.Time.
+type Params map[string]interface{}
+
+// ParamError is a problem with a parameter.
+type ParamError struct {
+	Param   string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("parameter %q: %s", e.Param, e.Message)
+}
+
+// ParamErrors lists the problems with a set of parameters.
+type ParamErrors []*ParamError
+
+func (e ParamErrors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Check makes sure that the schema is usable, that names are unique, types
+// are known and defaults are valid.
+func (s ParamSchema) Check() error {
+	seen := make(map[string]bool)
+	for _, v := range s {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("missing or duplicate parameter name %q", v.Name)
+		}
+		seen[v.Name] = true
+		if _, err := convertParam(v.Type, nil); err == errUnknownParamType {
+			return fmt.Errorf("parameter %q has unknown type %q", v.Name, v.Type)
+		}
+		if v.Default != nil {
+			if _, err := convertParam(v.Type, v.Default); err != nil {
+				return fmt.Errorf("parameter %q has an invalid default: %s", v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks p against the schema. It returns the parameters converted
+// to their Go types with defaults filled in, or ParamErrors listing every
+// problem found.
+func (s ParamSchema) Validate(p Params) (Params, error) {
+	var errs ParamErrors
+	r := make(Params, len(s))
+	known := make(map[string]bool, len(s))
+	for _, v := range s {
+		known[v.Name] = true
+		raw, ok := p[v.Name]
+		if !ok || raw == nil {
+			if v.Required {
+				errs = append(errs, &ParamError{Param: v.Name, Message: ParamRequired})
+				continue
+			}
+			if v.Default == nil {
+				continue
+			}
+			raw = v.Default
+		}
+		c, err := convertParam(v.Type, raw)
+		if err != nil {
+			errs = append(errs, &ParamError{Param: v.Name, Message: err.Error()})
+			continue
+		}
+		r[v.Name] = c
+	}
+	unknown := make([]string, 0)
+	for k := range p {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, &ParamError{Param: k, Message: ParamUnknown})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return r, nil
+}
+
+// Messages given in a ParamError for missing and unknown parameters.
+const (
+	ParamRequired = "is required"
+	ParamUnknown  = "is not a known parameter"
+)
+
+var errUnknownParamType = errors.New("unknown parameter type")
+
+// convertParam converts a JSON value to the Go type of a parameter. A nil
+// value only checks the type.
+func convertParam(typ string, v interface{}) (interface{}, error) {
+	switch typ {
+	case ParamString, ParamInt, ParamFloat, ParamBool, ParamDuration, ParamTime:
+	default:
+		return nil, errUnknownParamType
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch typ {
+	case ParamString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("expecting a string")
+	case ParamInt:
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) <= 1<<53 {
+				return int(n), nil
+			}
+		}
+		return nil, fmt.Errorf("expecting an integer")
+	case ParamFloat:
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+		return nil, fmt.Errorf("expecting a number")
+	case ParamBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("expecting true or false")
+	case ParamDuration:
+		switch d := v.(type) {
+		case time.Duration:
+			return d, nil
+		case string:
+			if r, err := time.ParseDuration(d); err == nil {
+				return r, nil
+			}
+		}
+		return nil, fmt.Errorf("expecting a duration such as \"1m30s\"")
+	default:
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			if r, err := time.Parse(time.RFC3339, t); err == nil {
+				return r, nil
+			}
+		}
+		return nil, fmt.Errorf("expecting an RFC 3339 time")
+	}
+}
+
+// MarshalJSON writes durations in the form used for parameters, such as
+// "1m30s", so that params can be read back in.
+func (p Params) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p))
+	for k, v := range p {
+		if d, ok := v.(time.Duration); ok {
+			m[k] = d.String()
+		} else {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// String returns the string parameter k.
+func (p Params) String(k string) string {
+	v, _ := p[k].(string)
+	return v
+}
+
+// Int returns the int parameter k.
+func (p Params) Int(k string) int {
+	v, _ := p[k].(int)
+	return v
+}
+
+// Float returns the float parameter k.
+func (p Params) Float(k string) float64 {
+	v, _ := p[k].(float64)
+	return v
+}
+
+// Bool returns the bool parameter k.
+func (p Params) Bool(k string) bool {
+	v, _ := p[k].(bool)
+	return v
+}
+
+// Duration returns the duration parameter k.
+func (p Params) Duration(k string) time.Duration {
+	v, _ := p[k].(time.Duration)
+	return v
+}
+
+// Time returns the time parameter k.
+func (p Params) Time(k string) time.Time {
+	v, _ := p[k].(time.Time)
+	return v
+}
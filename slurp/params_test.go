@@ -0,0 +1,74 @@
+package slurp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParamSchemaValidate(t *testing.T) {
+	s := ParamSchema{
+		{Name: "name", Type: ParamString, Required: true},
+		{Name: "count", Type: ParamInt, Default: 10},
+		{Name: "ratio", Type: ParamFloat},
+		{Name: "enabled", Type: ParamBool, Default: true},
+		{Name: "window", Type: ParamDuration, Default: "1m"},
+		{Name: "since", Type: ParamTime},
+	}
+	if err := s.Check(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Validate(Params{
+		"name":  "x",
+		"count": float64(3),
+		"ratio": float64(2),
+		"since": "2015-06-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String("name") != "x" || p.Int("count") != 3 || p.Float("ratio") != 2 || !p.Bool("enabled") {
+		t.Errorf("Unexpected params %v.", p)
+	}
+	if p.Duration("window") != time.Minute {
+		t.Errorf("Expecting default window of 1m, got %s.", p.Duration("window"))
+	}
+	if !p.Time("since").Equal(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected since %s.", p.Time("since"))
+	}
+
+	_, err = s.Validate(Params{"count": 1.5, "window": "soon", "other": 1})
+	want := ParamErrors{
+		{Param: "name", Message: "is required"},
+		{Param: "count", Message: "expecting an integer"},
+		{Param: "window", Message: "expecting a duration such as \"1m30s\""},
+		{Param: "other", Message: "is not a known parameter"},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Expecting %v, got %v.", want, err)
+	}
+}
+
+func TestParamSchemaCheck(t *testing.T) {
+	for _, s := range []ParamSchema{
+		{{Name: "", Type: ParamString}},
+		{{Name: "a", Type: ParamString}, {Name: "a", Type: ParamInt}},
+		{{Name: "a", Type: "number"}},
+		{{Name: "a", Type: ParamDuration, Default: 5}},
+	} {
+		if err := s.Check(); err == nil {
+			t.Errorf("Expecting schema %v to be invalid.", s)
+		}
+	}
+}
+
+func TestParamsMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Params{"window": time.Minute, "count": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"count":3,"window":"1m0s"}`; got != want {
+		t.Errorf("Expecting %s, got %s.", want, got)
+	}
+}
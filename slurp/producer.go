@@ -1,6 +1,9 @@
 package slurp
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Producer is the thing that generates production runs of items.
 type Producer interface {
@@ -16,6 +19,13 @@ type ProductionRun interface {
 	SendItems(chan<- *Item)
 }
 
+// ContextProductionRun is a ProductionRun that can stop early. Sending
+// should stop once ctx is done.
+type ContextProductionRun interface {
+	ProductionRun
+	SendItemsContext(ctx context.Context, ch chan<- *Item)
+}
+
 // ProductionRunFunc is an adapter that allow you to use
 // an ordinary function as an ProductionRun.
 type ProductionRunFunc func(chan<- *Item)
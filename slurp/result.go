@@ -0,0 +1,104 @@
+package slurp
+
+import (
+	"sync"
+	"time"
+)
+
+// AnalysisResult is a structured record produced by an analyst.
+type AnalysisResult struct {
+	Job     string                 `json:"job,omitempty"`
+	Analyst string                 `json:"analyst,omitempty"`
+	From    time.Time              `json:"from"`
+	Until   time.Time              `json:"until"`
+	At      time.Time              `json:"at"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// ResultSink is somewhere to put analysis results.
+type ResultSink interface {
+	WriteResult(*AnalysisResult) error
+}
+
+// ResultSinkFunc is an adapter that allow you to use
+// an ordinary function as a ResultSink.
+type ResultSinkFunc func(*AnalysisResult) error
+
+// WriteResult calls f(result)
+func (f ResultSinkFunc) WriteResult(result *AnalysisResult) error {
+	return f(result)
+}
+
+// ResultStore is a ResultSink that is also able to read back the results
+// for a job.
+type ResultStore interface {
+	ResultSink
+	// Results returns up to limit results for job, skipping the first
+	// offset results. Results are returned in the order they were written.
+	Results(job string, offset int, limit int) ([]*AnalysisResult, error)
+	// Each calls f for each result for job in the order they were written,
+	// stopping at the first error from f, which is returned.
+	Each(job string, f func(*AnalysisResult) error) error
+}
+
+// ResultFlusher is implemented by a ResultSink that buffers results.
+type ResultFlusher interface {
+	Flush() error
+}
+
+// MemoryResultStore is a ResultStore that keeps results in memory.
+type MemoryResultStore struct {
+	mutex   sync.RWMutex
+	results map[string][]*AnalysisResult
+}
+
+// NewMemoryResultStore returns a pointer to a new MemoryResultStore.
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{
+		results: make(map[string][]*AnalysisResult),
+	}
+}
+
+// WriteResult ensures that this implements the ResultSink interface.
+func (m *MemoryResultStore) WriteResult(result *AnalysisResult) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.results[result.Job] = append(m.results[result.Job], result)
+	return nil
+}
+
+// Results ensures that this implements the ResultStore interface.
+func (m *MemoryResultStore) Results(job string, offset int, limit int) ([]*AnalysisResult, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return pageResults(m.results[job], offset, limit), nil
+}
+
+// Each ensures that this implements the ResultStore interface.
+func (m *MemoryResultStore) Each(job string, f func(*AnalysisResult) error) error {
+	m.mutex.RLock()
+	results := m.results[job]
+	m.mutex.RUnlock()
+	for _, r := range results {
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pageResults(results []*AnalysisResult, offset int, limit int) []*AnalysisResult {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(results) {
+		offset = len(results)
+	}
+	end := len(results)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	r := make([]*AnalysisResult, end-offset)
+	copy(r, results[offset:end])
+	return r
+}
@@ -0,0 +1,144 @@
+package slurp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// NDJSONResultStore is a ResultStore that appends results to a file as
+// newline delimited JSON.
+type NDJSONResultStore struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewNDJSONResultStore opens, or creates, the file at path and returns a
+// pointer to a new NDJSONResultStore that writes to it.
+func NewNDJSONResultStore(path string) (*NDJSONResultStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONResultStore{
+		file:   f,
+		writer: bufio.NewWriter(f),
+	}, nil
+}
+
+// WriteResult ensures that this implements the ResultSink interface.
+func (s *NDJSONResultStore) WriteResult(result *AnalysisResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err = s.writer.Write(data); err != nil {
+		return err
+	}
+	return s.writer.WriteByte('\n')
+}
+
+// Flush ensures that all results have been written to the file.
+func (s *NDJSONResultStore) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.writer.Flush()
+}
+
+// Close flushes and closes the file.
+func (s *NDJSONResultStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.writer.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// Results ensures that this implements the ResultStore interface. The whole
+// file is read so this is best suited to modest numbers of results. Results
+// are read from a separate handle so that writes are not held up while they
+// are.
+func (s *NDJSONResultStore) Results(job string, offset int, limit int) ([]*AnalysisResult, error) {
+	f, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		results = make([]*AnalysisResult, 0)
+		skipped int
+	)
+	err = readResults(f, func(r *AnalysisResult) bool {
+		if limit >= 0 && len(results) >= limit {
+			return false
+		}
+		if r.Job != job {
+			return true
+		}
+		if skipped < offset {
+			skipped++
+			return true
+		}
+		results = append(results, r)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Each ensures that this implements the ResultStore interface. The file is
+// read once, from a separate handle, so writes are not held up while it is.
+func (s *NDJSONResultStore) Each(job string, f func(*AnalysisResult) error) error {
+	file, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var ferr error
+	err = readResults(file, func(r *AnalysisResult) bool {
+		if r.Job != job {
+			return true
+		}
+		ferr = f(r)
+		return ferr == nil
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// open flushes any buffered results and opens the file for reading.
+func (s *NDJSONResultStore) open() (*os.File, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return os.Open(s.file.Name())
+}
+
+// readResults calls f for each result read from r until f returns false.
+// Lines that can not be read, such as one cut short by a crash or still being
+// written, are skipped.
+func readResults(r io.Reader, f func(result *AnalysisResult) bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		result := &AnalysisResult{}
+		if err := json.Unmarshal(sc.Bytes(), result); err != nil {
+			continue
+		}
+		if !f(result) {
+			break
+		}
+	}
+	return sc.Err()
+}
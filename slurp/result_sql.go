@@ -0,0 +1,147 @@
+package slurp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SQLResultStore is a ResultStore that inserts results in to a SQL table.
+//
+// The table is expected to have the following columns, the data column
+// holds the result data as JSON. The id column is used to keep the results
+// in the order they were written.
+//
+//	id INTEGER PRIMARY KEY (auto incrementing)
+//	job VARCHAR
+//	analyst VARCHAR
+//	time_from TIMESTAMP
+//	time_until TIMESTAMP
+//	time_at TIMESTAMP
+//	data TEXT
+type SQLResultStore struct {
+	db    *sql.DB
+	table string
+	// Placeholder returns the bind parameter for the nth (starting at 1)
+	// argument of a statement. Defaults to "?", set it to return "$n" for
+	// drivers such as PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// NewSQLResultStore returns a pointer to a new SQLResultStore that uses
+// table in db.
+func NewSQLResultStore(db *sql.DB, table string) *SQLResultStore {
+	return &SQLResultStore{
+		db:    db,
+		table: table,
+		Placeholder: func(int) string {
+			return "?"
+		},
+	}
+}
+
+func (s *SQLResultStore) placeholders(n int) []string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = s.Placeholder(i + 1)
+	}
+	return p
+}
+
+// WriteResult ensures that this implements the ResultSink interface.
+func (s *SQLResultStore) WriteResult(result *AnalysisResult) error {
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO %s (job, analyst, time_from, time_until, time_at, data) VALUES (%s)",
+			s.table,
+			strings.Join(s.placeholders(6), ", "),
+		),
+		result.Job,
+		result.Analyst,
+		result.From,
+		result.Until,
+		result.At,
+		string(data),
+	)
+	return err
+}
+
+// Results ensures that this implements the ResultStore interface.
+func (s *SQLResultStore) Results(job string, offset int, limit int) ([]*AnalysisResult, error) {
+	if limit < 0 {
+		// Not all databases support an OFFSET without a LIMIT.
+		limit = int(^uint32(0) >> 1)
+	}
+	p := s.placeholders(3)
+	rows, err := s.db.Query(
+		fmt.Sprintf(
+			"SELECT job, analyst, time_from, time_until, time_at, data FROM %s WHERE job = %s ORDER BY id LIMIT %s OFFSET %s",
+			s.table,
+			p[0],
+			p[1],
+			p[2],
+		),
+		job,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]*AnalysisResult, 0)
+	for rows.Next() {
+		r, err := scanResult(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// Each ensures that this implements the ResultStore interface. The results
+// are read with a single query.
+func (s *SQLResultStore) Each(job string, f func(*AnalysisResult) error) error {
+	rows, err := s.db.Query(
+		fmt.Sprintf(
+			"SELECT job, analyst, time_from, time_until, time_at, data FROM %s WHERE job = %s ORDER BY id",
+			s.table,
+			s.Placeholder(1),
+		),
+		job,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanResult(rows)
+		if err != nil {
+			return err
+		}
+		if err = f(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scanResult(rows *sql.Rows) (*AnalysisResult, error) {
+	var (
+		r    = &AnalysisResult{}
+		data string
+	)
+	if err := rows.Scan(&r.Job, &r.Analyst, &r.From, &r.Until, &r.At, &data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &r.Data); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,156 @@
+package slurp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSQLDriver is a database/sql driver that keeps the rows of a
+// SQLResultStore table in memory. It only understands the statements that
+// SQLResultStore makes.
+type fakeSQLDriver struct {
+	mutex   sync.Mutex
+	rows    [][]driver.Value
+	queries []string
+}
+
+func (d *fakeSQLDriver) Open(string) (driver.Conn, error) {
+	return &fakeSQLConn{d}, nil
+}
+
+func (d *fakeSQLDriver) Connect(context.Context) (driver.Conn, error) {
+	return &fakeSQLConn{d}, nil
+}
+
+func (d *fakeSQLDriver) Driver() driver.Driver {
+	return d
+}
+
+type fakeSQLConn struct {
+	d *fakeSQLDriver
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mutex.Lock()
+	defer c.d.mutex.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return &fakeSQLStmt{c.d, query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type fakeSQLStmt struct {
+	d     *fakeSQLDriver
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT INTO results ") || len(args) != 6 {
+		return nil, fmt.Errorf("unexpected statement %q", s.query)
+	}
+	s.d.mutex.Lock()
+	defer s.d.mutex.Unlock()
+	s.d.rows = append(s.d.rows, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT ") || !strings.Contains(s.query, " FROM results ") || (len(args) != 1 && len(args) != 3) {
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+	limit, offset := int64(-1), int64(0)
+	if len(args) == 3 {
+		limit, offset = args[1].(int64), args[2].(int64)
+	}
+	s.d.mutex.Lock()
+	defer s.d.mutex.Unlock()
+	r := &fakeSQLRows{}
+	for _, row := range s.d.rows {
+		if row[0] != args[0] {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if int64(len(r.rows)) == limit {
+			break
+		}
+		r.rows = append(r.rows, row)
+	}
+	return r, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	return []string{"job", "analyst", "time_from", "time_until", "time_at", "data"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLResultStore(t *testing.T) {
+	d := &fakeSQLDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+	testResultStore(t, NewSQLResultStore(db, "results"))
+	want := "SELECT job, analyst, time_from, time_until, time_at, data FROM results WHERE job = ? ORDER BY id LIMIT ? OFFSET ?"
+	if q := d.queries[len(d.queries)-1]; q != want {
+		t.Errorf("Expecting query %q, got %q.", want, q)
+	}
+	want = "SELECT job, analyst, time_from, time_until, time_at, data FROM results WHERE job = ? ORDER BY id"
+	if q := d.queries[5]; q != want {
+		t.Errorf("Expecting query %q, got %q.", want, q)
+	}
+}
+
+func TestSQLResultStorePlaceholder(t *testing.T) {
+	d := &fakeSQLDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+	s := NewSQLResultStore(db, "results")
+	s.Placeholder = func(n int) string {
+		return fmt.Sprintf("$%d", n)
+	}
+	testResultStore(t, s)
+	want := "INSERT INTO results (job, analyst, time_from, time_until, time_at, data) VALUES ($1, $2, $3, $4, $5, $6)"
+	if d.queries[0] != want {
+		t.Errorf("Expecting statement %q, got %q.", want, d.queries[0])
+	}
+	if q := d.queries[len(d.queries)-1]; !strings.HasSuffix(q, "WHERE job = $1 ORDER BY id LIMIT $2 OFFSET $3") {
+		t.Errorf("Expecting numbered placeholders, got %q.", q)
+	}
+}
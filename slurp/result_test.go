@@ -0,0 +1,132 @@
+package slurp
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testResultStore(t *testing.T, s ResultStore) {
+	at := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &AnalysisRequest{
+		TimeFrom:  at,
+		TimeUntil: at.Add(time.Hour),
+	}
+	for i := 0; i < 5; i++ {
+		job := "a"
+		if i%2 == 1 {
+			job = "b"
+		}
+		r.Results = ResultSinkFunc(func(result *AnalysisResult) error {
+			result.Job = job
+			result.Analyst = "x"
+			return s.WriteResult(result)
+		})
+		if err := r.Emit(at.Add(time.Duration(i)*time.Minute), map[string]interface{}{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var each []*AnalysisResult
+	err := s.Each("a", func(r *AnalysisResult) error {
+		each = append(each, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(each) != 3 || !each[2].At.Equal(at.Add(4*time.Minute)) {
+		t.Errorf("Expecting the 3 results for job a in order, got %v.", each)
+	}
+	stop := errors.New("stop")
+	n := 0
+	err = s.Each("a", func(r *AnalysisResult) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Expecting Each to stop at the first error, got %v after %d results.", err, n)
+	}
+	results, err := s.Results("a", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expecting 2 results, got %d.", len(results))
+	}
+	if !results[0].At.Equal(at.Add(2 * time.Minute)) {
+		t.Errorf("Expecting the first result to be at 2m, got %s.", results[0].At)
+	}
+	if !results[0].Until.Equal(at.Add(time.Hour)) {
+		t.Errorf("Expecting the result to have the analysis range, got %s.", results[0].Until)
+	}
+	if results[0].Analyst != "x" {
+		t.Errorf("Expecting the result to have the analyst \"x\", got %q.", results[0].Analyst)
+	}
+	results, err = s.Results("b", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expecting 1 result, got %d.", len(results))
+	}
+	results, err = s.Results("c", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expecting no results for an unknown job, got %d.", len(results))
+	}
+}
+
+func TestMemoryResultStore(t *testing.T) {
+	testResultStore(t, NewMemoryResultStore())
+}
+
+func TestNDJSONResultStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slurp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewNDJSONResultStore(filepath.Join(dir, "results.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testResultStore(t, s)
+}
+
+func TestNDJSONResultStoreTornLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slurp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.ndjson")
+	data := "{\"job\":\"a\",\"data\":{\"i\":0}}\nnot json\n{\"job\":\"a\",\"data\":{\"i\":1}}\n{\"job\":\"a\",\"da"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewNDJSONResultStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	results, err := s.Results("a", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].Data["i"] != float64(1) {
+		t.Errorf("Expecting the 2 results that can be read, got %+v.", results)
+	}
+}
+
+func TestAnalysisRequestEmitWithoutSink(t *testing.T) {
+	r := &AnalysisRequest{}
+	if err := r.Emit(time.Now(), nil); err != nil {
+		t.Errorf("Expecting no error, got %s.", err)
+	}
+}
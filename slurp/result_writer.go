@@ -0,0 +1,95 @@
+package slurp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ResultWriter is a ResultSink that writes results to an io.Writer as they
+// arrive, either as newline delimited JSON or as CSV. Parquet can not be
+// written a result at a time, use ExportResults for that instead.
+//
+// The CSV columns are taken from the first result, so it is an error for a
+// later result to have data that is not in one of those columns.
+type ResultWriter struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	format  string
+	csv     *csv.Writer
+	columns []string
+}
+
+// NewResultWriter returns a pointer to a new ResultWriter that writes
+// results to w in the given format.
+func NewResultWriter(w io.Writer, format string) (*ResultWriter, error) {
+	if format != ExportCSV && format != ExportNDJSON {
+		return nil, fmt.Errorf("unable to write %q results as they arrive", format)
+	}
+	r := &ResultWriter{
+		writer: bufio.NewWriter(w),
+		format: format,
+	}
+	if format == ExportCSV {
+		r.csv = csv.NewWriter(r.writer)
+	}
+	return r, nil
+}
+
+// WriteResult ensures that this implements the ResultSink interface.
+func (r *ResultWriter) WriteResult(result *AnalysisResult) error {
+	if r.format == ExportNDJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if _, err = r.writer.Write(data); err != nil {
+			return err
+		}
+		return r.writer.WriteByte('\n')
+	}
+	v := flattenResult(result)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.columns == nil {
+		columns := make([]string, 0, len(v))
+		for k := range v {
+			if !isExportColumn(k) {
+				columns = append(columns, k)
+			}
+		}
+		sort.Strings(columns)
+		r.columns = append(append([]string{}, exportColumns...), columns...)
+		if err := r.csv.Write(r.columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(r.columns))
+	for i, k := range r.columns {
+		record[i] = formatExportValue(v[k])
+		delete(v, k)
+	}
+	for k := range v {
+		return fmt.Errorf("result has data for %q which is not a CSV column", k)
+	}
+	return r.csv.Write(record)
+}
+
+// Flush ensures that all results have been written to the io.Writer.
+func (r *ResultWriter) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.csv != nil {
+		r.csv.Flush()
+		if err := r.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return r.writer.Flush()
+}
@@ -0,0 +1,57 @@
+package slurp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func writeTestResults(t *testing.T, format string) (*bytes.Buffer, error) {
+	var b bytes.Buffer
+	w, err := NewResultWriter(&b, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := exportTestStore().Results("j", 0, -1)
+	for _, r := range results {
+		if err = w.WriteResult(r); err != nil {
+			break
+		}
+	}
+	if ferr := w.Flush(); ferr != nil {
+		t.Fatal(ferr)
+	}
+	return &b, err
+}
+
+func TestResultWriterNDJSON(t *testing.T) {
+	b, err := writeTestResults(t, ExportNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := ExportResults(&want, ExportNDJSON, exportTestStore(), "j"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want.String() {
+		t.Errorf("Expecting the same NDJSON as an export.\nGot:\n%s\nWant:\n%s", b, &want)
+	}
+}
+
+func TestResultWriterCSV(t *testing.T) {
+	b, err := writeTestResults(t, ExportCSV)
+	if err == nil {
+		t.Errorf("Expecting an error for data that is not in a CSV column.")
+	}
+	want := `job,analyst,from,until,at,data.count,data.nested.name
+j,a,2015-01-01T00:00:00Z,2015-01-01T01:00:00Z,2015-01-01T00:00:00Z,1,"one, two"
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected CSV.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestResultWriterParquet(t *testing.T) {
+	if _, err := NewResultWriter(&bytes.Buffer{}, ExportParquet); err == nil {
+		t.Errorf("Expecting an error for a format that can not be written as results arrive.")
+	}
+}
@@ -19,14 +19,24 @@ func NewItem(at time.Time) *Item {
 	}
 }
 
+// DefaultRateWindow is the number of recent items that the
+// ItemChannelStatWrapper rate is worked out from.
+const DefaultRateWindow = 100
+
 // ItemChannelStatWrapper is used to monitor the throughput rate.
 type ItemChannelStatWrapper struct {
-	in     <-chan *Item
-	Out    chan *Item
-	itemAt *time.Time
-	rate   float64
-	count  int64
-	mutex  sync.RWMutex
+	in         <-chan *Item
+	Out        chan *Item
+	clock      Clock
+	itemAt     *time.Time
+	count      int64
+	times      []time.Time
+	timesIdx   int
+	timesLen   int
+	inBlocked  time.Duration
+	outBlocked time.Duration
+	closed     bool
+	mutex      sync.RWMutex
 }
 
 // Stat returns information about the item channel.
@@ -34,69 +44,116 @@ func (c *ItemChannelStatWrapper) Stat() ItemChannelStat {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	return ItemChannelStat{
-		ItemAt:   c.itemAt,
-		Rate:     c.rate,
-		Count:    c.count,
-		Length:   len(c.in),
-		Capacity: cap(c.in),
+		ItemAt:     c.itemAt,
+		Rate:       c.rate(),
+		Count:      c.count,
+		Length:     len(c.in),
+		Capacity:   cap(c.in),
+		InBlocked:  c.inBlocked,
+		OutBlocked: c.outBlocked,
 	}
 }
 
+// SetRateWindow changes the number of recent items that the rate is
+// worked out from.
+func (c *ItemChannelStatWrapper) SetRateWindow(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	times := make([]time.Time, n)
+	// Keep as many of the most recent times as will fit.
+	l := c.timesLen
+	if l > n {
+		l = n
+	}
+	for i := 0; i < l; i++ {
+		times[l-1-i] = c.times[(c.timesIdx-1-i+len(c.times))%len(c.times)]
+	}
+	c.times = times
+	c.timesIdx = l % n
+	c.timesLen = l
+}
+
+// rate works out the number of items per second over the most recent items.
+// The caller must hold the mutex.
+func (c *ItemChannelStatWrapper) rate() float64 {
+	if c.closed || c.timesLen == 0 {
+		return 0
+	}
+	oldest := c.times[0]
+	if c.timesLen == len(c.times) {
+		oldest = c.times[c.timesIdx]
+	}
+	d := c.clock.Now().Sub(oldest)
+	if d <= 0 {
+		return 0
+	}
+	return float64(c.timesLen) / d.Seconds()
+}
+
 // ItemChannelStat provides statistic about the item channel.
+//
+// InBlocked is the time spent waiting for items to arrive, a large value
+// means that whatever is sending the items is holding things up. OutBlocked
+// is the time spent waiting for items to be taken, a large value means that
+// whatever is receiving the items is holding things up.
 type ItemChannelStat struct {
-	ItemAt   *time.Time `json:"itemAt,omitempty"`
-	Rate     float64    `json:"rate"`
-	Count    int64      `json:"count"`
-	Length   int        `json:"length"`
-	Capacity int        `json:"capacity"`
+	ItemAt     *time.Time    `json:"itemAt,omitempty"`
+	Rate       float64       `json:"rate"`
+	Count      int64         `json:"count"`
+	Length     int           `json:"length"`
+	Capacity   int           `json:"capacity"`
+	InBlocked  time.Duration `json:"inBlocked"`
+	OutBlocked time.Duration `json:"outBlocked"`
 }
 
 // NewItemChannelStatWrapper creates a new ItemChannelStatWrapper
 func NewItemChannelStatWrapper(items <-chan *Item) *ItemChannelStatWrapper {
+	return NewItemChannelStatWrapperWithClock(items, SystemClock)
+}
+
+// NewItemChannelStatWrapperWithClock creates a new ItemChannelStatWrapper
+// that uses clock for its rate and blocked time calculations.
+func NewItemChannelStatWrapperWithClock(items <-chan *Item, clock Clock) *ItemChannelStatWrapper {
 	c := &ItemChannelStatWrapper{
-		in:  items,
-		Out: make(chan *Item, 0), // We want the Out chan to be unbuffered.
+		in:    items,
+		Out:   make(chan *Item, 0), // We want the Out chan to be unbuffered.
+		clock: clock,
+		times: make([]time.Time, DefaultRateWindow),
 	}
 	go func() {
-		var (
-			count  int64
-			itemAt *time.Time
-		)
-		times := make([]int64, 100, 100)
-		timesIdx := len(times)
-		rateReport := time.NewTicker(200 * time.Millisecond)
 		for {
-			select {
-			case <-rateReport.C:
+			t := c.clock.Now()
+			i, ok := <-c.in
+			received := c.clock.Now()
+			if !ok {
 				c.mutex.Lock()
-				if timesIdx == len(times) {
-					c.rate = 0
-				} else {
-					c.rate = 1000000000.0 * float64(len(times)-timesIdx) / float64(time.Now().UnixNano()-times[timesIdx])
-				}
-				c.count = count
-				c.itemAt = itemAt
+				c.inBlocked += received.Sub(t)
+				c.closed = true
 				c.mutex.Unlock()
-			case i, ok := <-c.in:
-				if !ok {
-					rateReport.Stop()
-					close(c.Out)
-					c.mutex.Lock()
-					c.rate = 0
-					c.count = count
-					c.itemAt = itemAt
-					c.mutex.Unlock()
-					return
-				}
-				c.Out <- i
-				times = times[1:]
-				times = append(times, time.Now().UnixNano())
-				if timesIdx > 0 {
-					timesIdx--
-				}
-				count++
-				itemAt = &i.At
+				// Only close once the final stats are in place so
+				// that they can be relied upon by the consumer.
+				close(c.Out)
+				return
+			}
+			at := i.At
+			c.mutex.Lock()
+			c.inBlocked += received.Sub(t)
+			c.times[c.timesIdx] = received
+			c.timesIdx = (c.timesIdx + 1) % len(c.times)
+			if c.timesLen < len(c.times) {
+				c.timesLen++
 			}
+			c.count++
+			c.itemAt = &at
+			c.mutex.Unlock()
+			c.Out <- i
+			sent := c.clock.Now()
+			c.mutex.Lock()
+			c.outBlocked += sent.Sub(received)
+			c.mutex.Unlock()
 		}
 	}()
 	return c
@@ -0,0 +1,95 @@
+package slurptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+var update = flag.Bool("slurptest.update", false, "update golden files rather than comparing against them")
+
+// AssertGolden compares got against the contents of the golden file at path.
+//
+// When the test binary is run with -slurptest.update the golden file is
+// written instead.
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unable to create golden file directory: %s.", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Unable to write golden file %q: %s.", path, err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read golden file %q: %s.", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Output does not match golden file %q.\nGot:\n%s\nWant:\n%s", path, got, want)
+	}
+}
+
+// AssertGoldenJSON marshals v as indented JSON and compares it against the
+// golden file at path.
+func AssertGoldenJSON(t testing.TB, path string, v interface{}) {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("Unable to marshal JSON: %s.", err)
+	}
+	AssertGolden(t, path, append(data, '\n'))
+}
+
+// AssertItemChannelStat compares two slurp.ItemChannelStat values.
+// Rate is not compared as it depends on the clock. Use a Clock and check
+// the rate directly if it matters to the test.
+func AssertItemChannelStat(t testing.TB, got slurp.ItemChannelStat, want slurp.ItemChannelStat) {
+	t.Helper()
+	if got.Count != want.Count {
+		t.Errorf("Expecting item channel count to be %d, got %d.", want.Count, got.Count)
+	}
+	switch {
+	case want.ItemAt == nil && got.ItemAt != nil:
+		t.Errorf("Expecting item channel itemAt to be nil, got %s.", got.ItemAt)
+	case want.ItemAt != nil && got.ItemAt == nil:
+		t.Errorf("Expecting item channel itemAt to be %s, got nil.", want.ItemAt)
+	case want.ItemAt != nil && !want.ItemAt.Equal(*got.ItemAt):
+		t.Errorf("Expecting item channel itemAt to be %s, got %s.", want.ItemAt, got.ItemAt)
+	}
+	if got.Length != want.Length {
+		t.Errorf("Expecting item channel length to be %d, got %d.", want.Length, got.Length)
+	}
+	if got.Capacity != want.Capacity {
+		t.Errorf("Expecting item channel capacity to be %d, got %d.", want.Capacity, got.Capacity)
+	}
+}
+
+// AssertDataLoaderStatCount checks the call counts of a slurp.DataLoaderStat.
+// Durations and call times are not compared as they depend on the clock.
+func AssertDataLoaderStatCount(t testing.TB, got *slurp.DataLoaderStat, called int64, returnEmptyKey int64, returnNilData int64, returnData int64) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Expecting a data loader stat, got nil.")
+	}
+	if got.Called.Count != called {
+		t.Errorf("Expecting data loader to have been called %d times, got %d.", called, got.Called.Count)
+	}
+	if got.ReturnEmptyKey.Count != returnEmptyKey {
+		t.Errorf("Expecting data loader to have returned an empty key %d times, got %d.", returnEmptyKey, got.ReturnEmptyKey.Count)
+	}
+	if got.ReturnNilData.Count != returnNilData {
+		t.Errorf("Expecting data loader to have returned nil data %d times, got %d.", returnNilData, got.ReturnNilData.Count)
+	}
+	if got.ReturnData.Count != returnData {
+		t.Errorf("Expecting data loader to have returned data %d times, got %d.", returnData, got.ReturnData.Count)
+	}
+}
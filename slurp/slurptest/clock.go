@@ -0,0 +1,41 @@
+package slurptest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a slurp.Clock that only changes when told to.
+type Clock struct {
+	mutex sync.RWMutex
+	now   time.Time
+}
+
+// NewClock returns a pointer to a new Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now: now,
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.now
+}
+
+// Set changes the current time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock on by d and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
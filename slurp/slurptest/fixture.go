@@ -0,0 +1,74 @@
+package slurptest
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// FixtureProducer is a slurp.Producer that sends a fixed set of items.
+type FixtureProducer struct {
+	Items []RecordedItem
+}
+
+// NewFixtureProducer creates a new FixtureProducer. The items are sorted
+// so that they will be sent in time order.
+func NewFixtureProducer(items ...RecordedItem) *FixtureProducer {
+	p := &FixtureProducer{
+		Items: make([]RecordedItem, len(items)),
+	}
+	copy(p.Items, items)
+	sort.SliceStable(p.Items, func(i, j int) bool {
+		return p.Items[i].At.Before(p.Items[j].At)
+	})
+	return p
+}
+
+// LoadFixtureProducer creates a new FixtureProducer from a JSON file
+// containing an array of items. This is the same format that is written by
+// AssertGoldenJSON for the items of a Recorder.
+func LoadFixtureProducer(path string) (*FixtureProducer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var items []RecordedItem
+	if err = json.NewDecoder(f).Decode(&items); err != nil {
+		return nil, err
+	}
+	return NewFixtureProducer(items...), nil
+}
+
+// Name ensures that this implements the slurp.Describer interface.
+func (p *FixtureProducer) Name() string {
+	return "Fixture Producer"
+}
+
+// Description ensures that this implements the slurp.Describer interface.
+func (p *FixtureProducer) Description() string {
+	return "Produces items from a fixture."
+}
+
+// Produce a production run containing the fixture items that are within the
+// from/until range. Each run sends new items so that any data loaded on to
+// them does not leak between runs.
+func (p *FixtureProducer) Produce(from time.Time, until time.Time) slurp.ProductionRun {
+	var f slurp.ProductionRunFunc
+	f = func(ch chan<- *slurp.Item) {
+		for _, fi := range p.Items {
+			if fi.At.Before(from) || !fi.At.Before(until) {
+				continue
+			}
+			item := slurp.NewItem(fi.At)
+			for k, v := range fi.Data {
+				item.Data[k] = v
+			}
+			ch <- item
+		}
+	}
+	return f
+}
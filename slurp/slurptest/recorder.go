@@ -0,0 +1,72 @@
+// Package slurptest provides utilities for testing slurp analysts, producers
+// and data loaders.
+package slurptest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// RecordedItem is a snapshot of an item. It is used both for the items
+// captured by a Recorder and for the items held in fixture files.
+type RecordedItem struct {
+	At   time.Time              `json:"at"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Recorder is a slurp.Slurper that captures every item it is given.
+//
+// The Data of each item is copied at the point it is received so that later
+// changes to the item do not alter what was recorded.
+type Recorder struct {
+	mutex sync.RWMutex
+	items []RecordedItem
+}
+
+// NewRecorder returns a pointer to a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		items: make([]RecordedItem, 0),
+	}
+}
+
+// Slurp records all of the items sent to the channel.
+func (r *Recorder) Slurp(items <-chan *slurp.Item) {
+	for i := range items {
+		data := make(map[string]interface{}, len(i.Data))
+		for k, v := range i.Data {
+			data[k] = v
+		}
+		r.mutex.Lock()
+		r.items = append(r.items, RecordedItem{
+			At:   i.At,
+			Data: data,
+		})
+		r.mutex.Unlock()
+	}
+}
+
+// Items returns the items that have been recorded so far.
+func (r *Recorder) Items() []RecordedItem {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	items := make([]RecordedItem, len(r.items))
+	copy(items, r.items)
+	return items
+}
+
+// Len returns the number of items that have been recorded so far.
+func (r *Recorder) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.items)
+}
+
+// Reset discards all recorded items.
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.items = make([]RecordedItem, 0)
+}
@@ -0,0 +1,65 @@
+package slurptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+func TestFixtureProducer(t *testing.T) {
+	p, err := LoadFixtureProducer("testdata/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	ch := make(chan *slurp.Item, 10)
+	p.Produce(base.Add(time.Second), base.Add(4*time.Second)).SendItems(ch)
+	close(ch)
+	var got []time.Time
+	for i := range ch {
+		got = append(got, i.At)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Expecting 3 items, got %d.", len(got))
+	}
+	for k, v := range got {
+		if want := base.Add(time.Duration(k+1) * time.Second); !v.Equal(want) {
+			t.Errorf("Expecting item %d to be at %s, got %s.", k, want, v)
+		}
+	}
+}
+
+func TestAnalysisRequestSlurperGolden(t *testing.T) {
+	p, err := LoadFixtureProducer("testdata/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	loader := slurp.NewDataLoaderStatWrapper(slurp.DataLoaderFunc(func(i *slurp.Item) (string, interface{}) {
+		if i.At.Second()%2 == 0 {
+			return "even", true
+		}
+		return "", nil
+	}))
+	rec := NewRecorder()
+	s := slurp.NewAnalysisRequestSlurper(&slurp.AnalysisRequest{
+		TimeFrom:    base.Add(time.Second),
+		TimeUntil:   base.Add(time.Hour),
+		DataLoader:  []slurp.DataLoader{loader},
+		SlurperFunc: rec.Slurp,
+	})
+	ch := make(chan *slurp.Item)
+	go func() {
+		p.Produce(slurp.AnalysisRequestTimeRange(s.Requests...)).SendItems(ch)
+		close(ch)
+	}()
+	s.Slurp(ch)
+	AssertGoldenJSON(t, "testdata/analysis_request_slurper.golden", rec.Items())
+	AssertDataLoaderStatCount(t, loader.Stat(), 4, 2, 0, 2)
+	itemAt := base.Add(4 * time.Second)
+	AssertItemChannelStat(t, s.SlurpStat(), slurp.ItemChannelStat{
+		ItemAt: &itemAt,
+		Count:  4,
+	})
+}
@@ -0,0 +1,105 @@
+package slurptest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// RecordedSpan is a snapshot of a span started by a Tracer.
+type RecordedSpan struct {
+	Name       string
+	TraceID    int64
+	SpanID     int64
+	ParentID   int64 // Zero for the root span of a trace.
+	Start      time.Time
+	End        *time.Time
+	Attributes map[string]interface{}
+}
+
+// Tracer is a slurp.Tracer that keeps all of its spans in memory.
+type Tracer struct {
+	clock  slurp.Clock
+	mutex  sync.RWMutex
+	nextID int64
+	spans  []*span
+}
+
+// NewTracer returns a pointer to a new Tracer that uses clock to time spans.
+func NewTracer(clock slurp.Clock) *Tracer {
+	return &Tracer{
+		clock: clock,
+	}
+}
+
+type span struct {
+	tracer *Tracer
+	data   RecordedSpan
+}
+
+// StartSpan ensures that this implements the slurp.Tracer interface.
+// Parent spans must have been started by the same Tracer.
+func (t *Tracer) StartSpan(name string, parent slurp.Span) slurp.Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nextID++
+	s := &span{
+		tracer: t,
+		data: RecordedSpan{
+			Name:       name,
+			TraceID:    t.nextID,
+			SpanID:     t.nextID,
+			Start:      t.clock.Now(),
+			Attributes: make(map[string]interface{}),
+		},
+	}
+	if p, ok := parent.(*span); ok && p != nil {
+		s.data.TraceID = p.data.TraceID
+		s.data.ParentID = p.data.SpanID
+	}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.data.Attributes[key] = value
+}
+
+func (s *span) End() {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	if s.data.End == nil {
+		end := s.tracer.clock.Now()
+		s.data.End = &end
+	}
+}
+
+// Spans returns all of the spans in the order that they were started.
+func (t *Tracer) Spans() []RecordedSpan {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	r := make([]RecordedSpan, len(t.spans))
+	for i, s := range t.spans {
+		r[i] = s.data
+		r[i].Attributes = make(map[string]interface{}, len(s.data.Attributes))
+		for k, v := range s.data.Attributes {
+			r[i].Attributes[k] = v
+		}
+	}
+	return r
+}
+
+// SpansNamed returns the spans with the given name in the order that they
+// were started.
+func (t *Tracer) SpansNamed(name string) []RecordedSpan {
+	r := make([]RecordedSpan, 0)
+	for _, s := range t.Spans() {
+		if s.Name == name {
+			r = append(r, s)
+		}
+	}
+	return r
+}
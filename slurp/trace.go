@@ -0,0 +1,77 @@
+package slurp
+
+import "fmt"
+
+// Tracer starts spans so that we can see where the time goes during a slurp.
+type Tracer interface {
+	// StartSpan starts a new span as a child of parent. A nil parent
+	// starts a new trace.
+	StartSpan(name string, parent Span) Span
+}
+
+// Span is a single timed operation within a trace.
+type Span interface {
+	// SetAttribute records a key value pair against the span.
+	SetAttribute(key string, value interface{})
+	// End marks the span as complete.
+	End()
+}
+
+// NopTracer is a Tracer that does nothing. It is used when no other Tracer
+// has been provided.
+var NopTracer Tracer = nopTracer{}
+
+type nopTracer struct{}
+
+func (t nopTracer) StartSpan(string, Span) Span {
+	return nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (s nopSpan) SetAttribute(string, interface{}) {}
+
+func (s nopSpan) End() {}
+
+// describedName returns the Describer name of v or its type when v is not
+// a Describer.
+func describedName(v interface{}) string {
+	if d, ok := v.(Describer); ok {
+		return d.Name()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// tracedDataLoader wraps a DataLoader so that each call gets a span.
+type tracedDataLoader struct {
+	loader DataLoader
+	tracer Tracer
+	parent Span
+}
+
+// LoadData calls the wrapped loader within a span.
+func (l *tracedDataLoader) LoadData(item *Item) (string, interface{}) {
+	span := l.tracer.StartSpan("slurp.DataLoader", l.parent)
+	defer span.End()
+	span.SetAttribute("loader", describedName(l.loader))
+	k, v := l.loader.LoadData(item)
+	span.SetAttribute("key", k)
+	return k, v
+}
+
+// TraceLoadData is the same as LoadData but records a span for the call as a
+// whole along with a child span for each loader.
+func TraceLoadData(tracer Tracer, parent Span, item *Item, loaders ...DataLoader) {
+	span := tracer.StartSpan("slurp.LoadData", parent)
+	defer span.End()
+	span.SetAttribute("item.at", item.At)
+	traced := make([]DataLoader, len(loaders))
+	for i, l := range loaders {
+		traced[i] = &tracedDataLoader{
+			loader: l,
+			tracer: tracer,
+			parent: span,
+		}
+	}
+	LoadData(item, traced...)
+}
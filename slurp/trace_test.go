@@ -0,0 +1,90 @@
+package slurp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+	"github.com/williambailey/go-slurp/slurp/slurptest"
+)
+
+func TestAnalysisRequestSlurperTrace(t *testing.T) {
+	base := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := make([]slurptest.RecordedItem, 10)
+	for i := range items {
+		items[i].At = base.Add(time.Duration(i) * time.Second)
+	}
+	p := slurptest.NewFixtureProducer(items...)
+	tracer := slurptest.NewTracer(slurptest.NewClock(base))
+	loader := func(k string) slurp.DataLoader {
+		return slurp.NewDataLoaderStatWrapper(slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+			return k, 1
+		}))
+	}
+	root := tracer.StartSpan("test", nil)
+	s := slurp.NewAnalysisRequestSlurper(
+		&slurp.AnalysisRequest{
+			TimeFrom:    base,
+			TimeUntil:   base.Add(time.Hour),
+			DataLoader:  []slurp.DataLoader{loader("a"), loader("b")},
+			SlurperFunc: slurptest.NewRecorder().Slurp,
+		},
+		&slurp.AnalysisRequest{
+			TimeFrom:    base,
+			TimeUntil:   base.Add(time.Hour),
+			SlurperFunc: slurptest.NewRecorder().Slurp,
+		},
+	)
+	s.Tracer = tracer
+	s.TraceParent = root
+	s.TraceLoadData = 4
+	ch := make(chan *slurp.Item)
+	go func() {
+		p.Produce(base, base.Add(time.Hour)).SendItems(ch)
+		close(ch)
+	}()
+	s.Slurp(ch)
+	root.End()
+
+	for _, sp := range tracer.Spans() {
+		if sp.TraceID != 1 {
+			t.Errorf("Expecting span %q to be part of trace 1, got %d.", sp.Name, sp.TraceID)
+		}
+		if sp.End == nil {
+			t.Errorf("Expecting span %q to have ended.", sp.Name)
+		}
+	}
+	slurper := tracer.SpansNamed("slurp.AnalysisRequestSlurper")
+	if len(slurper) != 1 {
+		t.Fatalf("Expecting 1 slurper span, got %d.", len(slurper))
+	}
+	if slurper[0].ParentID != 1 {
+		t.Errorf("Expecting slurper span to be a child of the root span, got %d.", slurper[0].ParentID)
+	}
+	requests := tracer.SpansNamed("slurp.AnalysisRequest")
+	if len(requests) != 2 {
+		t.Fatalf("Expecting 2 analysis request spans, got %d.", len(requests))
+	}
+	for _, r := range requests {
+		if r.ParentID != slurper[0].SpanID {
+			t.Errorf("Expecting analysis request span to be a child of the slurper span.")
+		}
+	}
+	// Items 0, 4 and 8 are sampled.
+	loads := tracer.SpansNamed("slurp.LoadData")
+	if len(loads) != 3 {
+		t.Fatalf("Expecting 3 load data spans, got %d.", len(loads))
+	}
+	if at := loads[1].Attributes["item.at"]; at != base.Add(4*time.Second) {
+		t.Errorf("Expecting the second load data span to be for the item at 4s, got %v.", at)
+	}
+	loaders := tracer.SpansNamed("slurp.DataLoader")
+	if len(loaders) != 6 {
+		t.Fatalf("Expecting 6 data loader spans, got %d.", len(loaders))
+	}
+	for _, l := range loaders {
+		if l.ParentID != loads[0].SpanID && l.ParentID != loads[1].SpanID && l.ParentID != loads[2].SpanID {
+			t.Errorf("Expecting data loader span to be a child of a load data span.")
+		}
+	}
+}
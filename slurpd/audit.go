@@ -0,0 +1,298 @@
+package slurpd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditJobSubmit       = "job.submit"
+	AuditJobCancel       = "job.cancel"
+	AuditJobState        = "job.state"
+	AuditComponentPut    = "component.put"
+	AuditComponentDelete = "component.delete"
+	AuditSchedulePut     = "schedule.put"
+	AuditScheduleDelete  = "schedule.delete"
+	AuditSchedulePause   = "schedule.pause"
+	AuditScheduleResume  = "schedule.resume"
+)
+
+// AuditLog is an append only NDJSON file of AuditEntryDTO lines. Once the
+// file reaches its max size it is renamed to path.1, path.1 is renamed to
+// path.2 and so on, keeping at most maxFiles old files.
+type AuditLog struct {
+	mutex    sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewAuditLog opens the audit log at path, creating it if needed. A maxSize
+// of zero means that the log is never rotated, otherwise at least one old
+// file must be kept.
+func NewAuditLog(path string, maxSize int64, maxFiles int) (*AuditLog, error) {
+	if maxSize > 0 && maxFiles < 1 {
+		return nil, fmt.Errorf("expecting to keep at least 1 rotated audit log file, got %d", maxFiles)
+	}
+	l := &AuditLog{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+// rotate moves the current file out of the way and starts a new one. The
+// caller must hold mutex.
+func (l *AuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(l.rotatedPath(l.maxFiles))
+	for i := l.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(l.rotatedPath(i), l.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.rotatedPath(1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *AuditLog) rotatedPath(n int) string {
+	return l.path + "." + strconv.Itoa(n)
+}
+
+// Write appends e to the log.
+func (l *AuditLog) Write(e *AuditEntryDTO) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log %s is closed", l.path)
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+	return err
+}
+
+// Close closes the log. Nothing more can be written to it.
+func (l *AuditLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// AuditFilter picks entries from the audit log. Empty fields match every
+// entry. Identity is matched against Identity.String().
+type AuditFilter struct {
+	Action   string
+	Job      string
+	Identity string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f *AuditFilter) match(e *AuditEntryDTO) bool {
+	switch {
+	case f.Action != "" && f.Action != e.Action:
+		return false
+	case f.Job != "" && f.Job != e.Job:
+		return false
+	case f.Identity != "" && (e.Identity == nil || f.Identity != e.Identity.String()):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Entries returns up to limit entries that match f, newest first, after
+// skipping offset of them. Rotated files that are still kept are included.
+// The files are read newest first until enough entries have been found,
+// without holding up writes to the log.
+func (l *AuditLog) Entries(f AuditFilter, offset int, limit int) ([]AuditEntryDTO, error) {
+	files, err := l.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	want := offset + limit
+	r := make([]AuditEntryDTO, 0, limit)
+	for _, file := range files {
+		if len(r) >= want {
+			break
+		}
+		// Only the newest matches in a file, which are read last, are kept.
+		n := want - len(r)
+		var matched []AuditEntryDTO
+		err := readAuditEntries(file, func(e *AuditEntryDTO) {
+			if !f.match(e) {
+				return
+			}
+			if len(matched) == n {
+				matched = matched[1:]
+			}
+			matched = append(matched, *e)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := len(matched) - 1; i >= 0; i-- {
+			r = append(r, matched[i])
+		}
+	}
+	if offset >= len(r) {
+		return r[:0], nil
+	}
+	return r[offset:], nil
+}
+
+// openFiles opens the log and the rotated files, newest first. They are all
+// opened together so that rotating the log while they are read does not move
+// entries from one to another.
+func (l *AuditLog) openFiles() ([]*os.File, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	files := make([]*os.File, 0, l.maxFiles+1)
+	for i := 0; i <= l.maxFiles; i++ {
+		path := l.path
+		if i > 0 {
+			path = l.rotatedPath(i)
+		}
+		file, err := os.Open(path)
+		if i > 0 && os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			for _, v := range files {
+				v.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readAuditEntries calls f for each entry read from r. Lines that can not
+// be read, such as one cut short by a crash or still being written, are
+// skipped.
+func readAuditEntries(r io.Reader, f func(e *AuditEntryDTO)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e AuditEntryDTO
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		f(&e)
+	}
+	return sc.Err()
+}
+
+// AuditLog sets where API actions and job state changes are recorded.
+// Nothing is recorded when l is nil, which is the default.
+func (s *Slurpd) AuditLog(l *AuditLog) {
+	s.auditLog = l
+}
+
+// audit records e in the audit log, if there is one. A failure to record an
+// entry is logged rather than failing the action.
+func (s *Slurpd) audit(e *AuditEntryDTO) {
+	l := s.auditLog
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = s.clock.Now()
+	}
+	if err := l.Write(e); err != nil {
+		log.Printf("Unable to write to the audit log: %s.\n", err)
+	}
+}
+
+// auditLocked is the same as audit except that the entry is written once
+// jobMutex has been released, so that jobs are not held up by the audit log.
+// The caller must hold jobMutex and release it with unlockJobs, which writes
+// the entry.
+func (s *Slurpd) auditLocked(e *AuditEntryDTO) {
+	if s.auditLog == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = s.clock.Now()
+	}
+	s.auditPending = append(s.auditPending, e)
+}
+
+// auditJob records the state that job k has got to. The caller must hold
+// jobMutex and release it with unlockJobs, which writes the entry.
+func (s *Slurpd) auditJob(k string, job *slurperMapItem) {
+	s.auditLocked(&AuditEntryDTO{
+		Action:   AuditJobState,
+		Job:      k,
+		State:    job.state,
+		Producer: job.producer,
+	})
+}
+
+// auditRequest records an action taken through the API by whoever made r
+// along with the error, if any, that it failed with.
+func (s *Slurpd) auditRequest(r *http.Request, e *AuditEntryDTO, err error) {
+	e.Identity = RequestIdentity(r)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.audit(e)
+}
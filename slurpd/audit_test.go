@@ -0,0 +1,187 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAuditLogRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.ndjson")
+	l, err := NewAuditLog(path, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		err := l.Write(&AuditEntryDTO{
+			Time:   t1.Add(time.Duration(i) * time.Minute),
+			Action: AuditJobState,
+			Job:    fmt.Sprintf("j%d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		if err != nil || fi.Size() > 200 {
+			t.Errorf("Expecting %s to be at most 200 bytes, got %v %v.", p, fi, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expecting only 2 rotated files to be kept, got %v.", err)
+	}
+
+	entries, err := l.Entries(AuditFilter{}, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) == 10 || entries[0].Job != "j9" {
+		t.Errorf("Expecting the newest entries, newest first, got %v.", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].Time.Before(entries[i-1].Time) {
+			t.Errorf("Expecting entries newest first, got %v.", entries)
+			break
+		}
+	}
+	page, err := l.Entries(AuditFilter{}, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 5 || fmt.Sprint(page) != fmt.Sprint(entries[2:5]) {
+		t.Errorf("Expecting entries 2 to 5 of %v, got %v.", entries, page)
+	}
+	if page, _ = l.Entries(AuditFilter{}, len(entries), 3); len(page) != 0 {
+		t.Errorf("Expecting no entries past the end, got %v.", page)
+	}
+	entries, _ = l.Entries(AuditFilter{Since: t1.Add(7 * time.Minute), Until: t1.Add(9 * time.Minute)}, 1, 100)
+	if len(entries) != 1 || entries[0].Job != "j7" {
+		t.Errorf("Expecting only j7, got %v.", entries)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(&AuditEntryDTO{}); err == nil {
+		t.Errorf("Expecting an error writing to a closed log.")
+	}
+	if _, err := NewAuditLog(path, 200, 0); err == nil {
+		t.Errorf("Expecting an error when a rotated log keeps no old files.")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := NewAuditLog(filepath.Join(dir, "audit.ndjson"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	router := ConfigureRouter(s, mux.NewRouter())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/audit", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expecting status %d without an audit log, got %d.", http.StatusNotFound, w.Code)
+	}
+
+	s.AuditLog(l)
+	if err := s.ApplyAuthConfig(testAuthConfig()); err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("POST", "/analysis-request", "t-alice", testJobRequest("a", t1, 0)))
+	var job JobDTO
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("POST", "/analysis-request", "t-alice", testJobRequest("x", t1, 0)))
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("POST", "/jobs/"+job.Job+"/cancel", "t-bob", nil))
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("POST", "/jobs/"+job.Job+"/cancel", "t-root", nil))
+	router.ServeHTTP(httptest.NewRecorder(), authRequest("DELETE", "/analysts/ap", "t-root", nil))
+	p.release <- struct{}{}
+	j, _ := s.job(job.Job)
+	<-j.done
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("GET", "/audit", "t-alice", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expecting only admins to read the audit log, got %d.", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("GET", "/audit?limit=100", "t-root", nil))
+	var v AuditDTO
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := len(v.Entries) - 1; i >= 0; i-- {
+		e := v.Entries[i]
+		s := e.Action
+		if e.Identity != nil {
+			s += " " + e.Identity.String()
+		}
+		if e.State != "" {
+			s += " " + e.State
+		}
+		if e.Name != "" {
+			s += " " + e.Name
+		}
+		if e.Error != "" {
+			s += " error"
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"job.submit token:alice",
+		"job.state queued",
+		"job.state running",
+		"job.submit token:alice error",
+		"job.cancel token:bob error",
+		"job.cancel token:root",
+		"component.delete token:root ap",
+		"job.state cancelled",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expecting entries %q, got %q.", want, got)
+	}
+	if e := v.Entries[len(v.Entries)-1]; e.Job != job.Job || e.Request == nil {
+		t.Errorf("Expecting the submit entry to have the job and request, got %+v.", e)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("GET", "/audit?action=job.cancel&identity=token:root&job="+job.Job, "t-root", nil))
+	v = AuditDTO{}
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Entries) != 1 || v.Entries[0].Error != "" {
+		t.Errorf("Expecting 1 matching entry, got %+v.", v.Entries)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("GET", "/audit?since=yesterday&limit=0", "t-root", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expecting status %d, got %d.", http.StatusBadRequest, w.Code)
+	}
+}
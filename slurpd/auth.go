@@ -0,0 +1,509 @@
+package slurpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// Role says what an identity is allowed to do with the API. Each role is
+// allowed to do everything that the roles before it can.
+type Role int
+
+// Roles from least to most trusted. RoleNone is not allowed to do anything.
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleSubmitter
+	RoleAdmin
+)
+
+var roleNames = []string{"none", "viewer", "submitter", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole returns the role called s.
+func ParseRole(s string) (Role, error) {
+	for i, v := range roleNames {
+		if v == s {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q, expecting one of %s", s, strings.Join(roleNames, ", "))
+}
+
+// MarshalText ensures that roles are sent by name.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText ensures that roles are read by name.
+func (r *Role) UnmarshalText(b []byte) error {
+	v, err := ParseRole(string(b))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// Authentication methods recorded on an Identity.
+const (
+	AuthAnonymous  = "anonymous"
+	AuthToken      = "token"
+	AuthHMAC       = "hmac"
+	AuthClientCert = "cert"
+	AuthSchedule   = "schedule"
+)
+
+// Identity is who made an API request, or who a job was started for.
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Role   Role   `json:"role"`
+}
+
+func (i *Identity) String() string {
+	return i.Method + ":" + i.Name
+}
+
+// same tells us if i and o are the same identity, whatever their roles.
+func (i *Identity) same(o *Identity) bool {
+	return i != nil && o != nil && i.Name == o.Name && i.Method == o.Method
+}
+
+// Authenticator works out who made an API request. A nil identity and
+// error means that the request does not carry credentials that the
+// authenticator understands. An error means that it does but they are not
+// valid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// AuthenticatorFunc is an adapter that allow you to use an ordinary
+// function as an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*Identity, error)
+
+// Authenticate calls f(r)
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Identity, error) {
+	return f(r)
+}
+
+// HTTPHandlerRole can be implemented by an HTTPHandler that needs a role
+// other than the default, which is viewer for GET and admin for every other
+// method.
+type HTTPHandlerRole interface {
+	Role() Role
+}
+
+// handlerRole returns the role needed to use h.
+func handlerRole(h HTTPHandler) Role {
+	if hr, ok := h.(HTTPHandlerRole); ok {
+		return hr.Role()
+	}
+	if h.Method() == "GET" {
+		return RoleViewer
+	}
+	return RoleAdmin
+}
+
+// Authenticators sets how API requests are authenticated. Each
+// authenticator is tried in turn until one recognises the credentials of
+// the request. When there are none every request is allowed, which is the
+// default.
+func (s *Slurpd) Authenticators(a ...Authenticator) {
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	s.authenticators = a
+}
+
+// AnonymousRole sets the role of requests without credentials when there
+// are authenticators. The default, RoleNone, turns them away.
+func (s *Slurpd) AnonymousRole(r Role) {
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	s.anonymousRole = r
+}
+
+// authenticate works out who made r. A nil identity means that
+// authentication is off.
+func (s *Slurpd) authenticate(r *http.Request) (*Identity, error) {
+	s.authMutex.RLock()
+	authenticators, anonymous := s.authenticators, s.anonymousRole
+	s.authMutex.RUnlock()
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	for _, a := range authenticators {
+		id, err := a.Authenticate(r)
+		if err != nil || id != nil {
+			return id, err
+		}
+	}
+	return &Identity{Name: AuthAnonymous, Method: AuthAnonymous, Role: anonymous}, nil
+}
+
+// authorize wraps the handler func for h so that only identities with the
+// role needed by h can use it.
+func (s *Slurpd) authorize(h HTTPHandler, next http.HandlerFunc) http.HandlerFunc {
+	return s.authorizeRole(h.Path(), handlerRole(h), next)
+}
+
+// Authorize wraps next so that only identities with at least role can use
+// it. It is for handlers served alongside the HTTP API, such as the metrics.
+func (s *Slurpd) Authorize(role Role, next http.Handler) http.Handler {
+	return s.authorizeRole("", role, next.ServeHTTP)
+}
+
+func (s *Slurpd) authorizeRole(path string, role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="slurpd"`)
+			WriteError(w, r, NewAPIError(http.StatusUnauthorized, ErrorCodeUnauthorized, "%s", err))
+			return
+		}
+		if id == nil {
+			next(w, r)
+			return
+		}
+		if id.Role < role {
+			if id.Method == AuthAnonymous {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="slurpd"`)
+				WriteError(w, r, NewAPIError(http.StatusUnauthorized, ErrorCodeUnauthorized, "credentials are required"))
+				return
+			}
+			if path == "" {
+				path = r.URL.Path
+			}
+			WriteError(w, r, NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "%s needs the %s role, %s has %s", path, role, id, id.Role))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	}
+}
+
+type identityKey struct{}
+
+// RequestIdentity returns who made an API request. It is nil when
+// authentication is off.
+func RequestIdentity(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
+
+// BearerTokenCookie is the cookie that a bearer token can also be sent in,
+// which is how the dashboard authenticates its EventSource. It is only read
+// for GET and HEAD requests so that other sites can not use it to change
+// anything.
+const BearerTokenCookie = "slurpd_token"
+
+// bearerToken returns the token from an "Authorization: Bearer" header, or
+// from the BearerTokenCookie of a GET or HEAD request.
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "bearer "
+	a := r.Header.Get("Authorization")
+	if a == "" && (r.Method == "GET" || r.Method == "HEAD") {
+		if c, err := r.Cookie(BearerTokenCookie); err == nil && c.Value != "" {
+			return c.Value, true
+		}
+	}
+	if len(a) < len(prefix) || !strings.EqualFold(a[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(a[len(prefix):]), true
+}
+
+// NewBearerTokenAuthenticator returns an Authenticator for requests with an
+// "Authorization: Bearer <token>" header, or a BearerTokenCookie. tokens
+// maps each token to the identity that uses it.
+func NewBearerTokenAuthenticator(tokens map[string]Identity) Authenticator {
+	// Tokens are looked up by hash so that the time taken does not give
+	// away how much of a token is right.
+	m := make(map[[sha256.Size]byte]Identity, len(tokens))
+	for k, v := range tokens {
+		v.Method = AuthToken
+		m[sha256.Sum256([]byte(k))] = v
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		token, ok := bearerToken(r)
+		if !ok {
+			return nil, nil
+		}
+		id, ok := m[sha256.Sum256([]byte(token))]
+		if !ok {
+			return nil, fmt.Errorf("unknown bearer token")
+		}
+		return &id, nil
+	})
+}
+
+// Headers and scheme used by HMAC signed requests.
+const (
+	HMACScheme     = "SLURP-HMAC-SHA256"
+	HMACDateHeader = "X-Slurp-Date"
+)
+
+// maxSignedBody is the largest request body that will be read to check
+// the signature of a request.
+const maxSignedBody = 10 << 20
+
+// HMACKey is a secret shared with a client that signs its requests.
+type HMACKey struct {
+	Secret   []byte
+	Identity Identity
+}
+
+// HMACAuthenticator is an Authenticator for requests signed with
+// SignRequest. Requests are only accepted for MaxSkew either side of the
+// time that they were signed.
+type HMACAuthenticator struct {
+	Keys    map[string]HMACKey
+	MaxSkew time.Duration
+	Clock   slurp.Clock
+}
+
+// NewHMACAuthenticator returns a pointer to a new HMACAuthenticator for keys
+// by their ID.
+func NewHMACAuthenticator(keys map[string]HMACKey) *HMACAuthenticator {
+	return &HMACAuthenticator{
+		Keys:    keys,
+		MaxSkew: 5 * time.Minute,
+		Clock:   slurp.SystemClock,
+	}
+}
+
+// Authenticate ensures that this implements the Authenticator interface.
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, HMACScheme+" ") {
+		return nil, nil
+	}
+	var keyID, sig string
+	for _, p := range strings.Split(strings.TrimPrefix(auth, HMACScheme+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Key":
+			keyID = kv[1]
+		case "Signature":
+			sig = kv[1]
+		}
+	}
+	key, ok := a.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown HMAC key %q", keyID)
+	}
+	date, err := time.Parse(time.RFC3339, r.Header.Get(HMACDateHeader))
+	if err != nil {
+		return nil, fmt.Errorf("expecting an RFC 3339 %s header", HMACDateHeader)
+	}
+	if d := a.Clock.Now().Sub(date); d > a.MaxSkew || d < -a.MaxSkew {
+		return nil, fmt.Errorf("the request was signed at %s which is too far from now", date.Format(time.RFC3339))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSignedBody {
+		return nil, fmt.Errorf("signed requests can not be more than %d bytes", maxSignedBody)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	want := signature(key.Secret, r.Method, r.URL.RequestURI(), r.Header.Get(HMACDateHeader), body)
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, want) {
+		return nil, fmt.Errorf("invalid signature for HMAC key %q", keyID)
+	}
+	id := key.Identity
+	id.Method = AuthHMAC
+	return &id, nil
+}
+
+// signature works out the HMAC of a request.
+func signature(secret []byte, method string, uri string, date string, body []byte) []byte {
+	h := sha256.Sum256(body)
+	m := hmac.New(sha256.New, secret)
+	fmt.Fprintf(m, "%s\n%s\n%s\n%s", method, uri, date, hex.EncodeToString(h[:]))
+	return m.Sum(nil)
+}
+
+// SignRequest signs r with the HMAC key keyID so that it is accepted by an
+// HMACAuthenticator. The signature covers the method, path, query, time
+// and body of the request.
+func SignRequest(r *http.Request, keyID string, secret []byte, now time.Time) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	date := now.UTC().Format(time.RFC3339)
+	r.Header.Set(HMACDateHeader, date)
+	r.Header.Set("Authorization", fmt.Sprintf("%s Key=%s, Signature=%s", HMACScheme, keyID, hex.EncodeToString(signature(secret, r.Method, r.URL.RequestURI(), date, body))))
+	return nil
+}
+
+// NewClientCertAuthenticator returns an Authenticator for requests made
+// with a verified TLS client certificate. Clients are named by the common
+// name of their certificate. roles gives the role for a common name,
+// defaultRole is used for the rest.
+func NewClientCertAuthenticator(roles map[string]Role, defaultRole Role) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return nil, nil
+		}
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		role, ok := roles[cn]
+		if !ok {
+			role = defaultRole
+		}
+		return &Identity{Name: cn, Method: AuthClientCert, Role: role}, nil
+	})
+}
+
+// AuthConfig describes how API requests are authenticated. It is usually
+// loaded from a JSON file with LoadAuthConfig.
+//
+//	{
+//	  "anonymous": "none",
+//	  "tokens": {"ci": {"token": "...", "role": "submitter"}},
+//	  "hmacKeys": {"backfill-1": {"name": "backfill", "secret": "...", "role": "submitter"}},
+//	  "clientCerts": {"roles": {"ops.example.com": "admin"}, "default": "viewer"}
+//	}
+//
+// Tokens are keyed by the name of their identity and HMAC keys by their ID.
+type AuthConfig struct {
+	Anonymous   Role                       `json:"anonymous"`
+	Tokens      map[string]AuthTokenConfig `json:"tokens,omitempty"`
+	HMACKeys    map[string]AuthHMACConfig  `json:"hmacKeys,omitempty"`
+	ClientCerts *AuthClientCertConfig      `json:"clientCerts,omitempty"`
+}
+
+// AuthTokenConfig is a bearer token for an identity.
+type AuthTokenConfig struct {
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// AuthHMACConfig is a key used to sign requests.
+type AuthHMACConfig struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+	Role   Role   `json:"role"`
+}
+
+// AuthClientCertConfig gives roles to TLS client certificates by their
+// common name.
+type AuthClientCertConfig struct {
+	Roles   map[string]Role `json:"roles,omitempty"`
+	Default Role            `json:"default"`
+}
+
+// LoadAuthConfig reads a JSON auth config file and applies it. Unknown
+// fields are an error so that typos are not silently ignored.
+func (s *Slurpd) LoadAuthConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var c AuthConfig
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err = d.Decode(&c); err != nil {
+		return fmt.Errorf("unable to read auth config %s: %s", path, err)
+	}
+	return s.ApplyAuthConfig(&c)
+}
+
+// ApplyAuthConfig sets the authenticators and anonymous role from c.
+func (s *Slurpd) ApplyAuthConfig(c *AuthConfig) error {
+	var (
+		errs           ConfigError
+		authenticators []Authenticator
+	)
+	if len(c.Tokens) > 0 {
+		tokens := make(map[string]Identity, len(c.Tokens))
+		for _, k := range sortedAuthKeys(c.Tokens) {
+			v := c.Tokens[k]
+			if v.Token == "" {
+				errs = append(errs, fmt.Sprintf("token %q: token is required", k))
+				continue
+			}
+			if _, ok := tokens[v.Token]; ok {
+				errs = append(errs, fmt.Sprintf("token %q: token is already used", k))
+				continue
+			}
+			tokens[v.Token] = Identity{Name: k, Role: v.Role}
+		}
+		authenticators = append(authenticators, NewBearerTokenAuthenticator(tokens))
+	}
+	if len(c.HMACKeys) > 0 {
+		keys := make(map[string]HMACKey, len(c.HMACKeys))
+		ids := make([]string, 0, len(c.HMACKeys))
+		for k := range c.HMACKeys {
+			ids = append(ids, k)
+		}
+		sort.Strings(ids)
+		for _, k := range ids {
+			v := c.HMACKeys[k]
+			if v.Secret == "" {
+				errs = append(errs, fmt.Sprintf("HMAC key %q: secret is required", k))
+				continue
+			}
+			name := v.Name
+			if name == "" {
+				name = k
+			}
+			keys[k] = HMACKey{Secret: []byte(v.Secret), Identity: Identity{Name: name, Role: v.Role}}
+		}
+		authenticators = append(authenticators, NewHMACAuthenticator(keys))
+	}
+	if c.ClientCerts != nil {
+		authenticators = append(authenticators, NewClientCertAuthenticator(c.ClientCerts.Roles, c.ClientCerts.Default))
+	}
+	if len(authenticators) == 0 {
+		errs = append(errs, "at least one of tokens, hmacKeys or clientCerts is required")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	s.authenticators = authenticators
+	s.anonymousRole = c.Anonymous
+	return nil
+}
+
+func sortedAuthKeys(m map[string]AuthTokenConfig) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,229 @@
+package slurpd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+func testAuthConfig() *AuthConfig {
+	return &AuthConfig{
+		Tokens: map[string]AuthTokenConfig{
+			"alice": {Token: "t-alice", Role: RoleSubmitter},
+			"bob":   {Token: "t-bob", Role: RoleSubmitter},
+			"vic":   {Token: "t-vic", Role: RoleViewer},
+			"root":  {Token: "t-root", Role: RoleAdmin},
+		},
+	}
+}
+
+func authRequest(method string, path string, token string, body interface{}) *http.Request {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	r := httptest.NewRequest(method, path, bytes.NewReader(b))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestAuthorize(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	if err := s.ApplyAuthConfig(testAuthConfig()); err != nil {
+		t.Fatal(err)
+	}
+	router := ConfigureRouter(s, mux.NewRouter())
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		token  string
+		body   interface{}
+		want   int
+	}{
+		{"GET", "/analysts", "", nil, http.StatusUnauthorized},
+		{"GET", "/analysts", "nope", nil, http.StatusUnauthorized},
+		{"GET", "/analysts", "t-vic", nil, http.StatusOK},
+		{"POST", "/analysis-request", "t-vic", testJobRequest("a", t1, 0), http.StatusForbidden},
+		{"POST", "/analysis-request", "t-alice", testJobRequest("a", t1, 0), http.StatusOK},
+		{"PUT", "/schedules/x", "t-alice", nil, http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, authRequest(tc.method, tc.path, tc.token, tc.body))
+		if w.Code != tc.want {
+			t.Errorf("%s %s as %q: Expecting status %d, got %d %s.", tc.method, tc.path, tc.token, tc.want, w.Code, w.Body)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s as %q: Expecting a WWW-Authenticate header.", tc.method, tc.path, tc.token)
+		}
+	}
+	p.expectStart(t, t1)
+
+	// The identity is recorded on the job and only the submitter or an
+	// admin can cancel it.
+	jobs := s.jobStatus()
+	if len(jobs) != 1 {
+		t.Fatalf("Expecting 1 job, got %d.", len(jobs))
+	}
+	var k string
+	for k = range jobs {
+	}
+	if id := jobs[k].Identity; id == nil || id.String() != "token:alice" || id.Role != RoleSubmitter {
+		t.Errorf("Expecting the job to be submitted by token:alice, got %v.", id)
+	}
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"t-vic", http.StatusForbidden},
+		{"t-bob", http.StatusForbidden},
+		{"t-root", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, authRequest("POST", "/jobs/"+k+"/cancel", tc.token, nil))
+		if w.Code != tc.want {
+			t.Errorf("Cancel as %q: Expecting status %d, got %d %s.", tc.token, tc.want, w.Code, w.Body)
+		}
+	}
+	p.release <- struct{}{}
+
+	// Anonymous requests can be given a role.
+	s.AnonymousRole(RoleViewer)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, authRequest("GET", "/analysts", "", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expecting anonymous viewers to get status %d, got %d.", http.StatusOK, w.Code)
+	}
+}
+
+func TestBearerTokenCookie(t *testing.T) {
+	s := newTestSlurpd(newGateProducer())
+	if err := s.ApplyAuthConfig(testAuthConfig()); err != nil {
+		t.Fatal(err)
+	}
+	router := ConfigureRouter(s, mux.NewRouter())
+	router.HandleFunc("/metrics", MetricsHandlerFunc(s)).Methods("GET")
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		method string
+		path   string
+		cookie string
+		body   interface{}
+		want   int
+	}{
+		{"GET", "/metrics", "", nil, http.StatusUnauthorized},
+		{"GET", "/metrics", "t-vic", nil, http.StatusOK},
+		{"GET", "/analysts", "t-vic", nil, http.StatusOK},
+		{"GET", "/analysts", "nope", nil, http.StatusUnauthorized},
+		// The cookie is not used to change anything.
+		{"POST", "/analysis-request", "t-alice", testJobRequest("a", t1, 0), http.StatusUnauthorized},
+	} {
+		r := authRequest(tc.method, tc.path, "", tc.body)
+		if tc.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: BearerTokenCookie, Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s %s with cookie %q: Expecting status %d, got %d %s.", tc.method, tc.path, tc.cookie, tc.want, w.Code, w.Body)
+		}
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	a := NewHMACAuthenticator(map[string]HMACKey{
+		"k1": {Secret: []byte("s3cret"), Identity: Identity{Name: "backfill", Role: RoleSubmitter}},
+	})
+	a.Clock = slurp.ClockFunc(func() time.Time { return now })
+	sign := func(key string, secret string, at time.Time) *http.Request {
+		r := httptest.NewRequest("POST", "/analysis-request?x=1", bytes.NewBufferString(`{"producer":"p"}`))
+		if err := SignRequest(r, key, []byte(secret), at); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := sign("k1", "s3cret", now.Add(-time.Minute))
+	id, err := a.Authenticate(r)
+	if err != nil || id == nil || id.String() != "hmac:backfill" || id.Role != RoleSubmitter {
+		t.Errorf("Expecting hmac:backfill, got %v %v.", id, err)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["producer"] != "p" {
+		t.Errorf("Expecting the body to still be readable, got %v %v.", body, err)
+	}
+
+	for name, r := range map[string]*http.Request{
+		"unknown key":  sign("k2", "s3cret", now),
+		"wrong secret": sign("k1", "guess", now),
+		"too old":      sign("k1", "s3cret", now.Add(-10*time.Minute)),
+		"tampered": func() *http.Request {
+			r := sign("k1", "s3cret", now)
+			r.Body = http.NoBody
+			return r
+		}(),
+	} {
+		if id, err := a.Authenticate(r); id != nil || err == nil {
+			t.Errorf("%s: Expecting an error, got %v.", name, id)
+		}
+	}
+	if id, err := a.Authenticate(httptest.NewRequest("GET", "/", nil)); id != nil || err != nil {
+		t.Errorf("Expecting unsigned requests to be passed on, got %v %v.", id, err)
+	}
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	a := NewClientCertAuthenticator(map[string]Role{"ops": RoleAdmin}, RoleViewer)
+	for cn, want := range map[string]Role{"ops": RoleAdmin, "other": RoleViewer} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}},
+		}
+		id, err := a.Authenticate(r)
+		if err != nil || id == nil || id.String() != "cert:"+cn || id.Role != want {
+			t.Errorf("%s: Expecting role %s, got %v %v.", cn, want, id, err)
+		}
+	}
+	if id, err := a.Authenticate(httptest.NewRequest("GET", "/", nil)); id != nil || err != nil {
+		t.Errorf("Expecting requests without a certificate to be passed on, got %v %v.", id, err)
+	}
+}
+
+func TestApplyAuthConfig(t *testing.T) {
+	s := NewSlurpd()
+	err := s.ApplyAuthConfig(&AuthConfig{
+		Tokens: map[string]AuthTokenConfig{
+			"a": {Token: "same"},
+			"b": {Token: "same"},
+			"c": {},
+		},
+		HMACKeys: map[string]AuthHMACConfig{"k": {}},
+	})
+	ce, ok := err.(ConfigError)
+	if !ok || len(ce) != 3 {
+		t.Errorf("Expecting 3 config errors, got %v.", err)
+	}
+	if err := s.ApplyAuthConfig(&AuthConfig{}); err == nil {
+		t.Errorf("Expecting an error without any authenticators.")
+	}
+
+	var c AuthConfig
+	if err := json.Unmarshal([]byte(`{"anonymous":"root"}`), &c); err == nil {
+		t.Errorf("Expecting an unknown role to be rejected.")
+	}
+}
@@ -0,0 +1,92 @@
+package slurpd
+
+import (
+	"log"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// CheckpointInterval sets how often running jobs that are kept in the job
+// queue file save how far they have got, so that they resume from there
+// after a restart. Jobs interrupted by Drain are always checkpointed. Zero,
+// the default, only checkpoints those.
+func (s *Slurpd) CheckpointInterval(d time.Duration) {
+	s.checkpointEvery = d
+}
+
+// startCheckpoints checkpoints job k every CheckpointInterval while it runs
+// if it is kept in the job queue file. The returned func stops it. It must be
+// called before the slurp starts.
+func (s *Slurpd) startCheckpoints(k string, job *slurperMapItem) func() {
+	s.jobMutex.Lock()
+	keep := s.keepsJob(job)
+	s.unlockJobs()
+	job.slurper.TrackCheckpoints = keep
+	if !keep || s.checkpointEvery <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(s.checkpointEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				s.saveCheckpoint(k, job)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// saveCheckpoint saves how far job k has got in the job queue file. Results
+// are flushed first so that those for items before the checkpoint are not
+// lost if slurpd crashes.
+func (s *Slurpd) saveCheckpoint(k string, job *slurperMapItem) {
+	cps, err := job.slurper.Checkpoints()
+	if f, ok := s.resultStore.(slurp.ResultFlusher); ok && err == nil {
+		err = f.Flush()
+	}
+	if err != nil {
+		log.Printf("Unable to checkpoint job %q: %s.\n", k, err)
+		return
+	}
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	job.checkpoints = cps
+	s.saveJobQueue()
+}
+
+// resumeJob sets job k up to carry on from the checkpoints that it had got
+// to before a restart. An analysis request whose state can not be restored
+// starts from scratch.
+func (s *Slurpd) resumeJob(k string, job *slurperMapItem, cps []slurp.Checkpoint) {
+	if len(cps) == 0 {
+		return
+	}
+	requests := job.slurper.Requests
+	if len(cps) != len(requests) {
+		log.Printf("Unable to resume job %q: expecting %d checkpoints, got %d.\n", k, len(requests), len(cps))
+		return
+	}
+	for i, r := range requests {
+		if r.Checkpointer == nil || cps[i].At.IsZero() {
+			continue
+		}
+		if err := r.Checkpointer.Restore(cps[i].At, cps[i].State); err != nil {
+			log.Printf("Unable to restore analysis request %d of job %q: %s.\n", i, k, err)
+			cps[i] = slurp.Checkpoint{}
+		}
+	}
+	log.Printf("Resuming job %q from its checkpoint.\n", k)
+	job.checkpoints = cps
+	job.slurper.Resume = cps
+}
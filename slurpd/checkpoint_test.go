@@ -0,0 +1,144 @@
+package slurpd
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// testCheckpointAnalyst counts the items that it has analysed.
+type testCheckpointAnalyst struct {
+	testAnalyst
+	mutex sync.Mutex
+	at    time.Time
+	count int
+}
+
+func (a *testCheckpointAnalyst) AnalysisRequest(pointInTime time.Time) *slurp.AnalysisRequest {
+	return a.AnalysisRangeRequest(a.RangeForAnalysisRequest(pointInTime))
+}
+
+func (a *testCheckpointAnalyst) AnalysisRangeRequest(from time.Time, until time.Time) *slurp.AnalysisRequest {
+	r := a.testAnalyst.AnalysisRangeRequest(from, until)
+	r.Analyst = a
+	r.SlurperFunc = func(items <-chan *slurp.Item) {
+		for item := range items {
+			a.mutex.Lock()
+			a.at = item.At
+			a.count++
+			a.mutex.Unlock()
+		}
+	}
+	r.Checkpointer = a
+	return r
+}
+
+func (a *testCheckpointAnalyst) Checkpoint() (time.Time, []byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.at, []byte(strconv.Itoa(a.count)), nil
+}
+
+func (a *testCheckpointAnalyst) Restore(at time.Time, state []byte) error {
+	n, err := strconv.Atoi(string(state))
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.at, a.count = at, n
+	return nil
+}
+
+func (a *testCheckpointAnalyst) expectCount(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		a.mutex.Lock()
+		count := a.count
+		a.mutex.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expecting %d items to be analysed.", n)
+}
+
+// itemProducer sends an item a minute for ten minutes and then waits to be
+// released.
+type itemProducer struct {
+	gateProducer
+}
+
+func (p *itemProducer) Produce(from time.Time, until time.Time) slurp.ProductionRun {
+	return slurp.ProductionRunFunc(func(ch chan<- *slurp.Item) {
+		p.started <- from
+		for i := 0; i < 10; i++ {
+			ch <- slurp.NewItem(from.Add(time.Duration(i) * time.Minute))
+		}
+		<-p.release
+	})
+}
+
+func newCheckpointSlurpd(t *testing.T, path string, every time.Duration) (*Slurpd, *itemProducer, *testCheckpointAnalyst) {
+	p := &itemProducer{*newGateProducer()}
+	a := &testCheckpointAnalyst{}
+	s := NewSlurpd()
+	s.CheckpointInterval(every)
+	s.RegisterProducer("p", p)
+	s.RegisterAnalyst("c", a)
+	if err := s.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return s, p, a
+}
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	s, p, a := newCheckpointSlurpd(t, path, 0)
+	k, err := s.SubmitJob(testJobRequest("c", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+	a.expectCount(t, 10)
+
+	// Interrupted jobs are checkpointed.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Drain(ctx)
+	p.release <- struct{}{}
+	last := t1.Add(9 * time.Minute)
+	jobs := readQueueFile(t, path)
+	if len(jobs) != 1 || len(jobs[0].Checkpoints) != 1 || !jobs[0].Checkpoints[0].At.Equal(last) || string(jobs[0].Checkpoints[0].State) != "10" {
+		t.Fatalf("Expecting job %q to be checkpointed at %s, got %+v.", k, last, jobs)
+	}
+
+	// The job resumes from the checkpoint after a restart, and running jobs
+	// are checkpointed as they go.
+	s2, p2, a2 := newCheckpointSlurpd(t, path, time.Millisecond)
+	p2.expectStart(t, last)
+	a2.expectCount(t, 19)
+	last = last.Add(9 * time.Minute)
+	for i := 0; i < 100; i++ {
+		jobs = readQueueFile(t, path)
+		if len(jobs) == 1 && len(jobs[0].Checkpoints) == 1 && jobs[0].Checkpoints[0].At.Equal(last) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cp := jobs[0].Checkpoints[0]; !cp.At.Equal(last) || string(cp.State) != "19" {
+		t.Errorf("Expecting a checkpoint at %s, got %+v.", last, cp)
+	}
+	p2.release <- struct{}{}
+	job, _ := s2.job(k)
+	<-job.done
+	if jobs := readQueueFile(t, path); len(jobs) != 0 {
+		t.Errorf("Expecting the finished job to be removed from the queue file, got %+v.", jobs)
+	}
+}
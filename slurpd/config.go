@@ -0,0 +1,455 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// Config wires component factories in to named producers, data loaders and
+// analysts. It is usually loaded from a JSON file with LoadConfig.
+//
+//	{
+//	  "maxConcurrentJobs": 4,
+//	  "dataLoaders": {
+//	    "users": {"factory": "http", "params": {"url": "..."}, "concurrency": 2}
+//	  },
+//	  "producers": {
+//	    "events": {"factory": "events", "params": {}}
+//	  },
+//	  "analysts": {
+//	    "signups": {"factory": "signups", "dataLoaders": ["users"]}
+//	  },
+//	  "schedules": {
+//	    "nightly": {"cron": "0 2 * * *", "location": "Europe/London", "producer": "events", "analyst": "signups", "time": "yesterday 00:00 UTC"}
+//	  }
+//	}
+//
+// The cron expression of a schedule is worked out in its location, UTC when
+// it does not have one.
+type Config struct {
+	MaxConcurrentJobs *int                       `json:"maxConcurrentJobs,omitempty"`
+	DataLoaders       map[string]ComponentConfig `json:"dataLoaders"`
+	Producers         map[string]ComponentConfig `json:"producers"`
+	Analysts          map[string]ComponentConfig `json:"analysts"`
+	Schedules         ScheduleMapDTO             `json:"schedules"`
+}
+
+// ComponentConfig describes a component made by a registered factory.
+// DataLoaders is only used by analysts and Concurrency, the number of jobs
+// that can use the component at the same time, only by producers and data
+// loaders.
+type ComponentConfig struct {
+	Factory     string       `json:"factory"`
+	Params      slurp.Params `json:"params,omitempty"`
+	DataLoaders []string     `json:"dataLoaders,omitempty"`
+	Concurrency int          `json:"concurrency,omitempty"`
+}
+
+// ConfigError lists everything that is wrong with a config.
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// LoadConfig reads a JSON config file and applies it. Unknown fields are an
+// error so that typos are not silently ignored.
+func (s *Slurpd) LoadConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var c Config
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err = d.Decode(&c); err != nil {
+		return fmt.Errorf("unable to read config %s: %s", path, err)
+	}
+	return s.ApplyConfig(&c)
+}
+
+// ApplyConfig creates and registers the components in the config and then
+// the schedules. The whole config is checked first, nothing is registered
+// unless it is all valid. Keys must not already be registered.
+func (s *Slurpd) ApplyConfig(c *Config) error {
+	var (
+		errs        ConfigError
+		dataLoaders = make(map[string]slurp.DataLoader)
+		producers   = make(map[string]slurp.Producer)
+		analysts    = make(map[string]slurp.Analyst)
+	)
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, a...))
+	}
+	failComponent := func(kind string, k string, err error) {
+		if pe, ok := err.(slurp.ParamErrors); ok {
+			for _, e := range pe {
+				fail("%s %q: %s", kind, k, e)
+			}
+			return
+		}
+		fail("%s %q: %s", kind, k, err)
+	}
+	if c.MaxConcurrentJobs != nil && *c.MaxConcurrentJobs < 0 {
+		fail("maxConcurrentJobs: must not be negative")
+	}
+
+	for _, k := range sortedConfigKeys(c.DataLoaders) {
+		v := c.DataLoaders[k]
+		if _, ok := s.DataLoader(k); ok {
+			fail("data loader %q: already registered", k)
+			continue
+		}
+		if v.Concurrency < 0 {
+			fail("data loader %q: concurrency must not be negative", k)
+		}
+		if len(v.DataLoaders) > 0 {
+			fail("data loader %q: dataLoaders is only used by analysts", k)
+		}
+		l, err := newDataLoader(v)
+		if err != nil {
+			failComponent("data loader", k, err)
+			continue
+		}
+		dataLoaders[k] = l
+	}
+
+	for _, k := range sortedConfigKeys(c.Producers) {
+		v := c.Producers[k]
+		if _, ok := s.Producer(k); ok {
+			fail("producer %q: already registered", k)
+			continue
+		}
+		if v.Concurrency < 0 {
+			fail("producer %q: concurrency must not be negative", k)
+		}
+		if len(v.DataLoaders) > 0 {
+			fail("producer %q: dataLoaders is only used by analysts", k)
+		}
+		p, err := newProducer(v)
+		if err != nil {
+			failComponent("producer", k, err)
+			continue
+		}
+		producers[k] = p
+	}
+
+	for _, k := range sortedConfigKeys(c.Analysts) {
+		v := c.Analysts[k]
+		if _, ok := s.Analyst(k); ok {
+			fail("analyst %q: already registered", k)
+			continue
+		}
+		if v.Concurrency != 0 {
+			fail("analyst %q: concurrency is only used by producers and data loaders", k)
+		}
+		loaders := make([]slurp.DataLoader, 0, len(v.DataLoaders))
+		missing := false
+		for _, lk := range v.DataLoaders {
+			l, ok := dataLoaders[lk]
+			if !ok {
+				l, ok = s.DataLoader(lk)
+			}
+			if !ok {
+				fail("analyst %q: unknown data loader %q", k, lk)
+				missing = true
+				continue
+			}
+			loaders = append(loaders, l)
+		}
+		if missing {
+			if _, ok := analystFactory(v.Factory); !ok {
+				fail("analyst %q: unknown factory %q", k, v.Factory)
+			}
+			continue
+		}
+		a, err := newAnalyst(v, loaders)
+		if err != nil {
+			failComponent("analyst", k, err)
+			continue
+		}
+		analysts[k] = a
+	}
+
+	now := s.clock.Now().In(time.UTC)
+	scheduleKeys := make([]string, 0, len(c.Schedules))
+	for k := range c.Schedules {
+		scheduleKeys = append(scheduleKeys, k)
+	}
+	sort.Strings(scheduleKeys)
+	for _, k := range scheduleKeys {
+		v := c.Schedules[k]
+		if _, err := parseCron(v.Cron); err != nil {
+			fail("schedule %q: %s", k, err)
+		}
+		if _, err := scheduleLocation(v.Location); err != nil {
+			fail("schedule %q: %s", k, err)
+		}
+		if _, err := ParseTimeExpression(v.Time, now); err != nil {
+			fail("schedule %q: %s", k, err)
+		}
+		if _, ok := producers[v.Producer]; !ok {
+			if _, ok = s.Producer(v.Producer); !ok {
+				fail("schedule %q: unknown producer %q", k, v.Producer)
+			}
+		}
+		a, ok := analysts[v.Analyst]
+		if !ok {
+			a, ok = s.Analyst(v.Analyst)
+		}
+		if !ok {
+			fail("schedule %q: unknown analyst %q", k, v.Analyst)
+		} else if _, err := analysisRequestParams(a, v.Params); err != nil {
+			failComponent("schedule", k, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for k, v := range dataLoaders {
+		s.registerDataLoader(k, v, c.DataLoaders[k], true)
+	}
+	for k, v := range producers {
+		s.registerProducer(k, v, c.Producers[k], true)
+	}
+	for k, v := range analysts {
+		if _, err := s.registerAnalyst(k, v, c.Analysts[k], true); err != nil {
+			return fmt.Errorf("analyst %q: %s", k, err)
+		}
+	}
+	if c.MaxConcurrentJobs != nil {
+		s.MaxConcurrentJobs(*c.MaxConcurrentJobs)
+	}
+	for _, k := range scheduleKeys {
+		if err := s.AddSchedule(k, c.Schedules[k]); err != nil {
+			return fmt.Errorf("schedule %q: %s", k, err)
+		}
+	}
+	return nil
+}
+
+// CreateDataLoader creates a data loader from a factory and registers it
+// at k. When replace is false it is an error for k to already be
+// registered. Every problem found with c is listed in a ValidationError.
+func (s *Slurpd) CreateDataLoader(k string, c ComponentConfig, replace bool) error {
+	var errs ValidationError
+	checkComponentConfig(&errs, c, false)
+	l, err := newDataLoader(c)
+	if err != nil {
+		addComponentError(&errs, err)
+	}
+	if err = errs.err(); err != nil {
+		return err
+	}
+	if !s.registerDataLoader(k, l, c, replace) {
+		return NewAPIError(http.StatusConflict, ErrorCodeConflict, "data loader %q is already registered", k)
+	}
+	return nil
+}
+
+// CreateProducer creates a producer from a factory and registers it at k.
+// When replace is false it is an error for k to already be registered.
+// Every problem found with c is listed in a ValidationError.
+func (s *Slurpd) CreateProducer(k string, c ComponentConfig, replace bool) error {
+	var errs ValidationError
+	checkComponentConfig(&errs, c, false)
+	p, err := newProducer(c)
+	if err != nil {
+		addComponentError(&errs, err)
+	}
+	if err = errs.err(); err != nil {
+		return err
+	}
+	if !s.registerProducer(k, p, c, replace) {
+		return NewAPIError(http.StatusConflict, ErrorCodeConflict, "producer %q is already registered", k)
+	}
+	return nil
+}
+
+// CreateAnalyst creates an analyst from a factory and registers it at k.
+// The data loaders named in the config must already be registered. When
+// replace is false it is an error for k to already be registered. Every
+// problem found with c is listed in a ValidationError.
+func (s *Slurpd) CreateAnalyst(k string, c ComponentConfig, replace bool) error {
+	var errs ValidationError
+	checkComponentConfig(&errs, c, true)
+	loaders := make([]slurp.DataLoader, len(c.DataLoaders))
+	for i, lk := range c.DataLoaders {
+		l, ok := s.DataLoader(lk)
+		if !ok {
+			errs.add(fmt.Sprintf("dataLoaders[%d]", i), ErrorCodeUnknown, "unknown data loader %q", lk)
+			continue
+		}
+		loaders[i] = l
+	}
+	if len(errs) > 0 {
+		// Only check the factory and params, the analyst can not be
+		// made without its data loaders.
+		if f, ok := analystFactory(c.Factory); !ok {
+			errs.add("factory", ErrorCodeUnknown, "unknown factory %q", c.Factory)
+		} else if _, err := f.Params.Validate(c.Params); err != nil {
+			errs.addParams("params", err)
+		}
+		return errs
+	}
+	a, err := newAnalyst(c, loaders)
+	if err != nil {
+		addComponentError(&errs, err)
+		return errs
+	}
+	ok, err := s.registerAnalyst(k, a, c, replace)
+	if err != nil {
+		return NewAPIError(http.StatusConflict, ErrorCodeConflict, "%s", err)
+	}
+	if !ok {
+		return NewAPIError(http.StatusConflict, ErrorCodeConflict, "analyst %q is already registered", k)
+	}
+	return nil
+}
+
+// checkComponentConfig records the fields of c that are not used by the
+// kind of component being made.
+func checkComponentConfig(errs *ValidationError, c ComponentConfig, analyst bool) {
+	if analyst {
+		if c.Concurrency != 0 {
+			errs.add("concurrency", ErrorCodeInvalid, "is only used by producers and data loaders")
+		}
+		return
+	}
+	if c.Concurrency < 0 {
+		errs.add("concurrency", ErrorCodeInvalid, "must not be negative")
+	}
+	if len(c.DataLoaders) > 0 {
+		errs.add("dataLoaders", ErrorCodeInvalid, "is only used by analysts")
+	}
+}
+
+// addComponentError records an error from making a component against the
+// part of the config that caused it.
+func addComponentError(errs *ValidationError, err error) {
+	switch e := err.(type) {
+	case unknownFactoryError:
+		errs.add("factory", ErrorCodeUnknown, "%s", e)
+	case slurp.ParamErrors:
+		errs.addParams("params", e)
+	default:
+		errs.add("", ErrorCodeInvalid, "%s", err)
+	}
+}
+
+// unknownFactoryError is returned when a config names a factory that is not
+// registered.
+type unknownFactoryError string
+
+func (e unknownFactoryError) Error() string {
+	return fmt.Sprintf("unknown factory %q", string(e))
+}
+
+func (s *Slurpd) registerDataLoader(k string, l slurp.DataLoader, c ComponentConfig, replace bool) bool {
+	checkDataLoader(k, l)
+	if replace {
+		s.dataLoaders.set(k, l, c)
+	} else if !s.dataLoaders.add(k, l, c) {
+		return false
+	}
+	s.DataLoaderConcurrency(k, c.Concurrency)
+	return true
+}
+
+func (s *Slurpd) registerProducer(k string, p slurp.Producer, c ComponentConfig, replace bool) bool {
+	checkProducer(k, p)
+	if replace {
+		s.producers.set(k, p, c)
+	} else if !s.producers.add(k, p, c) {
+		return false
+	}
+	s.ProducerConcurrency(k, c.Concurrency)
+	return true
+}
+
+func (s *Slurpd) registerAnalyst(k string, a slurp.Analyst, c ComponentConfig, replace bool) (bool, error) {
+	checkAnalyst(k, a)
+	return s.putAnalyst(k, a, c, replace)
+}
+
+// newDataLoader creates a data loader from a factory. The data loader is
+// wrapped in a slurp.DataLoaderStatWrapper if need be.
+func newDataLoader(c ComponentConfig) (slurp.DataLoader, error) {
+	f, ok := dataLoaderFactory(c.Factory)
+	if !ok {
+		return nil, unknownFactoryError(c.Factory)
+	}
+	p, err := f.Params.Validate(c.Params)
+	if err != nil {
+		return nil, err
+	}
+	l, err := f.New(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.(*slurp.DataLoaderStatWrapper); !ok {
+		l = slurp.NewDataLoaderStatWrapper(l)
+	}
+	return l, nil
+}
+
+// newProducer creates a producer from a factory.
+func newProducer(c ComponentConfig) (slurp.Producer, error) {
+	f, ok := producerFactory(c.Factory)
+	if !ok {
+		return nil, unknownFactoryError(c.Factory)
+	}
+	p, err := f.Params.Validate(c.Params)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.New(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := r.(slurp.Describer); !ok {
+		return nil, fmt.Errorf("factory %q does not make a slurp.Describer", c.Factory)
+	}
+	return r, nil
+}
+
+// newAnalyst creates an analyst from a factory.
+func newAnalyst(c ComponentConfig, dataLoaders []slurp.DataLoader) (slurp.Analyst, error) {
+	f, ok := analystFactory(c.Factory)
+	if !ok {
+		return nil, unknownFactoryError(c.Factory)
+	}
+	p, err := f.Params.Validate(c.Params)
+	if err != nil {
+		return nil, err
+	}
+	a, err := f.New(p, dataLoaders)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := a.(slurp.Describer); !ok {
+		return nil, fmt.Errorf("factory %q does not make a slurp.Describer", c.Factory)
+	}
+	return a, nil
+}
+
+// sortedConfigKeys returns the keys of m in order so that errors are
+// reported in the same order every time.
+func sortedConfigKeys(m map[string]ComponentConfig) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,127 @@
+package slurpd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+func init() {
+	RegisterDataLoaderFactory("test", &DataLoaderFactory{
+		New: func(p slurp.Params) (slurp.DataLoader, error) {
+			return slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+				return "", nil
+			}), nil
+		},
+	})
+	RegisterProducerFactory("test", &ProducerFactory{
+		Params: slurp.ParamSchema{
+			{Name: "fail", Type: slurp.ParamBool, Default: false},
+		},
+		New: func(p slurp.Params) (slurp.Producer, error) {
+			if p.Bool("fail") {
+				return nil, errors.New("asked to fail")
+			}
+			return newGateProducer(), nil
+		},
+	})
+	RegisterAnalystFactory("test", &AnalystFactory{
+		Params: slurp.ParamSchema{
+			{Name: "threshold", Type: slurp.ParamInt, Required: true},
+			{Name: "window", Type: slurp.ParamDuration, Default: "1h"},
+		},
+		New: func(p slurp.Params, dataLoaders []slurp.DataLoader) (slurp.Analyst, error) {
+			return &testAnalyst{dataLoaders: dataLoaders}, nil
+		},
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{
+  "maxConcurrentJobs": 3,
+  "dataLoaders": {"cl": {"factory": "test", "concurrency": 2}},
+  "producers": {"cp": {"factory": "test"}},
+  "analysts": {"ca": {"factory": "test", "params": {"threshold": 3}, "dataLoaders": ["cl"]}},
+  "schedules": {"cs": {"cron": "@daily", "producer": "cp", "analyst": "ca", "time": "yesterday"}}
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSlurpd()
+	if err = s.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	l, ok := s.DataLoader("cl")
+	if !ok {
+		t.Fatalf("Expecting data loader %q to be registered.", "cl")
+	}
+	if _, ok = l.(*slurp.DataLoaderStatWrapper); !ok {
+		t.Errorf("Expecting data loader to be wrapped in a slurp.DataLoaderStatWrapper.")
+	}
+	if _, ok = s.Producer("cp"); !ok {
+		t.Errorf("Expecting producer %q to be registered.", "cp")
+	}
+	a, ok := s.Analyst("ca")
+	if !ok {
+		t.Fatalf("Expecting analyst %q to be registered.", "ca")
+	}
+	if got := a.(*testAnalyst).dataLoaders; len(got) != 1 || got[0] != l {
+		t.Errorf("Expecting analyst to use data loader %q.", "cl")
+	}
+	if _, ok = s.Schedule("cs"); !ok {
+		t.Errorf("Expecting schedule %q to be registered.", "cs")
+	}
+	if s.maxJobs != 3 || s.dataLoaderLimit["cl"] != 2 {
+		t.Errorf("Expecting concurrency limits to be set, got %d and %v.", s.maxJobs, s.dataLoaderLimit)
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	s := NewSlurpd()
+	s.RegisterProducer("p", newGateProducer())
+	c := &Config{
+		DataLoaders: map[string]ComponentConfig{
+			"l1": {Factory: "nope"},
+			"l2": {Factory: "test", Concurrency: -1},
+		},
+		Producers: map[string]ComponentConfig{
+			"p":  {Factory: "test"},
+			"p2": {Factory: "test", Params: slurp.Params{"fail": true}},
+		},
+		Analysts: map[string]ComponentConfig{
+			"a":  {Factory: "test", DataLoaders: []string{"l2", "l3"}},
+			"a2": {Factory: "test", Params: slurp.Params{"window": 5, "x": 1}},
+		},
+		Schedules: ScheduleMapDTO{
+			"s": {Cron: "bad", Producer: "p", Analyst: "x", Time: "now"},
+		},
+	}
+	err := s.ApplyConfig(c)
+	var ce ConfigError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Expecting a ConfigError, got %v.", err)
+	}
+	want := ConfigError{
+		`data loader "l1": unknown factory "nope"`,
+		`data loader "l2": concurrency must not be negative`,
+		`producer "p": already registered`,
+		`producer "p2": asked to fail`,
+		`analyst "a": unknown data loader "l3"`,
+		`analyst "a2": parameter "threshold": is required`,
+		`analyst "a2": parameter "window": expecting a duration such as "1m30s"`,
+		`analyst "a2": parameter "x": is not a known parameter`,
+		`schedule "s": expecting 5 fields in cron expression "bad", got 1`,
+		`schedule "s": unknown analyst "x"`,
+	}
+	if !reflect.DeepEqual(ce, want) {
+		t.Errorf("Unexpected config errors.\nGot:\n%s\nWant:\n%s", ce, want)
+	}
+	if _, ok := s.DataLoader("l2"); ok {
+		t.Errorf("Expecting nothing to be registered from an invalid config.")
+	}
+}
@@ -0,0 +1,142 @@
+package slurpd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression with the usual five fields:
+// minute, hour, day of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a cron expression. Each field can be "*", a number, a
+// range "a-b", a list "a,b" and have a step "/n". Day of week runs from 0
+// (Sunday) to 7 (also Sunday).
+func parseCron(expr string) (*cronSchedule, error) {
+	if m, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("expecting 5 fields in cron expression %q, got %d", expr, len(f))
+	}
+	var (
+		c   cronSchedule
+		err error
+	)
+	if c.minute, err = parseCronField(f[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(f[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(f[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	// As with Vixie cron, a field starting with * such as */2 does not
+	// restrict the day, so both day fields have to match.
+	c.domAny = strings.HasPrefix(f[2], "*")
+	c.dowAny = strings.HasPrefix(f[4], "*")
+	return &c, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			r := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(r[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			hi = lo
+			if len(r) == 2 {
+				if hi, err = strconv.Atoi(r[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in cron field %q", field)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron field %q is out of range %d-%d", field, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// matchDay tells us if the schedule runs on the day of t. As with cron, when
+// both day of month and day of week are restricted either can match.
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that the schedule runs, in the
+// location of t. The zero time is returned if there is no such time within
+// five years.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,47 @@
+package slurpd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2015, 6, 1, 10, 30, 15, 0, time.UTC) // Monday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2015, 6, 1, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2015, 6, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2015, 6, 2, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2015, 6, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2015, 6, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2015, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2015, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2015, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 3", time.Date(2015, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * 1", time.Date(2015, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */3", time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("Expecting %q to parse, got %s.", test.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(test.want) {
+			t.Errorf("Expecting %q to next run at %s, got %s.", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expecting %q to be invalid.", expr)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package slurpd
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardHandler serves the web dashboard. The dashboard expects the HTTP
+// API to be at api/ and the metrics at metrics relative to where it is
+// served from. The files themselves are served to anyone, when the API
+// needs credentials the dashboard asks for a bearer token and sends it in
+// the Authorization header and the BearerTokenCookie.
+func DashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		log.Panicln(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,378 @@
+// Slurpd dashboard. Talks to the HTTP API at api/ relative to this page.
+(function () {
+	"use strict";
+
+	var sparkPoints = 60;
+	var rates = {};
+	var analysts = {};
+	var recentCalls = {};
+	var events = null;
+
+	// token is the API token, when the HTTP API needs one. It is kept for
+	// the session and also set as a cookie, which the API only reads for GET
+	// requests, because an EventSource can not send an Authorization header.
+	var token = sessionStorage.getItem("slurpd_token") || "";
+
+	function setToken(t) {
+		token = t;
+		sessionStorage.setItem("slurpd_token", t);
+		document.cookie = "slurpd_token=" + t + "; SameSite=Strict" + (location.protocol === "https:" ? "; Secure" : "");
+	}
+
+	function el(tag, attrs) {
+		var e = document.createElement(tag);
+		Object.keys(attrs || {}).forEach(function (k) {
+			if (k === "text") {
+				e.textContent = attrs[k];
+			} else if (k === "className") {
+				e.className = attrs[k];
+			} else {
+				e.setAttribute(k, attrs[k]);
+			}
+		});
+		for (var i = 2; i < arguments.length; i++) {
+			if (arguments[i] !== null && arguments[i] !== undefined) {
+				e.appendChild(typeof arguments[i] === "string" ? document.createTextNode(arguments[i]) : arguments[i]);
+			}
+		}
+		return e;
+	}
+
+	function clear(e) {
+		while (e.firstChild) {
+			e.removeChild(e.firstChild);
+		}
+		return e;
+	}
+
+	// api calls the HTTP API. Errors are thrown as the error envelope.
+	function api(path, opts) {
+		opts = opts || {};
+		opts.headers = {"Accept": "application/json"};
+		if (token) {
+			opts.headers.Authorization = "Bearer " + token;
+		}
+		return fetch("api" + path, opts).then(function (res) {
+			if (res.status === 204) {
+				return null;
+			}
+			if (res.status === 401) {
+				document.getElementById("signin").hidden = false;
+			}
+			return res.json().then(function (body) {
+				if (!res.ok) {
+					throw body.error || {code: "internal_error", message: res.statusText};
+				}
+				return body;
+			});
+		});
+	}
+
+	function fmtTime(t) {
+		if (!t) {
+			return "";
+		}
+		return new Date(t).toLocaleString();
+	}
+
+	// fmtDuration formats a duration in nanoseconds.
+	function fmtDuration(ns) {
+		if (!ns) {
+			return "0";
+		}
+		var units = [["h", 3600e9], ["m", 60e9], ["s", 1e9], ["ms", 1e6], ["µs", 1e3]];
+		for (var i = 0; i < units.length; i++) {
+			if (ns >= units[i][1]) {
+				return (ns / units[i][1]).toFixed(ns >= 10 * units[i][1] ? 0 : 1) + units[i][0];
+			}
+		}
+		return ns + "ns";
+	}
+
+	function sparkline(values) {
+		var w = 160, h = 28;
+		var svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+		svg.setAttribute("class", "sparkline");
+		svg.setAttribute("width", w);
+		svg.setAttribute("height", h);
+		var max = Math.max.apply(null, values.concat([1]));
+		var points = values.map(function (v, i) {
+			return (i * w / (sparkPoints - 1)).toFixed(1) + "," + (h - 1 - v / max * (h - 2)).toFixed(1);
+		});
+		var line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+		line.setAttribute("points", points.join(" "));
+		svg.appendChild(line);
+		var title = document.createElementNS("http://www.w3.org/2000/svg", "title");
+		title.textContent = (values[values.length - 1] || 0).toFixed(1) + " items/s";
+		svg.appendChild(title);
+		return svg;
+	}
+
+	function setStatus(text, down) {
+		var s = document.getElementById("status");
+		s.textContent = text;
+		s.className = down ? "status down" : "status";
+	}
+
+	function loadComponents() {
+		return Promise.all([api("/producers"), api("/analysts")]).then(function (r) {
+			var form = document.getElementById("launch");
+			[["producers", r[0], form.producer], ["analysts", r[1], form.analyst]].forEach(function (v) {
+				var dl = clear(document.getElementById(v[0]));
+				var selected = v[2].value;
+				clear(v[2]);
+				Object.keys(v[1]).sort().forEach(function (k) {
+					dl.appendChild(el("dt", {text: k + " - " + v[1][k].name}));
+					dl.appendChild(el("dd", {text: v[1][k].description}));
+					v[2].appendChild(el("option", {value: k, text: k}));
+				});
+				if (selected) {
+					v[2].value = selected;
+				}
+			});
+			analysts = r[1];
+			showParamHint();
+		});
+	}
+
+	function loadJobs() {
+		return api("/jobs").then(function (jobs) {
+			var body = clear(document.querySelector("#jobs tbody"));
+			var order = {running: 0, queued: 1, completed: 2, cancelled: 2};
+			Object.keys(jobs).sort(function (a, b) {
+				var ja = jobs[a], jb = jobs[b];
+				if (order[ja.state] !== order[jb.state]) {
+					return order[ja.state] - order[jb.state];
+				}
+				return new Date(jb.queued) - new Date(ja.queued);
+			}).forEach(function (k) {
+				var j = jobs[k];
+				body.appendChild(el("tr", {},
+					el("td", {}, el("code", {text: k})),
+					el("td", {text: j.state + (j.position ? " (#" + j.position + ")" : "")}),
+					el("td", {text: j.producer}),
+					el("td", {className: "num", text: String(j.priority)}),
+					el("td", {text: fmtTime(j.queued)}),
+					el("td", {text: fmtTime(j.started)}),
+					el("td", {text: fmtTime(j.finished)}),
+					el("td", {}, el("a", {href: "api/jobs/" + encodeURIComponent(k) + "/results", text: "results"}),
+						j.finished ? null : cancelButton(k))
+				));
+			});
+		});
+	}
+
+	function cancelButton(k) {
+		var b = el("button", {type: "button", className: "cancel", text: "cancel"});
+		b.addEventListener("click", function () {
+			b.disabled = true;
+			api("/jobs/" + encodeURIComponent(k) + "/cancel", {method: "POST"}).then(loadJobs, function (err) {
+				setStatus("Job " + k + ": " + err.message, true);
+			});
+		});
+		return b;
+	}
+
+	function loadLoaders() {
+		return api("/data-loaders").then(function (loaders) {
+			var body = clear(document.querySelector("#loaders tbody"));
+			Object.keys(loaders).sort().forEach(function (k) {
+				var st = loaders[k].stat;
+				if (!st) {
+					body.appendChild(el("tr", {}, el("td", {text: k}), el("td", {colspan: 9, className: "empty", text: "No stats"})));
+					return;
+				}
+				var c = st.called;
+				body.appendChild(el("tr", {},
+					el("td", {text: k}),
+					el("td", {className: "num", text: String(c.count)}),
+					el("td", {className: "num", text: String(recentCalls[k] || 0)}),
+					el("td", {className: "num", text: fmtDuration(c.durationAvg)}),
+					el("td", {className: "num", text: fmtDuration(c.percentile.p50)}),
+					el("td", {className: "num", text: fmtDuration(c.percentile.p90)}),
+					el("td", {className: "num", text: fmtDuration(c.percentile.p99)}),
+					el("td", {className: "num", text: fmtDuration(c.durationMax)}),
+					el("td", {className: "num", text: String(st.returnEmptyKey.count)}),
+					el("td", {className: "num", text: String(st.returnNilData.count)})
+				));
+			});
+		});
+	}
+
+	function showProgress(p) {
+		var section = document.getElementById("running");
+		var jobs = section.querySelector(".jobs");
+		var card = document.getElementById("job-" + p.job);
+		if (!card) {
+			card = el("div", {className: "job", id: "job-" + p.job});
+			jobs.appendChild(card);
+		}
+		section.querySelector(".empty").style.display = "none";
+
+		var r = rates[p.job] = (rates[p.job] || []).concat([p.stat.rate]).slice(-sparkPoints);
+		clear(card).appendChild(el("h3", {},
+			el("code", {text: p.job}),
+			el("span", {className: "meta", text: p.stat.count + " items, " + p.progress.percent.toFixed(1) + "%" +
+				(p.progress.eta ? ", eta " + fmtTime(p.progress.eta) : "") +
+				(p.bottleneck ? ", bottleneck " + p.bottleneck : "")}),
+			sparkline(r)
+		));
+		p.analysisRequest.forEach(function (ar) {
+			var pct = Math.max(0, Math.min(100, ar.progress.percent));
+			card.appendChild(el("div", {className: "request" + (ar.bottleneck ? " bottleneck" : "")},
+				el("span", {text: ar.analyst}),
+				el("div", {className: "bar", title: fmtTime(ar.range.from) + " - " + fmtTime(ar.range.until)},
+					el("div", {style: "width: " + pct.toFixed(1) + "%"})),
+				el("span", {className: "num", text: pct.toFixed(1) + "%"}),
+				el("span", {className: "meta", text: ar.stat.count + " items"})
+			));
+		});
+	}
+
+	function removeProgress(k) {
+		var card = document.getElementById("job-" + k);
+		if (card) {
+			card.parentNode.removeChild(card);
+		}
+		delete rates[k];
+		var section = document.getElementById("running");
+		if (!section.querySelector(".job")) {
+			section.querySelector(".empty").style.display = "";
+		}
+	}
+
+	function connect() {
+		if (events) {
+			events.close();
+		}
+		var es = events = new EventSource("api/events?interval=1s");
+		es.onopen = function () {
+			setStatus("Live");
+		};
+		es.onerror = function () {
+			setStatus("Disconnected, retrying", true);
+		};
+		es.addEventListener("progress", function (e) {
+			showProgress(JSON.parse(e.data));
+		});
+		es.addEventListener("loaders", function (e) {
+			recentCalls = {};
+			var d = JSON.parse(e.data);
+			Object.keys(d).forEach(function (k) {
+				recentCalls[k] = d[k].called;
+			});
+			loadLoaders();
+		});
+		["queued", "started"].forEach(function (t) {
+			es.addEventListener(t, loadJobs);
+		});
+		es.addEventListener("finished", function (e) {
+			removeProgress(JSON.parse(e.data).job);
+			loadJobs();
+			loadLoaders();
+		});
+		es.addEventListener("error", function (e) {
+			if (e.data) {
+				var d = JSON.parse(e.data);
+				setStatus("Job " + d.job + ": " + d.error, true);
+			}
+		});
+	}
+
+	function showParamHint() {
+		var form = document.getElementById("launch");
+		var a = analysts[form.analyst.value];
+		var hint = form.querySelector(".hint");
+		if (!a || !a.requestParams || !a.requestParams.length) {
+			hint.textContent = "This analyst takes no params.";
+			return;
+		}
+		hint.textContent = "Params: " + a.requestParams.map(function (p) {
+			return p.name + " (" + p.type + (p.required ? ", required" : "") + ")" + (p.description ? " " + p.description : "");
+		}).join("; ");
+	}
+
+	function showKind() {
+		var form = document.getElementById("launch");
+		var point = form.kind.value === "point";
+		form.querySelectorAll(".point").forEach(function (e) {
+			e.style.display = point ? "" : "none";
+		});
+		form.querySelectorAll(".range").forEach(function (e) {
+			e.style.display = point ? "none" : "";
+		});
+	}
+
+	function localTime(v) {
+		return v ? new Date(v).toISOString() : "";
+	}
+
+	function launch(e) {
+		e.preventDefault();
+		var form = e.target;
+		var errors = clear(form.querySelector(".errors"));
+		var params;
+		try {
+			params = form.params.value.trim() ? JSON.parse(form.params.value) : undefined;
+		} catch (err) {
+			errors.appendChild(el("li", {text: "params: " + err.message}));
+			return;
+		}
+		var missing = (form.kind.value === "point" ? ["time"] : ["from", "until"]).filter(function (k) {
+			return !form[k].value;
+		});
+		if (missing.length) {
+			missing.forEach(function (k) {
+				errors.appendChild(el("li", {text: k + ": is required"}));
+			});
+			return;
+		}
+		var req = {producer: form.producer.value, priority: parseInt(form.priority.value, 10) || 0};
+		if (form.kind.value === "point") {
+			req.pointInTimeAnalysis = [{analyst: form.analyst.value, time: localTime(form.time.value), params: params}];
+		} else {
+			req.rangeAnalysis = [{analyst: form.analyst.value, from: localTime(form.from.value), until: localTime(form.until.value), params: params}];
+		}
+		api("/analysis-request", {method: "POST", body: JSON.stringify(req)}).then(function (r) {
+			errors.appendChild(el("li", {className: "ok", text: "Queued job " + r.job + "."}));
+			loadJobs();
+		}, function (err) {
+			errors.appendChild(el("li", {text: err.message}));
+			(err.details || []).forEach(function (d) {
+				errors.appendChild(el("li", {text: (d.field ? d.field + ": " : "") + d.message}));
+			});
+		});
+	}
+
+	function start() {
+		Promise.all([loadComponents(), loadJobs(), loadLoaders()]).then(function () {
+			connect();
+		}, function (err) {
+			setStatus(err.message || String(err), true);
+		});
+	}
+
+	function signIn(e) {
+		e.preventDefault();
+		setToken(e.target.token.value.trim());
+		e.target.reset();
+		e.target.hidden = true;
+		start();
+	}
+
+	document.addEventListener("DOMContentLoaded", function () {
+		var form = document.getElementById("launch");
+		form.addEventListener("submit", launch);
+		form.analyst.addEventListener("change", showParamHint);
+		form.kind.addEventListener("change", showKind);
+		document.getElementById("signin").addEventListener("submit", signIn);
+		showKind();
+		if (token) {
+			setToken(token);
+		}
+		start();
+		setInterval(function () {
+			loadJobs().catch(function () {});
+		}, 10000);
+	});
+}());
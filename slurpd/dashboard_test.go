@@ -0,0 +1,32 @@
+package slurpd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	h := DashboardHandler()
+	external := regexp.MustCompile(`(src|href)="(https?:)?//`)
+	for path, ct := range map[string]string{
+		"/":              "text/html",
+		"/dashboard.js":  "javascript",
+		"/dashboard.css": "text/css",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: Expecting status 200, got %d.", path, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); !strings.Contains(got, ct) {
+			t.Errorf("%s: Expecting a content type of %s, got %q.", path, ct, got)
+		}
+		if external.MatchString(w.Body.String()) {
+			t.Errorf("%s: Expecting no external assets.", path)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package slurpd
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// drainingError is returned for jobs submitted once Drain has been called.
+func drainingError() *APIError {
+	return NewAPIError(http.StatusServiceUnavailable, ErrorCodeUnavailable, "slurpd is shutting down and is not accepting jobs")
+}
+
+// Drain stops slurpd accepting jobs and waits for the running jobs to
+// finish. Once ctx is done the jobs that are still running are cancelled and
+// Drain waits for them to analyse the items that they have already taken.
+// Queued jobs that are kept in the job queue file stay queued, and the jobs
+// cancelled here are kept in it too along with a checkpoint of how far they
+// had got, so that they resume after a restart. Other queued jobs are
+// cancelled straight away.
+//
+// Event streams are ended once Drain returns. The keys of the running jobs
+// that had to be cancelled are returned.
+func (s *Slurpd) Drain(ctx context.Context) []string {
+	s.jobMutex.Lock()
+	s.draining = true
+	running := make(map[string]*slurperMapItem)
+	for k, job := range s.slurperMap {
+		switch {
+		case job.state == jobRunning:
+			running[k] = job
+		case job.state == jobQueued && !s.keepsJob(job):
+			job.cancelled = true
+			job.cancel()
+			s.finishJob(k, job)
+			close(job.done)
+		}
+	}
+	s.unlockJobs()
+
+	for _, job := range running {
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+		}
+	}
+	var cancelled []string
+	s.jobMutex.Lock()
+	for k, job := range running {
+		if job.finished == nil && !job.cancelled {
+			job.cancelled = true
+			job.interrupted = s.keepsJob(job)
+			job.cancel()
+			cancelled = append(cancelled, k)
+		}
+	}
+	s.unlockJobs()
+	for _, job := range running {
+		<-job.done
+	}
+	sort.Strings(cancelled)
+	s.drainOnce.Do(func() {
+		close(s.drained)
+	})
+	return cancelled
+}
+
+// keepsJob tells us if job is kept in the job queue file. The caller must
+// hold jobMutex.
+func (s *Slurpd) keepsJob(job *slurperMapItem) bool {
+	return s.queueFile != "" && job.request != nil
+}
@@ -0,0 +1,119 @@
+package slurpd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDrain(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	k1, err := s.SubmitJob(testJobRequest("a", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := s.SubmitJob(testJobRequest("a", t2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+
+	// Event streams end once draining has finished.
+	router := ConfigureRouter(s, mux.NewRouter())
+	streamDone := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil))
+		close(streamDone)
+	}()
+
+	// A running job that finishes in time is left to complete.
+	drained := make(chan []string)
+	go func() {
+		drained <- s.Drain(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.SubmitJob(testJobRequest("a", t2, 0)); err == nil || err.(*APIError).Status != http.StatusServiceUnavailable {
+		t.Errorf("Expecting jobs to be turned away while draining, got %v.", err)
+	}
+	if k, err := s.StartSlurpAnalysisRequest(p, (&testAnalyst{}).AnalysisRequest(t2)); k != "" || err == nil || err.(*APIError).Status != http.StatusServiceUnavailable {
+		t.Errorf("Expecting no job while draining, got %q %v.", k, err)
+	}
+	p.release <- struct{}{}
+	if cancelled := <-drained; len(cancelled) != 0 {
+		t.Errorf("Expecting no jobs to be cancelled, got %v.", cancelled)
+	}
+	p.expectNoStart(t)
+	jobs := s.jobStatus()
+	if jobs[k1].State != jobCompleted || jobs[k2].State != jobCancelled {
+		t.Errorf("Expecting the running job to complete and the queued job to be cancelled, got %+v.", jobs)
+	}
+	select {
+	case <-streamDone:
+	case <-time.After(time.Second):
+		t.Errorf("Expecting the event stream to end.")
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	if err := s.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	k1, err := s.SubmitJob(testJobRequest("a", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := s.SubmitJob(testJobRequest("a", t2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k3, err := s.StartSlurpAnalysisRequest(p, (&testAnalyst{}).AnalysisRequest(t2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if cancelled := s.Drain(ctx); len(cancelled) != 1 || cancelled[0] != k1 {
+		t.Errorf("Expecting job %q to be cancelled, got %v.", k1, cancelled)
+	}
+	jobs := s.jobStatus()
+	if jobs[k1].State != jobCancelled || jobs[k2].State != jobQueued || jobs[k3].State != jobCancelled {
+		t.Errorf("Expecting only the job kept in the queue file to stay queued, got %+v.", jobs)
+	}
+
+	// The cancelled and queued jobs run again after a restart.
+	p2 := newGateProducer()
+	s2 := newTestSlurpd(p2)
+	if err := s2.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	jobs = s2.jobStatus()
+	if len(jobs) != 2 || jobs[k1].State != jobRunning || jobs[k2].State != jobRunning {
+		t.Errorf("Expecting jobs %q and %q to be restored, got %+v.", k1, k2, jobs)
+	}
+	p.release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		<-p2.started
+		p2.release <- struct{}{}
+	}
+	for _, k := range []string{k1, k2} {
+		job, _ := s2.job(k)
+		<-job.done
+	}
+}
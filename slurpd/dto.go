@@ -11,8 +11,12 @@ type AnalystMapDTO map[string]AnalystDTO
 
 // AnalystDTO provides basic information for an Analyst.
 type AnalystDTO struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Factory       string            `json:"factory,omitempty"`
+	Params        slurp.Params      `json:"params,omitempty"`
+	DataLoaders   []string          `json:"dataLoaders,omitempty"`
+	RequestParams slurp.ParamSchema `json:"requestParams,omitempty"`
 }
 
 // DataLoaderMapDTO is a map of DataLoaderDTO instances.
@@ -22,6 +26,8 @@ type DataLoaderMapDTO map[string]DataLoaderDTO
 type DataLoaderDTO struct {
 	Name        string                `json:"name"`
 	Description string                `json:"description"`
+	Factory     string                `json:"factory,omitempty"`
+	Params      slurp.Params          `json:"params,omitempty"`
 	Stat        *slurp.DataLoaderStat `json:"stat,omitempty"`
 }
 
@@ -30,8 +36,20 @@ type ProducerMapDTO map[string]ProducerDTO
 
 // ProducerDTO provides basic information for a Producer.
 type ProducerDTO struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Factory     string       `json:"factory,omitempty"`
+	Params      slurp.Params `json:"params,omitempty"`
+}
+
+// FactoryMapDTO is a map of FactoryDTO instances.
+type FactoryMapDTO map[string]FactoryDTO
+
+// FactoryDTO describes a component factory and the parameters it takes.
+type FactoryDTO struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Params      slurp.ParamSchema `json:"params"`
 }
 
 // SlurperMapDTO is a map of SlurperDTO instances.
@@ -41,14 +59,28 @@ type SlurperMapDTO map[string]SlurperDTO
 type SlurperDTO struct {
 	Started         time.Time             `json:"started"`
 	Stat            slurp.ItemChannelStat `json:"stat"`
+	Range           TimeRangeDTO          `json:"range"`
+	Progress        ProgressDTO           `json:"progress"`
+	LoadDuration    time.Duration         `json:"loadDuration"`
+	Bottleneck      string                `json:"bottleneck,omitempty"`
 	AnalysisRequest []AnalysisRequestDTO  `json:"analysisRequest"`
 }
 
+// JobProgressDTO is a SlurperDTO for a job.
+type JobProgressDTO struct {
+	Job string `json:"job"`
+	SlurperDTO
+}
+
 // AnalysisRequestDTO provides basic information for an AnalysisRequest.
 type AnalysisRequestDTO struct {
-	Analyst string                `json:"analyst"`
-	Range   TimeRangeDTO          `json:"range"`
-	Stat    slurp.ItemChannelStat `json:"stat"`
+	Analyst    string                `json:"analyst"`
+	Range      TimeRangeDTO          `json:"range"`
+	Params     slurp.Params          `json:"params,omitempty"`
+	Stat       slurp.ItemChannelStat `json:"stat"`
+	Progress   ProgressDTO           `json:"progress"`
+	Blocked    time.Duration         `json:"blocked"`
+	Bottleneck bool                  `json:"bottleneck"`
 }
 
 // TimeRangeDTO provides a from and until time.
@@ -56,3 +88,135 @@ type TimeRangeDTO struct {
 	From  time.Time `json:"from"`
 	Until time.Time `json:"until"`
 }
+
+// AnalysisRangeRequestDTO asks for the time range that an analyst would
+// analyse for a point in time.
+type AnalysisRangeRequestDTO struct {
+	Analyst string    `json:"analyst"`
+	Time    time.Time `json:"time"`
+}
+
+// AnalysisRangeDTO is the time range that an analyst would analyse.
+type AnalysisRangeDTO struct {
+	TimeFrom  time.Time `json:"timeFrom"`
+	TimeUntil time.Time `json:"timeUntil"`
+}
+
+// JobDTO identifies a job.
+type JobDTO struct {
+	Job string `json:"job"`
+}
+
+// JobResultsDTO provides a page of analysis results for a job.
+type JobResultsDTO struct {
+	Job      string                  `json:"job"`
+	Finished bool                    `json:"finished"`
+	Offset   int                     `json:"offset"`
+	Limit    int                     `json:"limit"`
+	Results  []*slurp.AnalysisResult `json:"results"`
+}
+
+// JobRequestDTO describes the analysis wanted from a job. Jobs are queued
+// and kept in this form so that they can be persisted.
+type JobRequestDTO struct {
+	Producer            string                   `json:"producer"`
+	Priority            int                      `json:"priority,omitempty"`
+	PointInTimeAnalysis []PointInTimeAnalysisDTO `json:"pointInTimeAnalysis"`
+	RangeAnalysis       []RangeAnalysisDTO       `json:"rangeAnalysis"`
+}
+
+// PointInTimeAnalysisDTO asks an analyst to analyse a point in time.
+type PointInTimeAnalysisDTO struct {
+	Analyst string       `json:"analyst"`
+	Time    time.Time    `json:"time"`
+	Params  slurp.Params `json:"params,omitempty"`
+}
+
+// RangeAnalysisDTO asks an analyst to analyse a time range.
+type RangeAnalysisDTO struct {
+	Analyst string       `json:"analyst"`
+	From    time.Time    `json:"from"`
+	Until   time.Time    `json:"until"`
+	Params  slurp.Params `json:"params,omitempty"`
+}
+
+// JobMapDTO is a map of JobStatusDTO instances.
+type JobMapDTO map[string]JobStatusDTO
+
+// JobStatusDTO provides the state of a job.
+type JobStatusDTO struct {
+	State    string     `json:"state"`
+	Priority int        `json:"priority"`
+	Producer string     `json:"producer"`
+	Identity *Identity  `json:"identity,omitempty"`
+	Position int        `json:"position,omitempty"`
+	Queued   time.Time  `json:"queued"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// JobEventDTO describes a change to a job.
+type JobEventDTO struct {
+	Job      string    `json:"job"`
+	State    string    `json:"state"`
+	Producer string    `json:"producer"`
+	Time     time.Time `json:"time"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// DataLoaderDeltaMapDTO is a map of DataLoaderDeltaDTO instances.
+type DataLoaderDeltaMapDTO map[string]DataLoaderDeltaDTO
+
+// DataLoaderDeltaDTO provides what a DataLoader has done over a period of
+// time.
+type DataLoaderDeltaDTO struct {
+	Called         int64         `json:"called"`
+	ReturnEmptyKey int64         `json:"returnEmptyKey"`
+	ReturnNilData  int64         `json:"returnNilData"`
+	ReturnData     int64         `json:"returnData"`
+	DurationTotal  time.Duration `json:"durationTotal"`
+	DurationAvg    time.Duration `json:"durationAvg"`
+}
+
+// ScheduleMapDTO is a map of ScheduleDTO instances.
+type ScheduleMapDTO map[string]ScheduleDTO
+
+// ScheduleDTO describes a recurring point in time analysis. Cron is a cron
+// expression that is worked out in UTC and Time is a time expression such as
+// "yesterday 00:00 UTC".
+type ScheduleDTO struct {
+	Cron      string       `json:"cron"`
+	Location  string       `json:"location,omitempty"`
+	Producer  string       `json:"producer"`
+	Analyst   string       `json:"analyst"`
+	Time      string       `json:"time"`
+	Params    slurp.Params `json:"params,omitempty"`
+	Priority  int          `json:"priority,omitempty"`
+	Paused    bool         `json:"paused"`
+	LastRun   *time.Time   `json:"lastRun,omitempty"`
+	LastJob   string       `json:"lastJob,omitempty"`
+	LastError string       `json:"lastError,omitempty"`
+	NextRun   *time.Time   `json:"nextRun,omitempty"`
+}
+
+// AuditEntryDTO is an entry in the audit log. Request is the body of the
+// request that was acted on, such as a JobRequestDTO for a job.submit.
+type AuditEntryDTO struct {
+	Time      time.Time   `json:"time"`
+	Action    string      `json:"action"`
+	Identity  *Identity   `json:"identity,omitempty"`
+	Job       string      `json:"job,omitempty"`
+	State     string      `json:"state,omitempty"`
+	Producer  string      `json:"producer,omitempty"`
+	Component string      `json:"component,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Request   interface{} `json:"request,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// AuditDTO provides a page of audit log entries, newest first.
+type AuditDTO struct {
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Entries []AuditEntryDTO `json:"entries"`
+}
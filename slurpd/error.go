@@ -0,0 +1,260 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// Error codes used in error responses. The codes that describe a problem
+// with a single field are used in the details of a validation error.
+const (
+	ErrorCodeInvalidJSON      = "invalid_json"
+	ErrorCodeValidation       = "validation_failed"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeInternal         = "internal_error"
+	ErrorCodeUnavailable      = "unavailable"
+	ErrorCodeRequired         = "required"
+	ErrorCodeUnknown          = "unknown"
+	ErrorCodeInvalid          = "invalid"
+)
+
+// ErrorDTO is the body of every error response.
+type ErrorDTO struct {
+	Error *APIError `json:"error"`
+}
+
+// APIError describes why a request failed. Field names the part of the
+// request that was wrong and Details lists every problem found when a
+// request is not valid.
+type APIError struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"`
+	Details []*APIError `json:"details,omitempty"`
+}
+
+// NewAPIError returns an *APIError for an HTTP status.
+func NewAPIError(status int, code string, format string, a ...interface{}) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func (e *APIError) Error() string {
+	if e.Field != "" {
+		return e.Field + ": " + e.Message
+	}
+	return e.Message
+}
+
+// ValidationError lists every problem found with a request.
+type ValidationError []*APIError
+
+func (e ValidationError) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// add records a problem with field.
+func (e *ValidationError) add(field string, code string, format string, a ...interface{}) {
+	*e = append(*e, &APIError{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+		Field:   field,
+	})
+}
+
+// addParams records the problems in a slurp.ParamErrors, or err itself,
+// against the params at field.
+func (e *ValidationError) addParams(field string, err error) {
+	pe, ok := err.(slurp.ParamErrors)
+	if !ok {
+		e.add(field, ErrorCodeInvalid, "%s", err)
+		return
+	}
+	for _, v := range pe {
+		code := ErrorCodeInvalid
+		switch v.Message {
+		case slurp.ParamRequired:
+			code = ErrorCodeRequired
+		case slurp.ParamUnknown:
+			code = ErrorCodeUnknown
+		}
+		e.add(field+"."+v.Param, code, "%s", v.Message)
+	}
+}
+
+// err returns nil when there are no problems.
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// apiError works out the *APIError to send for err.
+func apiError(err error) *APIError {
+	switch e := err.(type) {
+	case *APIError:
+		if e.Status == 0 {
+			r := *e
+			r.Status = http.StatusBadRequest
+			return &r
+		}
+		return e
+	case ValidationError:
+		return &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidation,
+			Message: "the request is not valid",
+			Details: e,
+		}
+	}
+	return NewAPIError(http.StatusInternalServerError, ErrorCodeInternal, "internal server error")
+}
+
+// decodeJSON decodes the next JSON value from d in to v.
+func decodeJSON(d *json.Decoder, v interface{}) error {
+	if err := d.Decode(v); err != nil {
+		return NewAPIError(http.StatusBadRequest, ErrorCodeInvalidJSON, "unable to decode JSON: %s", err)
+	}
+	return nil
+}
+
+// unknownError is returned when the thing a request is about does not exist.
+func unknownError(kind string, k string) *APIError {
+	return NewAPIError(http.StatusNotFound, ErrorCodeNotFound, "unknown %s %q", kind, k)
+}
+
+// WriteError sends err to the client. A ValidationError is sent as a 400
+// with each problem in the details, an *APIError as it is and anything else
+// as a 500 without giving the reason away. JSON is sent unless the client
+// only accepts text/plain.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e := apiError(err)
+	log.Printf("%s %s: %s.\n", r.Method, r.URL.Path, err)
+	if !acceptsJSON(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(e.Status)
+		fmt.Fprintf(w, "%s: %s\n", e.Code, e.Message)
+		for _, d := range e.Details {
+			fmt.Fprintf(w, "  %s\n", d)
+		}
+		return
+	}
+	data, _ := json.MarshalIndent(ErrorDTO{Error: e}, "", "  ")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.Status)
+	w.Write(data)
+}
+
+// acceptsJSON tells us if JSON can be sent to the client. Only a client
+// that weights text/plain above JSON is sent text.
+func acceptsJSON(r *http.Request) bool {
+	return negotiate(r, "application/json", "text/plain") != "text/plain"
+}
+
+// mediaRange is a media range from an Accept header along with its weight.
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// negotiate picks the offered media type that the Accept header of r weights
+// highest. A type's weight comes from the most specific media range that
+// matches it, so a range with q=0 makes the types that it matches
+// unacceptable. When weights are the same the type matched by the more
+// specific range, then by the range listed first, then the earlier offer
+// wins. The first offer is picked when there is no Accept header and "" when
+// none of the offers are acceptable.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+	var ranges []mediaRange
+	for _, a := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(a))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if mt == "*" {
+			mt = "*/*"
+		}
+		t, st := splitMediaType(mt)
+		ranges = append(ranges, mediaRange{typ: t, subtype: st, q: q})
+	}
+	var (
+		best      string
+		bestQ     float64
+		bestSpec  int
+		bestRange int
+	)
+	for _, offer := range offers {
+		t, st := splitMediaType(offer)
+		q, spec, index := 0.0, 0, 0
+		for i, mr := range ranges {
+			s := 0
+			switch {
+			case mr.typ == t && mr.subtype == st:
+				s = 3
+			case mr.typ == t && mr.subtype == "*":
+				s = 2
+			case mr.typ == "*" && mr.subtype == "*":
+				s = 1
+			}
+			if s > spec {
+				q, spec, index = mr.q, s, i
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if best == "" || q > bestQ || q == bestQ && (spec > bestSpec || spec == bestSpec && index < bestRange) {
+			best, bestQ, bestSpec, bestRange = offer, q, spec, index
+		}
+	}
+	return best
+}
+
+func splitMediaType(mt string) (string, string) {
+	if i := strings.IndexByte(mt, '/'); i >= 0 {
+		return mt[:i], mt[i+1:]
+	}
+	return mt, ""
+}
+
+// notFoundHandler and methodNotAllowedHandler send routing errors in the
+// same form as every other error.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, NewAPIError(http.StatusNotFound, ErrorCodeNotFound, "nothing is at %s", r.URL.Path))
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, NewAPIError(http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "%s is not allowed for %s", r.Method, r.URL.Path))
+}
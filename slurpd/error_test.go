@@ -0,0 +1,230 @@
+package slurpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// failingResultStore fails to read results.
+type failingResultStore struct {
+	*slurp.MemoryResultStore
+}
+
+func (rs *failingResultStore) Results(job string, offset int, limit int) ([]*slurp.AnalysisResult, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func TestHTTPErrors(t *testing.T) {
+	s := newTestSlurpd(newGateProducer())
+	if err := s.CreateAnalyst("used", ComponentConfig{Factory: "test", Params: slurp.Params{"threshold": 1}, DataLoaders: []string{"l"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	router := ConfigureRouter(s, mux.NewRouter())
+
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		status  int
+		code    string
+		details []string
+	}{
+		{"GET", "/nope", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"DELETE", "/analysts", "", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, nil},
+		{"POST", "/analysis-request", "{", http.StatusBadRequest, ErrorCodeInvalidJSON, nil},
+		{
+			"POST", "/analysis-request", `{}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"unknown producer", "required pointInTimeAnalysis"},
+		},
+		{
+			"POST", "/analysis-request", `{
+				"producer": "x",
+				"pointInTimeAnalysis": [
+					{"analyst": "x", "time": "2015-06-01T00:00:00Z"},
+					{"analyst": "ap", "time": "2015-06-01T00:00:00Z", "params": {"threshold": "a", "nope": 1}}
+				],
+				"rangeAnalysis": [
+					{"analyst": "a", "from": "2015-06-02T00:00:00Z", "until": "2015-06-01T00:00:00Z"}
+				]
+			}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{
+				"unknown producer",
+				"unknown pointInTimeAnalysis[0].analyst",
+				"invalid pointInTimeAnalysis[1].params.threshold",
+				"unknown pointInTimeAnalysis[1].params.nope",
+				"invalid rangeAnalysis[0].until",
+			},
+		},
+		{"POST", "/analysis-range", `{"analyst": "x"}`, http.StatusBadRequest, ErrorCodeValidation, []string{"unknown analyst"}},
+		{
+			"GET", "/jobs/j/results?format=xls&offset=-1&limit=0", "",
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"invalid format", "invalid offset", "invalid limit"},
+		},
+		{"GET", "/jobs/j/results", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"GET", "/jobs/j/results?format=csv", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{
+			"PUT", "/schedules/s", `{"cron": "bad", "time": "soon", "producer": "x", "analyst": "ap", "params": {}}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"invalid cron", "invalid time", "unknown producer", "required params.threshold"},
+		},
+		{"PUT", "/schedules/s", `{"cron": "@daily", "time": "now", "producer": "p", "analyst": "x"}`, http.StatusBadRequest, ErrorCodeValidation, []string{"unknown analyst"}},
+		{"DELETE", "/schedules/s", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"POST", "/schedules/s/pause", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"POST", "/schedules/s/resume", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"PUT", "/producers/p2", `{"factory": "empty", "typo": 1}`, http.StatusBadRequest, ErrorCodeInvalidJSON, nil},
+		{
+			"PUT", "/producers/p2", `{"factory": "nope", "concurrency": -1, "dataLoaders": ["l"]}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"invalid concurrency", "invalid dataLoaders", "unknown factory"},
+		},
+		{"PUT", "/producers/p2", `{"factory": "test", "params": {"fail": true}}`, http.StatusBadRequest, ErrorCodeValidation, []string{"invalid"}},
+		{
+			"PUT", "/data-loaders/l2", `{"factory": "test", "params": {"x": 1}}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"unknown params.x"},
+		},
+		{
+			"PUT", "/analysts/a2", `{"factory": "test", "params": {"window": 1}, "dataLoaders": ["x"], "concurrency": 1}`,
+			http.StatusBadRequest, ErrorCodeValidation,
+			[]string{"invalid concurrency", "unknown dataLoaders[0]", "required params.threshold", "invalid params.window"},
+		},
+		{"DELETE", "/data-loaders/l", "", http.StatusConflict, ErrorCodeConflict, nil},
+		{"DELETE", "/analysts/x", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"DELETE", "/data-loaders/x", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+		{"DELETE", "/producers/x", "", http.StatusNotFound, ErrorCodeNotFound, nil},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		name := test.method + " " + test.path
+		if w.Code != test.status {
+			t.Errorf("%s: Expecting status %d, got %d.", name, test.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: Expecting a JSON content type, got %q.", name, ct)
+		}
+		var e ErrorDTO
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Error == nil {
+			t.Errorf("%s: Expecting an error envelope, got %q.", name, w.Body.String())
+			continue
+		}
+		if e.Error.Code != test.code || e.Error.Message == "" {
+			t.Errorf("%s: Expecting code %q with a message, got %q %q.", name, test.code, e.Error.Code, e.Error.Message)
+		}
+		details := make([]string, 0)
+		for _, d := range e.Error.Details {
+			if d.Message == "" {
+				t.Errorf("%s: Expecting a message for %s.", name, d.Field)
+			}
+			details = append(details, strings.TrimSpace(d.Code+" "+d.Field))
+		}
+		if test.details == nil {
+			test.details = []string{}
+		}
+		if !reflect.DeepEqual(details, test.details) {
+			t.Errorf("%s: Expecting details %q, got %q.", name, test.details, details)
+		}
+	}
+}
+
+func TestHTTPErrorInternal(t *testing.T) {
+	s := NewSlurpd()
+	s.ResultStore(&failingResultStore{slurp.NewMemoryResultStore()})
+	router := ConfigureRouter(s, mux.NewRouter())
+	r := httptest.NewRequest("GET", "/jobs/j/results", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expecting status 500, got %d.", w.Code)
+	}
+	var e ErrorDTO
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Error == nil || e.Error.Code != ErrorCodeInternal {
+		t.Fatalf("Expecting an internal error, got %q.", w.Body.String())
+	}
+	if strings.Contains(e.Error.Message, "disk on fire") {
+		t.Errorf("Expecting the cause of an internal error to not be sent, got %q.", e.Error.Message)
+	}
+}
+
+func TestHTTPErrorText(t *testing.T) {
+	s := newTestSlurpd(newGateProducer())
+	router := ConfigureRouter(s, mux.NewRouter())
+	tests := []struct {
+		accept string
+		json   bool
+	}{
+		{"", true},
+		{"*/*", true},
+		{"application/json", true},
+		{"text/plain, application/json;q=0.5", false},
+		{"text/plain;q=0.5, application/json", true},
+		{"text/plain", false},
+		{"text/*;q=0.9", false},
+		{"*/*;q=0.1, text/plain;q=0.5", false},
+		{"text/plain;q=0, */*", true},
+		{"application/json;q=0, text/plain;q=0.1", false},
+		{"image/png", true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/analysis-request", bytes.NewBufferString(`{"producer": "x"}`))
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: Expecting status 400, got %d.", test.accept, w.Code)
+		}
+		ct := w.Header().Get("Content-Type")
+		if test.json {
+			if !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("%q: Expecting JSON, got %q.", test.accept, ct)
+			}
+			continue
+		}
+		if !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("%q: Expecting text, got %q.", test.accept, ct)
+		}
+		want := "validation_failed: the request is not valid\n" +
+			"  producer: unknown producer \"x\"\n" +
+			"  pointInTimeAnalysis: at least one point in time or range analysis is required\n"
+		if w.Body.String() != want {
+			t.Errorf("%q: Expecting %q, got %q.", test.accept, want, w.Body.String())
+		}
+	}
+}
+
+func TestResultExportFormatAccept(t *testing.T) {
+	tests := map[string]string{
+		"":                                 "",
+		"*/*":                              "",
+		"text/csv":                         "csv",
+		"text/csv, */*;q=0.5":              "csv",
+		"application/json;q=0.5, text/csv": "csv",
+		"text/csv;q=0.5, application/json": "",
+		"text/csv;q=0, application/x-ndjson;q=0.2, application/json;q=0.1": "ndjson",
+		"text/*;q=0.8, application/*;q=0.9":                                "",
+	}
+	for accept, want := range tests {
+		r := httptest.NewRequest("GET", "/jobs/j/results", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if got, ok := resultExportFormat(r); !ok || got != want {
+			t.Errorf("%q: Expecting format %q, got %q.", accept, want, got)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// Event types sent by the event streams.
+const (
+	EventQueued   = "queued"
+	EventStarted  = "started"
+	EventProgress = "progress"
+	EventLoaders  = "loaders"
+	EventFinished = "finished"
+	EventError    = "error"
+)
+
+// eventBuffer is the number of events that can wait for a slow
+// subscriber. Events are dropped for subscribers that fall further behind.
+const eventBuffer = 64
+
+// event is something that happened to a job.
+type event struct {
+	typ  string
+	job  string
+	data interface{}
+}
+
+// eventHub sends job events to subscribers.
+type eventHub struct {
+	mutex sync.Mutex
+	subs  map[chan *event]string
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[chan *event]string),
+	}
+}
+
+// subscribe returns a channel of events for job k, or for every job when
+// k is empty.
+func (h *eventHub) subscribe(k string) chan *event {
+	ch := make(chan *event, eventBuffer)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subs[ch] = k
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan *event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subs, ch)
+}
+
+// publish sends e to the subscribers without waiting on them.
+func (h *eventHub) publish(e *event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for ch, k := range h.subs {
+		if k != "" && k != e.job {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishJob sends an event describing where job k has got to. The caller
+// must hold jobMutex.
+func (s *Slurpd) publishJob(k string, job *slurperMapItem) {
+	s.events.publish(s.jobEvent(k, job, nil))
+}
+
+// publishJobError sends an error event for job k.
+func (s *Slurpd) publishJobError(k string, err error) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	if job, ok := s.slurperMap[k]; ok {
+		s.events.publish(s.jobEvent(k, job, err))
+	}
+}
+
+// jobEvent returns the event that describes where job k has got to, or an
+// error event when err is not nil. The caller must hold jobMutex.
+func (s *Slurpd) jobEvent(k string, job *slurperMapItem, err error) *event {
+	typ := EventQueued
+	switch job.state {
+	case jobRunning:
+		typ = EventStarted
+	case jobCompleted, jobCancelled:
+		typ = EventFinished
+	}
+	e := JobEventDTO{
+		Job:      k,
+		State:    job.state,
+		Producer: job.producer,
+		Time:     s.clock.Now(),
+	}
+	if err != nil {
+		typ = EventError
+		e.Error = err.Error()
+	}
+	return &event{typ: typ, job: k, data: e}
+}
+
+// loaderStats returns the stats of the registered data loaders that keep
+// them. When only is not nil just the data loaders in it are included.
+func (s *Slurpd) loaderStats(only []string) map[string]*slurp.DataLoaderStat {
+	r := make(map[string]*slurp.DataLoaderStat)
+	items := s.dataLoaders.snapshot()
+	if only != nil {
+		m := make(map[string]registryItem, len(only))
+		for _, k := range only {
+			if v, ok := items[k]; ok {
+				m[k] = v
+			}
+		}
+		items = m
+	}
+	for k, v := range items {
+		if w, ok := v.value.(*slurp.DataLoaderStatWrapper); ok {
+			r[k] = w.Stat()
+		}
+	}
+	return r
+}
+
+// loaderDeltas works out what the data loaders have done between two sets
+// of stats. Data loaders that have not been called are left out.
+func loaderDeltas(prev map[string]*slurp.DataLoaderStat, cur map[string]*slurp.DataLoaderStat) DataLoaderDeltaMapDTO {
+	r := make(DataLoaderDeltaMapDTO)
+	for k, v := range cur {
+		var p slurp.DataLoaderStat
+		if pv, ok := prev[k]; ok {
+			p = *pv
+		}
+		d := DataLoaderDeltaDTO{
+			Called:         v.Called.Count - p.Called.Count,
+			ReturnEmptyKey: v.ReturnEmptyKey.Count - p.ReturnEmptyKey.Count,
+			ReturnNilData:  v.ReturnNilData.Count - p.ReturnNilData.Count,
+			ReturnData:     v.ReturnData.Count - p.ReturnData.Count,
+			DurationTotal:  v.Called.DurationTotal - p.Called.DurationTotal,
+		}
+		// A reset of the stats shows up as going backwards.
+		if d.Called < 0 || d.DurationTotal < 0 {
+			d = DataLoaderDeltaDTO{
+				Called:         v.Called.Count,
+				ReturnEmptyKey: v.ReturnEmptyKey.Count,
+				ReturnNilData:  v.ReturnNilData.Count,
+				ReturnData:     v.ReturnData.Count,
+				DurationTotal:  v.Called.DurationTotal,
+			}
+		}
+		if d.Called == 0 {
+			continue
+		}
+		d.DurationAvg = d.DurationTotal / time.Duration(d.Called)
+		r[k] = d
+	}
+	return r
+}
+
+// writeEvent sends an event in the server-sent events format.
+func writeEvent(w http.ResponseWriter, typ string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, b); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+type httpHandlerEvents struct {
+	job bool
+}
+
+func (h *httpHandlerEvents) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerEvents) Path() string {
+	if h.job {
+		return "/jobs/{id}/events"
+	}
+	return "/events"
+}
+
+func (h *httpHandlerEvents) Description() string {
+	if h.job {
+		return "Streams the progress of a job as server-sent events."
+	}
+	return "Streams the progress of every job as server-sent events."
+}
+
+func (h *httpHandlerEvents) Readme() string {
+	r := `Events:
+  queued, started, finished - the job has changed state. data is:
+    {"job": "...", "state": "running", "producer": "...", "time": "..."}
+    state is "completed" or "cancelled" for finished.
+  error - the job was unable to store results. data is as above with
+    "error" set.
+  progress - sent for each running job every interval. data is the job as
+    returned by /slurpers with "job" added.
+  loaders - what the data loaders have done since the last loaders event,
+    sent every interval when they have been called. data is:
+    {"...": {"called": 0, "returnEmptyKey": 0, "returnNilData": 0,
+             "returnData": 0, "durationTotal": 0, "durationAvg": 0}}
+
+Query parameters:
+  interval - how often to send progress and loaders, such as "500ms".
+    Defaults to "1s".`
+	if h.job {
+		r += `
+
+Only the data loaders used by the job are included. The current state of
+the job is sent first and the stream ends once the job has finished.`
+	}
+	return r
+}
+
+func (h *httpHandlerEvents) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	const (
+		defaultInterval = time.Second
+		minInterval     = 100 * time.Millisecond
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval := defaultInterval
+		if v := r.URL.Query().Get("interval"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < minInterval {
+				var errs ValidationError
+				errs.add("interval", ErrorCodeInvalid, "expecting a duration of at least %s, got %q", minInterval, v)
+				WriteError(w, r, errs)
+				return
+			}
+			interval = d
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			WriteError(w, r, fmt.Errorf("streaming is not supported by %T", w))
+			return
+		}
+
+		var (
+			k       string
+			loaders []string
+		)
+		if h.job {
+			k = mux.Vars(r)["id"]
+		}
+		// Subscribe before looking at the job so that nothing is missed.
+		ch := s.events.subscribe(k)
+		defer s.events.unsubscribe(ch)
+		var first *event
+		if h.job {
+			s.jobMutex.Lock()
+			job, ok := s.slurperMap[k]
+			if ok {
+				first = s.jobEvent(k, job, nil)
+				loaders = append([]string{}, job.loaders...)
+			}
+			s.unlockJobs()
+			if !ok {
+				WriteError(w, r, unknownError("job", k))
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if first != nil {
+			if writeEvent(w, first.typ, first.data) != nil || first.typ == EventFinished {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		stats := s.loaderStats(loaders)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-s.drained:
+				return
+			case e := <-ch:
+				if writeEvent(w, e.typ, e.data) != nil {
+					return
+				}
+				if h.job && e.typ == EventFinished {
+					return
+				}
+			case <-ticker.C:
+				now := s.clock.Now()
+				for jk, job := range s.runningJobs() {
+					if h.job && jk != k {
+						continue
+					}
+					if writeEvent(w, EventProgress, JobProgressDTO{Job: jk, SlurperDTO: s.slurperDTO(job, now)}) != nil {
+						return
+					}
+				}
+				cur := s.loaderStats(loaders)
+				if d := loaderDeltas(stats, cur); len(d) > 0 {
+					if writeEvent(w, EventLoaders, d) != nil {
+						return
+					}
+				}
+				stats = cur
+				if h.job {
+					// The finished event could have been dropped.
+					s.jobMutex.Lock()
+					job, ok := s.slurperMap[k]
+					var e *event
+					if ok && job.finished != nil {
+						e = s.jobEvent(k, job, nil)
+					}
+					s.unlockJobs()
+					if e != nil {
+						writeEvent(w, e.typ, e.data)
+					}
+					if !ok || e != nil {
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package slurpd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// sseEvent is an event read from a server-sent event stream.
+type sseEvent struct {
+	typ  string
+	data string
+}
+
+// readEvents sends the events read from a stream until it ends. The
+// stream is closed at the end of the test.
+func readEvents(t *testing.T, url string) <-chan sseEvent {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expecting an event stream, got %q.", ct)
+	}
+	ch := make(chan sseEvent, 100)
+	go func() {
+		defer res.Body.Close()
+		defer close(ch)
+		var e sseEvent
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				ch <- e
+				e = sseEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+// expectEvent waits for an event of type typ, skipping progress events.
+func expectEvent(t *testing.T, ch <-chan sseEvent, typ string, v interface{}) {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				t.Fatalf("Expecting a %q event, the stream ended.", typ)
+			}
+			if e.typ != typ && (e.typ == EventProgress || e.typ == EventLoaders) {
+				continue
+			}
+			if e.typ != typ {
+				t.Fatalf("Expecting a %q event, got %q %s.", typ, e.typ, e.data)
+			}
+			if v != nil {
+				if err := json.Unmarshal([]byte(e.data), v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Expecting a %q event.", typ)
+		}
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	srv := httptest.NewServer(ConfigureRouter(s, mux.NewRouter()))
+	t.Cleanup(srv.Close)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	all := readEvents(t, srv.URL+"/events?interval=100ms")
+	k, err := s.SubmitJob(testJobRequest("a", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e JobEventDTO
+	expectEvent(t, all, EventQueued, &e)
+	if e.Job != k || e.State != jobQueued || e.Producer != "p" {
+		t.Errorf("Unexpected queued event %+v.", e)
+	}
+	expectEvent(t, all, EventStarted, &e)
+	if e.Job != k || e.State != jobRunning {
+		t.Errorf("Unexpected started event %+v.", e)
+	}
+	p.expectStart(t, t1)
+
+	job := readEvents(t, srv.URL+"/jobs/"+k+"/events?interval=100ms")
+	expectEvent(t, job, EventStarted, nil)
+	var progress JobProgressDTO
+	expectEvent(t, job, EventProgress, &progress)
+	if progress.Job != k || len(progress.AnalysisRequest) != 1 || progress.AnalysisRequest[0].Analyst != "a" {
+		t.Errorf("Unexpected progress event %+v.", progress)
+	}
+
+	p.release <- struct{}{}
+	expectEvent(t, job, EventFinished, &e)
+	if e.Job != k || e.State != jobCompleted {
+		t.Errorf("Unexpected finished event %+v.", e)
+	}
+	if _, ok := <-job; ok {
+		t.Errorf("Expecting the job stream to end once the job has finished.")
+	}
+	expectEvent(t, all, EventFinished, nil)
+
+	// A finished job only gets the one event.
+	job = readEvents(t, srv.URL+"/jobs/"+k+"/events")
+	expectEvent(t, job, EventFinished, nil)
+	if _, ok := <-job; ok {
+		t.Errorf("Expecting the job stream to end for a finished job.")
+	}
+}
+
+func TestJobEventsErrors(t *testing.T) {
+	router := ConfigureRouter(NewSlurpd(), mux.NewRouter())
+	for path, want := range map[string]int{
+		"/jobs/x/events":        http.StatusNotFound,
+		"/events?interval=1ms":  http.StatusBadRequest,
+		"/events?interval=soon": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: Expecting status %d, got %d.", path, want, w.Code)
+		}
+	}
+}
+
+func TestLoaderDeltas(t *testing.T) {
+	s := NewSlurpd()
+	l := slurp.NewDataLoaderStatWrapper(slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+		return "k", 1
+	}))
+	s.RegisterDataLoader("l", l)
+	s.RegisterDataLoader("idle", slurp.NewDataLoaderStatWrapper(slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+		return "", nil
+	})))
+	item := &slurp.Item{Data: make(map[string]interface{})}
+
+	prev := s.loaderStats(nil)
+	l.LoadData(item)
+	l.LoadData(item)
+	cur := s.loaderStats(nil)
+	d := loaderDeltas(prev, cur)
+	if len(d) != 1 || d["l"].Called != 2 || d["l"].ReturnData != 2 {
+		t.Errorf("Expecting 2 calls to l, got %+v.", d)
+	}
+	if d := loaderDeltas(cur, s.loaderStats(nil)); len(d) != 0 {
+		t.Errorf("Expecting no deltas, got %+v.", d)
+	}
+	if got := s.loaderStats([]string{"idle"}); len(got) != 1 || got["idle"] == nil {
+		t.Errorf("Expecting only the idle data loader, got %v.", got)
+	}
+}
@@ -0,0 +1,131 @@
+package slurpd
+
+import (
+	"log"
+	"sync"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// ProducerFactory creates producers from parameters.
+type ProducerFactory struct {
+	Name        string
+	Description string
+	Params      slurp.ParamSchema
+	New         func(p slurp.Params) (slurp.Producer, error)
+}
+
+// DataLoaderFactory creates data loaders from parameters.
+type DataLoaderFactory struct {
+	Name        string
+	Description string
+	Params      slurp.ParamSchema
+	New         func(p slurp.Params) (slurp.DataLoader, error)
+}
+
+// AnalystFactory creates analysts from parameters and the data loaders that
+// they should use.
+type AnalystFactory struct {
+	Name        string
+	Description string
+	Params      slurp.ParamSchema
+	New         func(p slurp.Params, dataLoaders []slurp.DataLoader) (slurp.Analyst, error)
+}
+
+var factories = struct {
+	sync.Mutex
+	producer   map[string]*ProducerFactory
+	dataLoader map[string]*DataLoaderFactory
+	analyst    map[string]*AnalystFactory
+}{
+	producer:   make(map[string]*ProducerFactory),
+	dataLoader: make(map[string]*DataLoaderFactory),
+	analyst:    make(map[string]*AnalystFactory),
+}
+
+// RegisterProducerFactory makes a producer factory available under k.
+// Will panic if the parameter schema is not valid
+func RegisterProducerFactory(k string, f *ProducerFactory) {
+	if err := f.Params.Check(); err != nil {
+		log.Panicf("Invalid parameters for producer factory %q: %s.\n", k, err)
+	}
+	factories.Lock()
+	defer factories.Unlock()
+	factories.producer[k] = f
+}
+
+// RegisterDataLoaderFactory makes a data loader factory available under k.
+// Will panic if the parameter schema is not valid
+func RegisterDataLoaderFactory(k string, f *DataLoaderFactory) {
+	if err := f.Params.Check(); err != nil {
+		log.Panicf("Invalid parameters for data loader factory %q: %s.\n", k, err)
+	}
+	factories.Lock()
+	defer factories.Unlock()
+	factories.dataLoader[k] = f
+}
+
+// RegisterAnalystFactory makes an analyst factory available under k.
+// Will panic if the parameter schema is not valid
+func RegisterAnalystFactory(k string, f *AnalystFactory) {
+	if err := f.Params.Check(); err != nil {
+		log.Panicf("Invalid parameters for analyst factory %q: %s.\n", k, err)
+	}
+	factories.Lock()
+	defer factories.Unlock()
+	factories.analyst[k] = f
+}
+
+func producerFactory(k string) (*ProducerFactory, bool) {
+	factories.Lock()
+	defer factories.Unlock()
+	f, ok := factories.producer[k]
+	return f, ok
+}
+
+func dataLoaderFactory(k string) (*DataLoaderFactory, bool) {
+	factories.Lock()
+	defer factories.Unlock()
+	f, ok := factories.dataLoader[k]
+	return f, ok
+}
+
+func analystFactory(k string) (*AnalystFactory, bool) {
+	factories.Lock()
+	defer factories.Unlock()
+	f, ok := factories.analyst[k]
+	return f, ok
+}
+
+// producerFactories returns the registered producer factories.
+func producerFactories() FactoryMapDTO {
+	factories.Lock()
+	defer factories.Unlock()
+	r := make(FactoryMapDTO, len(factories.producer))
+	for k, f := range factories.producer {
+		r[k] = FactoryDTO{Name: f.Name, Description: f.Description, Params: f.Params}
+	}
+	return r
+}
+
+// dataLoaderFactories returns the registered data loader factories.
+func dataLoaderFactories() FactoryMapDTO {
+	factories.Lock()
+	defer factories.Unlock()
+	r := make(FactoryMapDTO, len(factories.dataLoader))
+	for k, f := range factories.dataLoader {
+		r[k] = FactoryDTO{Name: f.Name, Description: f.Description, Params: f.Params}
+	}
+	return r
+}
+
+// analystFactories returns the registered analyst factories.
+func analystFactories() FactoryMapDTO {
+	factories.Lock()
+	defer factories.Unlock()
+	r := make(FactoryMapDTO, len(factories.analyst))
+	for k, f := range factories.analyst {
+		r[k] = FactoryDTO{Name: f.Name, Description: f.Description, Params: f.Params}
+	}
+	return r
+}
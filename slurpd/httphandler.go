@@ -2,9 +2,14 @@ package slurpd
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -21,20 +26,46 @@ func init() {
 	HTTPHandlerList = append(
 		HTTPHandlerList,
 		&httpHandlerDescribeSelf{},
+		&httpHandlerOpenAPI{},
 		&httpHandlerAnalysts{},
 		&httpHandlerDataLoaders{},
 		&httpHandlerProducers{},
+		&httpHandlerFactories{kind: "analyst"},
+		&httpHandlerFactories{kind: "data-loader"},
+		&httpHandlerFactories{kind: "producer"},
+		&httpHandlerComponentPut{kind: "analyst"},
+		&httpHandlerComponentPut{kind: "data-loader"},
+		&httpHandlerComponentPut{kind: "producer"},
+		&httpHandlerComponentDelete{kind: "analyst"},
+		&httpHandlerComponentDelete{kind: "data-loader"},
+		&httpHandlerComponentDelete{kind: "producer"},
 		&httpHandlerSlurpers{},
 		&httpHandlerAnalysisRange{},
 		&httpHandlerAnalysisRequest{},
+		&httpHandlerJobs{},
+		&httpHandlerJobResults{},
+		&httpHandlerJobCancel{},
+		&httpHandlerEvents{job: true},
+		&httpHandlerEvents{job: false},
+		&httpHandlerSchedules{},
+		&httpHandlerSchedulePut{},
+		&httpHandlerScheduleDelete{},
+		&httpHandlerSchedulePause{paused: true},
+		&httpHandlerSchedulePause{paused: false},
+		&httpHandlerAudit{},
 	)
 }
 
-// ConfigureRouter will attach the http api handlers to a router.
+// ConfigureRouter will attach the http api handlers to a router. Requests
+// are authenticated by the authenticators of s and each handler is only
+// available to the roles allowed by HTTPHandlerRole. Requests that do not
+// match a handler are answered with an ErrorDTO.
 func ConfigureRouter(s *Slurpd, r *mux.Router) *mux.Router {
 	for _, h := range HTTPHandlerList {
-		r.HandleFunc(h.Path(), h.HandlerFunc(s)).Methods(h.Method())
+		r.HandleFunc(h.Path(), s.authorize(h, h.HandlerFunc(s))).Methods(h.Method())
 	}
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 	return r
 }
 
@@ -45,7 +76,9 @@ func WriteJSONResponse(w http.ResponseWriter, response interface{}) {
 	w.Write(data)
 }
 
-// HTTPHandler allows us to register and self document the http api.
+// HTTPHandler allows us to register and self document the http api. A
+// handler can also implement HTTPHandlerSpec to describe its request and
+// response in the OpenAPI document.
 type HTTPHandler interface {
 	Method() string
 	Path() string
@@ -71,7 +104,39 @@ func (h *httpHandlerDescribeSelf) Description() string {
 }
 
 func (h *httpHandlerDescribeSelf) Readme() string {
-	return ""
+	return `Errors from every handler are sent as:
+{
+  "error": {
+    "code": "validation_failed",
+    "message": "the request is not valid",
+    "details": [
+      {
+        "code": "unknown",
+        "message": "unknown analyst \"bar\"",
+        "field": "pointInTimeAnalysis[0].analyst"
+      }
+    ]
+  }
+}
+
+code is one of "invalid_json", "validation_failed", "not_found",
+"method_not_allowed", "conflict", "unauthorized", "forbidden",
+"unavailable" or "internal_error". When a request is not valid details
+lists every problem found with it, with a code of "required", "unknown" or
+"invalid". Clients whose Accept header weights text/plain above JSON are
+sent the same error as text. New jobs get a 503 "unavailable" while slurpd is shutting down.
+
+When authentication is turned on requests need one of:
+  Authorization: Bearer <token>
+  Authorization: SLURP-HMAC-SHA256 Key=<key id>, Signature=<hex>
+    with an X-Slurp-Date header holding the RFC 3339 time of signing. The
+    signature is the HMAC-SHA256 of the method, path and query, date and
+    hex SHA-256 of the body, each on their own line.
+  A TLS client certificate, named by its common name.
+GET needs the viewer role, except /audit which needs admin,
+/analysis-request and cancelling a job need submitter and everything else
+needs admin. Submitters can only cancel
+their own jobs.`
 }
 
 func (h *httpHandlerDescribeSelf) HandlerFunc(s *Slurpd) http.HandlerFunc {
@@ -130,23 +195,51 @@ func (h *httpHandlerAnalysts) Description() string {
 }
 
 func (h *httpHandlerAnalysts) Readme() string {
-	return ""
+	return `factory and params are set when the analyst was created from a factory.
+The available factories and their parameters are listed by /analyst-types.
+
+requestParams lists the parameters that analysis requests for the analyst
+can have.`
+}
+
+func (h *httpHandlerAnalysts) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerAnalysts) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerAnalysts) Response() interface{} {
+	return AnalystMapDTO{}
 }
 
 func (h *httpHandlerAnalysts) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response = make(AnalystMapDTO, len(s.analystMap))
-		for k, v := range s.analystMap {
-			d := v.(slurp.Describer)
-			response[k] = AnalystDTO{
-				Name:        d.Name(),
-				Description: d.Description(),
-			}
+		items := s.analysts.snapshot()
+		var response = make(AnalystMapDTO, len(items))
+		for k, v := range items {
+			response[k] = newAnalystDTO(v)
 		}
 		WriteJSONResponse(w, response)
 	}
 }
 
+func newAnalystDTO(v registryItem) AnalystDTO {
+	d := v.value.(slurp.Describer)
+	r := AnalystDTO{
+		Name:        d.Name(),
+		Description: d.Description(),
+		Factory:     v.config.Factory,
+		Params:      v.config.Params,
+		DataLoaders: v.config.DataLoaders,
+	}
+	if pa, ok := v.value.(slurp.ParamAnalyst); ok {
+		r.RequestParams = pa.ParamSchema()
+	}
+	return r
+}
+
 type httpHandlerDataLoaders struct{}
 
 func (h *httpHandlerDataLoaders) Method() string {
@@ -162,28 +255,48 @@ func (h *httpHandlerDataLoaders) Description() string {
 }
 
 func (h *httpHandlerDataLoaders) Readme() string {
-	return ""
+	return `factory and params are set when the data loader was created from a factory.
+The available factories and their parameters are listed by /data-loader-types.`
+}
+
+func (h *httpHandlerDataLoaders) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerDataLoaders) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerDataLoaders) Response() interface{} {
+	return DataLoaderMapDTO{}
 }
 
 func (h *httpHandlerDataLoaders) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response = make(DataLoaderMapDTO, len(s.dataLoaderMap))
-		for k, v := range s.dataLoaderMap {
-			d := v.(slurp.Describer)
-			var stat *slurp.DataLoaderStat
-			if s, ok := v.(*slurp.DataLoaderStatWrapper); ok {
-				stat = s.Stat()
-			}
-			response[k] = DataLoaderDTO{
-				Name:        d.Name(),
-				Description: d.Description(),
-				Stat:        stat,
-			}
+		items := s.dataLoaders.snapshot()
+		var response = make(DataLoaderMapDTO, len(items))
+		for k, v := range items {
+			response[k] = newDataLoaderDTO(v)
 		}
 		WriteJSONResponse(w, response)
 	}
 }
 
+func newDataLoaderDTO(v registryItem) DataLoaderDTO {
+	d := v.value.(slurp.Describer)
+	var stat *slurp.DataLoaderStat
+	if s, ok := v.value.(*slurp.DataLoaderStatWrapper); ok {
+		stat = s.Stat()
+	}
+	return DataLoaderDTO{
+		Name:        d.Name(),
+		Description: d.Description(),
+		Factory:     v.config.Factory,
+		Params:      v.config.Params,
+		Stat:        stat,
+	}
+}
+
 type httpHandlerProducers struct{}
 
 func (h *httpHandlerProducers) Method() string {
@@ -199,23 +312,43 @@ func (h *httpHandlerProducers) Description() string {
 }
 
 func (h *httpHandlerProducers) Readme() string {
-	return ""
+	return `factory and params are set when the producer was created from a factory.
+The available factories and their parameters are listed by /producer-types.`
+}
+
+func (h *httpHandlerProducers) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerProducers) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerProducers) Response() interface{} {
+	return ProducerMapDTO{}
 }
 
 func (h *httpHandlerProducers) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response = make(ProducerMapDTO, len(s.producerMap))
-		for k, v := range s.producerMap {
-			d := v.(slurp.Describer)
-			response[k] = ProducerDTO{
-				Name:        d.Name(),
-				Description: d.Description(),
-			}
+		items := s.producers.snapshot()
+		var response = make(ProducerMapDTO, len(items))
+		for k, v := range items {
+			response[k] = newProducerDTO(v)
 		}
 		WriteJSONResponse(w, response)
 	}
 }
 
+func newProducerDTO(v registryItem) ProducerDTO {
+	d := v.value.(slurp.Describer)
+	return ProducerDTO{
+		Name:        d.Name(),
+		Description: d.Description(),
+		Factory:     v.config.Factory,
+		Params:      v.config.Params,
+	}
+}
+
 type httpHandlerSlurpers struct{}
 
 func (h *httpHandlerSlurpers) Method() string {
@@ -231,35 +364,92 @@ func (h *httpHandlerSlurpers) Description() string {
 }
 
 func (h *httpHandlerSlurpers) Readme() string {
-	return ""
+	return `Durations are in nanoseconds.
+
+stat.inBlocked is the time spent waiting for items to arrive and
+stat.outBlocked the time spent waiting for them to be taken.
+
+analysisRequest[].blocked is the time spent waiting on an analysis request
+to take items. While waiting no other analysis request gets any items.
+
+progress.percent is how far through its time range the slurp or analysis
+request is based on the time of the most recent item. progress.velocity is
+the number of seconds of data slurped per second and is used to work out
+progress.remaining (data time) and progress.eta.
+
+bottleneck is the stage that has held up the slurp the most. One of
+"producer", "dataLoader" or "analysisRequest". When it is
+"analysisRequest" the request in question is flagged with
+"bottleneck": true.`
+}
+
+func (h *httpHandlerSlurpers) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerSlurpers) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerSlurpers) Response() interface{} {
+	return SlurperMapDTO{}
 }
 
 func (h *httpHandlerSlurpers) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var response = make(SlurperMapDTO, len(s.slurperMap))
-		for k, v := range s.slurperMap {
-			rs := v.slurper.RequestStat()
-			ar := make([]AnalysisRequestDTO, len(rs))
-			for i, st := range rs {
-				ar[i] = AnalysisRequestDTO{
-					Analyst: s.analystKey(v.slurper.Requests[i].Analyst),
-					Range: TimeRangeDTO{
-						From:  v.slurper.Requests[i].TimeFrom,
-						Until: v.slurper.Requests[i].TimeUntil,
-					},
-					Stat: st,
-				}
-			}
-			response[k] = SlurperDTO{
-				Started:         v.started,
-				Stat:            v.slurper.SlurpStat(),
-				AnalysisRequest: ar,
-			}
+		jobs := s.runningJobs()
+		var response = make(SlurperMapDTO, len(jobs))
+		now := s.clock.Now()
+		for k, v := range jobs {
+			response[k] = s.slurperDTO(v, now)
 		}
 		WriteJSONResponse(w, response)
 	}
 }
 
+// slurperDTO describes a running job.
+func (s *Slurpd) slurperDTO(v *slurperMapItem, now time.Time) SlurperDTO {
+	stat := v.slurper.SlurpStat()
+	from, until := slurp.AnalysisRequestTimeRange(v.slurper.Requests...)
+	velocity := slurpVelocity(from, stat.ItemAt, v.started, now)
+	rs := v.slurper.RequestStat()
+	rb := v.slurper.RequestBlocked()
+	bottleneck, bottleneckRequest := v.slurper.Bottleneck()
+	ar := make([]AnalysisRequestDTO, len(rs))
+	for i, st := range rs {
+		ar[i] = AnalysisRequestDTO{
+			Analyst: v.analysts[i],
+			Range: TimeRangeDTO{
+				From:  v.slurper.Requests[i].TimeFrom,
+				Until: v.slurper.Requests[i].TimeUntil,
+			},
+			Params: v.slurper.Requests[i].Params,
+			Stat:   st,
+			Progress: newProgressDTO(
+				v.slurper.Requests[i].TimeFrom,
+				v.slurper.Requests[i].TimeUntil,
+				requestAt(v.slurper.Requests[i].TimeUntil, st.ItemAt, stat.ItemAt),
+				velocity,
+				now,
+			),
+			Blocked:    rb[i],
+			Bottleneck: i == bottleneckRequest,
+		}
+	}
+	return SlurperDTO{
+		Started: v.started,
+		Stat:    stat,
+		Range: TimeRangeDTO{
+			From:  from,
+			Until: until,
+		},
+		Progress:        newProgressDTO(from, until, stat.ItemAt, velocity, now),
+		LoadDuration:    v.slurper.LoadDuration(),
+		Bottleneck:      bottleneck,
+		AnalysisRequest: ar,
+	}
+}
+
 type httpHandlerAnalysisRange struct{}
 
 func (h *httpHandlerAnalysisRange) Method() string {
@@ -278,34 +468,41 @@ func (h *httpHandlerAnalysisRange) Readme() string {
 	return ""
 }
 
+func (h *httpHandlerAnalysisRange) Role() Role {
+	return RoleViewer
+}
+
+func (h *httpHandlerAnalysisRange) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerAnalysisRange) Request() interface{} {
+	return AnalysisRangeRequestDTO{}
+}
+
+func (h *httpHandlerAnalysisRange) Response() interface{} {
+	return AnalysisRangeDTO{}
+}
+
 func (h *httpHandlerAnalysisRange) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		type analysis struct {
-			Analyst string    `json:"analyst"`
-			Time    time.Time `json:"time"`
-		}
-		type analysisRange struct {
-			TimeFrom  time.Time `json:"timeFrom"`
-			TimeUntil time.Time `json:"timeUntil"`
-		}
-		var an analysis
-		err := json.NewDecoder(r.Body).Decode(&an)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			log.Printf("JSON decode error: %s.\n", err)
+		var an AnalysisRangeRequestDTO
+		if err := decodeJSON(json.NewDecoder(r.Body), &an); err != nil {
+			WriteError(w, r, err)
 			return
 		}
-		if _, ok := s.analystMap[an.Analyst]; !ok {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			log.Printf("Unknown analyst %q.\n", an.Analyst)
+		a, ok := s.Analyst(an.Analyst)
+		if !ok {
+			var errs ValidationError
+			errs.add("analyst", ErrorCodeUnknown, "unknown analyst %q", an.Analyst)
+			WriteError(w, r, errs)
 			return
 		}
-		timeFrom, timeUntil := s.analystMap[an.Analyst].RangeForAnalysisRequest(an.Time)
-		response := &analysisRange{
+		timeFrom, timeUntil := a.RangeForAnalysisRequest(an.Time)
+		WriteJSONResponse(w, AnalysisRangeDTO{
 			TimeFrom:  timeFrom,
 			TimeUntil: timeUntil,
-		}
-		WriteJSONResponse(w, response)
+		})
 	}
 }
 
@@ -327,10 +524,14 @@ func (h *httpHandlerAnalysisRequest) Readme() string {
 	return `Request:
 {
   "producer": "foo",
+  "priority": 0,
   "pointInTimeAnalysis": [
     {
       "analyst": "bar",
-      "time": "..."
+      "time": "...",
+      "params": {
+        "threshold": 10
+      }
     }
   ],
   "rangeAnalysis": [
@@ -340,74 +541,913 @@ func (h *httpHandlerAnalysisRequest) Readme() string {
       "until": "..."
     }
   ]
-}`
+}
+
+Response:
+{
+  "job": "..."
+}
+
+params are checked against the requestParams of the analyst listed by
+/analysts. Analysts without requestParams take no parameters.
+
+The job is queued and started once the concurrency limits of the daemon
+allow. Jobs with a higher priority are started first. The job can be used
+to fetch the results of the analysis. Who submitted the job is recorded as
+its identity.`
+}
+
+func (h *httpHandlerAnalysisRequest) Role() Role {
+	return RoleSubmitter
+}
+
+func (h *httpHandlerAnalysisRequest) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerAnalysisRequest) Request() interface{} {
+	return JobRequestDTO{}
+}
+
+func (h *httpHandlerAnalysisRequest) Response() interface{} {
+	return JobDTO{}
 }
 
 func (h *httpHandlerAnalysisRequest) HandlerFunc(s *Slurpd) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		type pointInTimeAnalysis struct {
-			Analyst string    `json:"analyst"`
-			Time    time.Time `json:"time"`
+		var req JobRequestDTO
+		if err := decodeJSON(json.NewDecoder(r.Body), &req); err != nil {
+			WriteError(w, r, err)
+			return
 		}
-		type rangeAnalysis struct {
-			Analyst string    `json:"analyst"`
-			From    time.Time `json:"from"`
-			Until   time.Time `json:"until"`
+		k, err := s.SubmitJobAs(RequestIdentity(r), &req)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		WriteJSONResponse(w, JobDTO{
+			Job: k,
+		})
+	}
+}
+
+type httpHandlerJobs struct{}
+
+func (h *httpHandlerJobs) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerJobs) Path() string {
+	return "/jobs"
+}
+
+func (h *httpHandlerJobs) Description() string {
+	return "Lists queued, running and completed jobs."
+}
+
+func (h *httpHandlerJobs) Readme() string {
+	return `Response:
+{
+  "...": {
+    "state": "queued",
+    "priority": 0,
+    "producer": "foo",
+    "identity": {"name": "ci", "method": "token", "role": "submitter"},
+    "position": 1,
+    "queued": "...",
+    "started": "...",
+    "finished": "..."
+  }
+}
+
+state is one of "queued", "running", "completed" or "cancelled". position
+is where a queued job is in the queue, starting at 1. Jobs with a higher
+priority are started first, otherwise jobs are started in the order they
+were queued. identity is who submitted the job, it is left out when
+authentication is off or the job was not submitted through the API.`
+}
+
+func (h *httpHandlerJobs) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerJobs) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerJobs) Response() interface{} {
+	return JobMapDTO{}
+}
+
+func (h *httpHandlerJobs) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSONResponse(w, s.jobStatus())
+	}
+}
+
+type httpHandlerJobResults struct{}
+
+func (h *httpHandlerJobResults) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerJobResults) Path() string {
+	return "/jobs/{id}/results"
+}
+
+func (h *httpHandlerJobResults) Description() string {
+	return "Gets a page of analysis results for a job."
+}
+
+func (h *httpHandlerJobResults) Readme() string {
+	return `Query parameters:
+  offset - number of results to skip, defaults to 0.
+  limit  - max number of results to return, defaults to 100 (max 1000).
+
+  format - export all of the results as "csv", "ndjson" or "parquet".
+
+Results are returned in the order that they were written. Results are
+available while a job is running, "finished" tells you if there will be
+any more.
+
+All results can also be exported by sending an Accept header of
+"text/csv", "application/x-ndjson" or "application/vnd.apache.parquet".
+Nested data is flattened in to columns for csv and parquet.`
+}
+
+// resultExportFormat works out the export format asked for by the request
+// from the format query parameter or the Accept header. An empty format
+// means that a page of JSON should be returned, which is also what is done
+// when JSON is weighted the same as an export format.
+func resultExportFormat(r *http.Request) (string, bool) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f == "json" {
+			return "", true
 		}
-		type request struct {
-			Producer            string                `json:"producer"`
-			PointInTimeAnalysis []pointInTimeAnalysis `json:"pointInTimeAnalysis"`
-			RangeAnalysis       []rangeAnalysis       `json:"rangeAnalysis"`
+		_, ok := slurp.ExportContentType[f]
+		return f, ok
+	}
+	formats := make([]string, 0, len(slurp.ExportContentType))
+	for f := range slurp.ExportContentType {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	offers := []string{"application/json"}
+	for _, f := range formats {
+		mt, _, _ := mime.ParseMediaType(slurp.ExportContentType[f])
+		offers = append(offers, mt)
+	}
+	mt := negotiate(r, offers...)
+	for i, f := range formats {
+		if offers[i+1] == mt {
+			return f, true
 		}
+	}
+	return "", true
+}
 
+func (h *httpHandlerJobResults) Params() []HTTPParam {
+	return []HTTPParam{
+		{Name: "id", In: "path", Type: "string", Description: "The job."},
+		{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip."},
+		{Name: "limit", In: "query", Type: "integer", Description: "Number of results to return, from 1 to 1000."},
+		{Name: "format", In: "query", Type: "string", Description: `Export all of the results as "csv", "ndjson" or "parquet".`},
+	}
+}
+
+func (h *httpHandlerJobResults) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerJobResults) Response() interface{} {
+	return JobResultsDTO{}
+}
+
+func (h *httpHandlerJobResults) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	const (
+		defaultLimit = 100
+		maxLimit     = 1000
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
 		var (
-			err error
-			req request
-			ok  bool
-			p   slurp.Producer
-			ar  []*slurp.AnalysisRequest
+			err    error
+			offset = 0
+			limit  = defaultLimit
 		)
+		k := mux.Vars(r)["id"]
+		var errs ValidationError
+		format, ok := resultExportFormat(r)
+		if !ok {
+			errs.add("format", ErrorCodeInvalid, "unknown export format %q", format)
+		}
+		if v := r.URL.Query().Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				errs.add("offset", ErrorCodeInvalid, "expecting an integer of at least 0, got %q", v)
+			}
+		}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLimit {
+				errs.add("limit", ErrorCodeInvalid, "expecting an integer from 1 to %d, got %q", maxLimit, v)
+			}
+		}
+		if err = errs.err(); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if format != "" {
+			h.export(s, w, r, k, format)
+			return
+		}
+		job, ok := s.job(k)
+		results, err := s.resultStore.Results(k, offset, limit)
+		if err != nil {
+			WriteError(w, r, fmt.Errorf("unable to read results for job %q: %s", k, err))
+			return
+		}
+		if !ok && len(results) == 0 {
+			// The job could have been pruned from the history so we
+			// only give up when there are no results either.
+			WriteError(w, r, unknownError("job", k))
+			return
+		}
+		WriteJSONResponse(w, JobResultsDTO{
+			Job:      k,
+			Finished: !ok || s.jobFinished(job),
+			Offset:   offset,
+			Limit:    limit,
+			Results:  results,
+		})
+	}
+}
 
-		err = json.NewDecoder(r.Body).Decode(&req)
+// export writes all of the results for job k in format.
+func (h *httpHandlerJobResults) export(s *Slurpd, w http.ResponseWriter, r *http.Request, k string, format string) {
+	if _, ok := s.job(k); !ok {
+		results, err := s.resultStore.Results(k, 0, 1)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			log.Printf("JSON decode error: %s.\n", err)
+			WriteError(w, r, fmt.Errorf("unable to read results for job %q: %s", k, err))
 			return
 		}
-		if p, ok = s.producerMap[req.Producer]; !ok {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			log.Printf("Unknown producer %q.\n", req.Producer)
+		if len(results) == 0 {
+			WriteError(w, r, unknownError("job", k))
 			return
 		}
-		if len(req.PointInTimeAnalysis) < 1 && len(req.RangeAnalysis) < 1 {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			log.Printf("Empty analysis slices.\n")
+	}
+	w.Header().Set("Content-Type", slurp.ExportContentType[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", k+"."+format))
+	if err := slurp.ExportResults(w, format, s.resultStore, k); err != nil {
+		// Too late to tell the client as the response has started.
+		log.Printf("Unable to export results for job %q: %s.\n", k, err)
+	}
+}
+
+type httpHandlerJobCancel struct{}
+
+func (h *httpHandlerJobCancel) Method() string {
+	return "POST"
+}
+
+func (h *httpHandlerJobCancel) Path() string {
+	return "/jobs/{id}/cancel"
+}
+
+func (h *httpHandlerJobCancel) Description() string {
+	return "Cancels a queued or running job."
+}
+
+func (h *httpHandlerJobCancel) Readme() string {
+	return `A queued job is cancelled straight away. A running job stops taking
+items from its producer and stays "running" until the items that it has
+already taken have been analysed, watch /jobs/{id}/events to find out when
+it has finished. Results that have already been written are kept.
+
+Cancelling a job that has already finished returns 409 Conflict. Only an
+admin can cancel a job submitted by someone else.
+
+Response is the job as returned by /jobs.`
+}
+
+func (h *httpHandlerJobCancel) Role() Role {
+	return RoleSubmitter
+}
+
+func (h *httpHandlerJobCancel) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerJobCancel) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerJobCancel) Response() interface{} {
+	return JobStatusDTO{}
+}
+
+func (h *httpHandlerJobCancel) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["id"]
+		if err := s.CancelJobAs(RequestIdentity(r), k); err != nil {
+			WriteError(w, r, err)
 			return
 		}
-		ar = make(
-			[]*slurp.AnalysisRequest,
-			len(req.PointInTimeAnalysis)+len(req.RangeAnalysis),
+		WriteJSONResponse(w, s.jobStatus()[k])
+	}
+}
+
+type httpHandlerSchedules struct{}
+
+func (h *httpHandlerSchedules) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerSchedules) Path() string {
+	return "/schedules"
+}
+
+func (h *httpHandlerSchedules) Description() string {
+	return "Lists the scheduled recurring analyses."
+}
+
+func (h *httpHandlerSchedules) Readme() string {
+	return `Response:
+{
+  "nightly": {
+    "cron": "0 2 * * *",
+    "location": "Europe/London",
+    "producer": "foo",
+    "analyst": "bar",
+    "time": "yesterday 00:00 UTC",
+    "priority": 0,
+    "paused": false,
+    "lastRun": "...",
+    "lastJob": "...",
+    "lastError": "...",
+    "nextRun": "..."
+  }
+}
+
+The cron expression of a schedule is worked out in its location, UTC when
+it does not have one.`
+}
+
+func (h *httpHandlerSchedules) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerSchedules) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerSchedules) Response() interface{} {
+	return ScheduleMapDTO{}
+}
+
+func (h *httpHandlerSchedules) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSONResponse(w, s.Schedules())
+	}
+}
+
+type httpHandlerSchedulePut struct{}
+
+func (h *httpHandlerSchedulePut) Method() string {
+	return "PUT"
+}
+
+func (h *httpHandlerSchedulePut) Path() string {
+	return "/schedules/{name}"
+}
+
+func (h *httpHandlerSchedulePut) Description() string {
+	return "Adds or replaces a scheduled recurring analysis."
+}
+
+func (h *httpHandlerSchedulePut) Readme() string {
+	return `Request:
+{
+  "cron": "0 2 * * *",
+  "location": "Europe/London",
+  "producer": "foo",
+  "analyst": "bar",
+  "time": "yesterday 00:00 UTC",
+  "params": {},
+  "priority": 0,
+  "paused": false
+}
+
+cron is a five field cron expression (minute, hour, day of month, month,
+day of week) worked out in location, a time zone such as "Europe/London"
+that defaults to UTC. @hourly, @daily, @weekly, @monthly and @yearly can
+also be used.
+
+time is the point in time to analyse, worked out from when the run was
+due. It starts with "now", "today", "yesterday" or "tomorrow" and can be
+followed by a time of day ("00:00"), a location ("UTC", "Europe/London")
+and an offset ("-6h").
+
+Each run queues a job in the same way as /analysis-request.
+
+Response is the schedule as returned by /schedules.`
+}
+
+func (h *httpHandlerSchedulePut) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerSchedulePut) Request() interface{} {
+	return ScheduleDTO{}
+}
+
+func (h *httpHandlerSchedulePut) Response() interface{} {
+	return ScheduleDTO{}
+}
+
+func (h *httpHandlerSchedulePut) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["name"]
+		var spec ScheduleDTO
+		if err := decodeJSON(json.NewDecoder(r.Body), &spec); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		err := s.AddSchedule(k, spec)
+		s.auditRequest(r, &AuditEntryDTO{Action: AuditSchedulePut, Name: k, Request: spec}, err)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		sc, _ := s.Schedule(k)
+		WriteJSONResponse(w, sc)
+	}
+}
+
+type httpHandlerScheduleDelete struct{}
+
+func (h *httpHandlerScheduleDelete) Method() string {
+	return "DELETE"
+}
+
+func (h *httpHandlerScheduleDelete) Path() string {
+	return "/schedules/{name}"
+}
+
+func (h *httpHandlerScheduleDelete) Description() string {
+	return "Removes a scheduled recurring analysis."
+}
+
+func (h *httpHandlerScheduleDelete) Readme() string {
+	return `Jobs that have already been queued by the schedule are left alone.`
+}
+
+func (h *httpHandlerScheduleDelete) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerScheduleDelete) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerScheduleDelete) Response() interface{} {
+	return nil
+}
+
+func (h *httpHandlerScheduleDelete) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["name"]
+		var err error
+		if !s.RemoveSchedule(k) {
+			err = unknownError("schedule", k)
+		}
+		s.auditRequest(r, &AuditEntryDTO{Action: AuditScheduleDelete, Name: k}, err)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type httpHandlerSchedulePause struct {
+	paused bool
+}
+
+func (h *httpHandlerSchedulePause) Method() string {
+	return "POST"
+}
+
+func (h *httpHandlerSchedulePause) Path() string {
+	if h.paused {
+		return "/schedules/{name}/pause"
+	}
+	return "/schedules/{name}/resume"
+}
+
+func (h *httpHandlerSchedulePause) Description() string {
+	if h.paused {
+		return "Pauses a scheduled recurring analysis."
+	}
+	return "Resumes a paused scheduled recurring analysis."
+}
+
+func (h *httpHandlerSchedulePause) Readme() string {
+	if h.paused {
+		return `A paused schedule does not run until it is resumed.
+
+Response is the schedule as returned by /schedules.`
+	}
+	return `Runs missed while paused are skipped, the schedule next runs at the
+first time after now.
+
+Response is the schedule as returned by /schedules.`
+}
+
+func (h *httpHandlerSchedulePause) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerSchedulePause) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerSchedulePause) Response() interface{} {
+	return ScheduleDTO{}
+}
+
+func (h *httpHandlerSchedulePause) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["name"]
+		var err error
+		if !s.PauseSchedule(k, h.paused) {
+			err = unknownError("schedule", k)
+		}
+		action := AuditScheduleResume
+		if h.paused {
+			action = AuditSchedulePause
+		}
+		s.auditRequest(r, &AuditEntryDTO{Action: action, Name: k}, err)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		sc, _ := s.Schedule(k)
+		WriteJSONResponse(w, sc)
+	}
+}
+
+type httpHandlerFactories struct {
+	kind string
+}
+
+func (h *httpHandlerFactories) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerFactories) Path() string {
+	return "/" + h.kind + "-types"
+}
+
+func (h *httpHandlerFactories) Description() string {
+	return "Gets the " + strings.Replace(h.kind, "-", " ", -1) + " factories and the parameters that they take."
+}
+
+func (h *httpHandlerFactories) Readme() string {
+	return `Response:
+{
+  "...": {
+    "name": "...",
+    "description": "...",
+    "params": [
+      {
+        "name": "interval",
+        "type": "duration",
+        "default": "1s",
+        "required": false,
+        "description": "..."
+      }
+    ]
+  }
+}
+
+type is one of "string", "int", "float", "bool", "duration" (such as
+"1m30s") or "time" (RFC 3339).`
+}
+
+func (h *httpHandlerFactories) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerFactories) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerFactories) Response() interface{} {
+	return FactoryMapDTO{}
+}
+
+func (h *httpHandlerFactories) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch h.kind {
+		case "analyst":
+			WriteJSONResponse(w, analystFactories())
+		case "data-loader":
+			WriteJSONResponse(w, dataLoaderFactories())
+		default:
+			WriteJSONResponse(w, producerFactories())
+		}
+	}
+}
+
+type httpHandlerComponentPut struct {
+	kind string
+}
+
+func (h *httpHandlerComponentPut) Method() string {
+	return "PUT"
+}
+
+func (h *httpHandlerComponentPut) Path() string {
+	return "/" + h.kind + "s/{name}"
+}
+
+func (h *httpHandlerComponentPut) Description() string {
+	return "Creates or replaces a " + strings.Replace(h.kind, "-", " ", -1) + " using a factory."
+}
+
+func (h *httpHandlerComponentPut) Readme() string {
+	r := `Request:
+{
+  "factory": "...",
+  "params": {},`
+	switch h.kind {
+	case "analyst":
+		r += `
+  "dataLoaders": ["..."]`
+	default:
+		r += `
+  "concurrency": 0`
+	}
+	r += `
+}
+
+The available factories are listed by /` + h.kind + `-types. Jobs that have
+already been queued keep using the ` + strings.Replace(h.kind, "-", " ", -1) + ` that they were created with.
+
+Response is the ` + strings.Replace(h.kind, "-", " ", -1) + ` as listed by /` + h.kind + `s.`
+	if h.kind == "analyst" {
+		r += ` The data loaders must already be registered.`
+	} else {
+		r += ` concurrency is the number of jobs that can use it at the same time, 0
+for no limit.`
+	}
+	return r
+}
+
+func (h *httpHandlerComponentPut) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerComponentPut) Request() interface{} {
+	return ComponentConfig{}
+}
+
+func (h *httpHandlerComponentPut) Response() interface{} {
+	switch h.kind {
+	case "analyst":
+		return AnalystDTO{}
+	case "data-loader":
+		return DataLoaderDTO{}
+	default:
+		return ProducerDTO{}
+	}
+}
+
+func (h *httpHandlerComponentPut) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["name"]
+		var c ComponentConfig
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		if err := decodeJSON(d, &c); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		var err error
+		switch h.kind {
+		case "analyst":
+			err = s.CreateAnalyst(k, c, true)
+		case "data-loader":
+			err = s.CreateDataLoader(k, c, true)
+		default:
+			err = s.CreateProducer(k, c, true)
+		}
+		s.auditRequest(r, &AuditEntryDTO{Action: AuditComponentPut, Component: h.kind, Name: k, Request: c}, err)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		var (
+			v  registryItem
+			ok bool
+		)
+		switch h.kind {
+		case "analyst":
+			if v, ok = s.analysts.item(k); ok {
+				WriteJSONResponse(w, newAnalystDTO(v))
+			}
+		case "data-loader":
+			if v, ok = s.dataLoaders.item(k); ok {
+				WriteJSONResponse(w, newDataLoaderDTO(v))
+			}
+		default:
+			if v, ok = s.producers.item(k); ok {
+				WriteJSONResponse(w, newProducerDTO(v))
+			}
+		}
+		if !ok {
+			// Removed again before we could respond.
+			WriteError(w, r, unknownError(strings.Replace(h.kind, "-", " ", -1), k))
+		}
+	}
+}
+
+type httpHandlerComponentDelete struct {
+	kind string
+}
+
+func (h *httpHandlerComponentDelete) Method() string {
+	return "DELETE"
+}
+
+func (h *httpHandlerComponentDelete) Path() string {
+	return "/" + h.kind + "s/{name}"
+}
+
+func (h *httpHandlerComponentDelete) Description() string {
+	return "Removes a " + strings.Replace(h.kind, "-", " ", -1) + "."
+}
+
+func (h *httpHandlerComponentDelete) Readme() string {
+	r := `Jobs that have already been queued keep using the ` + strings.Replace(h.kind, "-", " ", -1) + ` that they
+were created with.`
+	if h.kind == "data-loader" {
+		r += ` A data loader used by an analyst created from a
+factory can not be removed, 409 Conflict is returned instead.`
+	}
+	return r
+}
+
+func (h *httpHandlerComponentDelete) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerComponentDelete) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerComponentDelete) Response() interface{} {
+	return nil
+}
+
+func (h *httpHandlerComponentDelete) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := mux.Vars(r)["name"]
+		var (
+			ok  bool
+			err error
+		)
+		switch h.kind {
+		case "analyst":
+			ok = s.UnregisterAnalyst(k)
+		case "data-loader":
+			if ok, err = s.UnregisterDataLoader(k); err != nil {
+				err = NewAPIError(http.StatusConflict, ErrorCodeConflict, "%s", err)
+			}
+		default:
+			ok = s.UnregisterProducer(k)
+		}
+		if err == nil && !ok {
+			err = unknownError(strings.Replace(h.kind, "-", " ", -1), k)
+		}
+		s.auditRequest(r, &AuditEntryDTO{Action: AuditComponentDelete, Component: h.kind, Name: k}, err)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type httpHandlerAudit struct{}
+
+func (h *httpHandlerAudit) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerAudit) Path() string {
+	return "/audit"
+}
+
+func (h *httpHandlerAudit) Description() string {
+	return "Gets a page of the audit log."
+}
+
+func (h *httpHandlerAudit) Readme() string {
+	return `Query parameters:
+  action   - only entries for an action, such as "job.submit".
+  job      - only entries for a job.
+  identity - only entries for an identity, such as "token:ci".
+  since    - only entries at or after an RFC 3339 time.
+  until    - only entries before an RFC 3339 time.
+  offset   - number of entries to skip, defaults to 0.
+  limit    - max number of entries to return, defaults to 100 (max 1000).
+
+Entries are returned newest first. Submitting and cancelling jobs, every
+change to the state of a job and changes to components and schedules made
+through the API are recorded along with who made them and the request
+body. Failed actions are recorded with their error.
+
+Returns 404 Not Found when slurpd is not keeping an audit log.`
+}
+
+func (h *httpHandlerAudit) Role() Role {
+	return RoleAdmin
+}
+
+func (h *httpHandlerAudit) Params() []HTTPParam {
+	return []HTTPParam{
+		{Name: "action", In: "query", Type: "string", Description: "Only entries for an action."},
+		{Name: "job", In: "query", Type: "string", Description: "Only entries for a job."},
+		{Name: "identity", In: "query", Type: "string", Description: `Only entries for an identity, such as "token:ci".`},
+		{Name: "since", In: "query", Type: "string", Description: "Only entries at or after an RFC 3339 time."},
+		{Name: "until", In: "query", Type: "string", Description: "Only entries before an RFC 3339 time."},
+		{Name: "offset", In: "query", Type: "integer", Description: "Number of entries to skip."},
+		{Name: "limit", In: "query", Type: "integer", Description: "Number of entries to return, from 1 to 1000."},
+	}
+}
+
+func (h *httpHandlerAudit) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerAudit) Response() interface{} {
+	return AuditDTO{}
+}
+
+func (h *httpHandlerAudit) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	const (
+		defaultLimit = 100
+		maxLimit     = 1000
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			err    error
+			offset = 0
+			limit  = defaultLimit
+			errs   ValidationError
 		)
-		i := 0
-		for _, a := range req.PointInTimeAnalysis {
-			if _, ok = s.analystMap[a.Analyst]; !ok {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				log.Printf("Unknown analyst %q.\n", a.Analyst)
-				return
+		q := r.URL.Query()
+		f := AuditFilter{
+			Action:   q.Get("action"),
+			Job:      q.Get("job"),
+			Identity: q.Get("identity"),
+		}
+		if v := q.Get("since"); v != "" {
+			if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+				errs.add("since", ErrorCodeInvalid, "expecting an RFC 3339 time, got %q", v)
+			}
+		}
+		if v := q.Get("until"); v != "" {
+			if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+				errs.add("until", ErrorCodeInvalid, "expecting an RFC 3339 time, got %q", v)
 			}
-			ar[i] = s.analystMap[a.Analyst].AnalysisRequest(a.Time)
-			i++
-		}
-		for _, a := range req.RangeAnalysis {
-			if _, ok = s.analystMap[a.Analyst]; !ok {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				log.Printf("Unknown analyst %q.\n", a.Analyst)
-				return
+		}
+		if v := q.Get("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				errs.add("offset", ErrorCodeInvalid, "expecting an integer of at least 0, got %q", v)
 			}
-			ar[i] = s.analystMap[a.Analyst].AnalysisRangeRequest(a.From, a.Until)
-			i++
 		}
-		go s.SlurpAnalysisRequest(p, ar...)
-		WriteJSONResponse(w, "OK")
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLimit {
+				errs.add("limit", ErrorCodeInvalid, "expecting an integer from 1 to %d, got %q", maxLimit, v)
+			}
+		}
+		if err = errs.err(); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if s.auditLog == nil {
+			WriteError(w, r, NewAPIError(http.StatusNotFound, ErrorCodeNotFound, "there is no audit log"))
+			return
+		}
+		entries, err := s.auditLog.Entries(f, offset, limit)
+		if err != nil {
+			WriteError(w, r, fmt.Errorf("unable to read the audit log: %s", err))
+			return
+		}
+		WriteJSONResponse(w, AuditDTO{
+			Offset:  offset,
+			Limit:   limit,
+			Entries: entries,
+		})
 	}
 }
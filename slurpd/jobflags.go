@@ -0,0 +1,134 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// JobRequestFlags builds a JobRequestDTO from command line flags. The job
+// request can either be read from a JSON file or be described by the flags.
+type JobRequestFlags struct {
+	file     string
+	producer string
+	analysts stringsFlag
+	at       string
+	from     string
+	until    string
+	params   string
+	priority int
+}
+
+// NewJobRequestFlags adds the job request flags to fs.
+func NewJobRequestFlags(fs *flag.FlagSet) *JobRequestFlags {
+	f := &JobRequestFlags{}
+	fs.StringVar(&f.file, "request", "", "JSON job request file to use instead of the other flags, - for stdin")
+	fs.StringVar(&f.producer, "producer", "", "the producer")
+	fs.Var(&f.analysts, "analyst", "an analyst, can be given more than once")
+	fs.StringVar(&f.at, "time", "", "point in time to analyse, RFC 3339 or an expression such as \"today 00:00\"")
+	fs.StringVar(&f.from, "from", "", "start of the range to analyse")
+	fs.StringVar(&f.until, "until", "", "end of the range to analyse")
+	fs.StringVar(&f.params, "params", "", "JSON object of parameters for the analysts")
+	fs.IntVar(&f.priority, "priority", 0, "jobs with a higher priority are started first")
+	return f
+}
+
+// JobRequest returns the job request described by the flags once they have
+// been parsed. Time expressions are worked out relative to now.
+func (f *JobRequestFlags) JobRequest(now time.Time) (*JobRequestDTO, error) {
+	req := &JobRequestDTO{}
+	if f.file != "" {
+		var r io.Reader = os.Stdin
+		if f.file != "-" {
+			file, err := os.Open(f.file)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			r = file
+		}
+		if err := json.NewDecoder(r).Decode(req); err != nil {
+			return nil, fmt.Errorf("-request: %s", err)
+		}
+		if f.priority != 0 {
+			req.Priority = f.priority
+		}
+		return req, nil
+	}
+	if f.producer == "" || len(f.analysts) == 0 {
+		return nil, fmt.Errorf("-producer and -analyst are required")
+	}
+	req.Producer = f.producer
+	req.Priority = f.priority
+	var p slurp.Params
+	if f.params != "" {
+		if err := json.Unmarshal([]byte(f.params), &p); err != nil {
+			return nil, fmt.Errorf("-params: %s", err)
+		}
+	}
+	switch {
+	case f.at != "" && f.from == "" && f.until == "":
+		t, err := ParseFlagTime("time", f.at, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range f.analysts {
+			req.PointInTimeAnalysis = append(req.PointInTimeAnalysis, PointInTimeAnalysisDTO{
+				Analyst: a,
+				Time:    t,
+				Params:  p,
+			})
+		}
+	case f.at == "" && f.from != "" && f.until != "":
+		from, err := ParseFlagTime("from", f.from, now)
+		if err != nil {
+			return nil, err
+		}
+		until, err := ParseFlagTime("until", f.until, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range f.analysts {
+			req.RangeAnalysis = append(req.RangeAnalysis, RangeAnalysisDTO{
+				Analyst: a,
+				From:    from,
+				Until:   until,
+				Params:  p,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("expecting either -time or both -from and -until")
+	}
+	return req, nil
+}
+
+// ParseFlagTime reads the value of the flag called name as an RFC 3339 time
+// or as a time expression relative to now.
+func ParseFlagTime(name string, v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := ParseTimeExpression(v, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-%s: %s", name, err)
+	}
+	return t, nil
+}
+
+// stringsFlag is a flag that can be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
@@ -0,0 +1,200 @@
+package slurpd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// metricSample is a single line of a metric family.
+type metricSample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+// metricFamily is a set of samples that share a name, type and help text.
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []metricSample
+}
+
+// metricSet collects metric families so that they can be written out in
+// the Prometheus text exposition format.
+type metricSet struct {
+	families map[string]*metricFamily
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{
+		families: make(map[string]*metricFamily),
+	}
+}
+
+// add records a sample. labels is a list of name, value pairs.
+func (m *metricSet) add(name string, typ string, help string, value float64, labels ...string) {
+	m.addSample(name, "", typ, help, value, labels...)
+}
+
+// addSample records a sample with a suffix such as _sum or _count.
+func (m *metricSet) addSample(name string, suffix string, typ string, help string, value float64, labels ...string) {
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{
+			name: name,
+			typ:  typ,
+			help: help,
+		}
+		m.families[name] = f
+	}
+	f.samples = append(f.samples, metricSample{
+		suffix: suffix,
+		labels: formatMetricLabels(labels...),
+		value:  value,
+	})
+}
+
+// WriteTo writes the metrics in a stable order.
+func (m *metricSet) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	names := make([]string, 0, len(m.families))
+	for k := range m.families {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		sort.SliceStable(f.samples, func(i, j int) bool {
+			if f.samples[i].labels != f.samples[j].labels {
+				return f.samples[i].labels < f.samples[j].labels
+			}
+			return f.samples[i].suffix < f.samples[j].suffix
+		})
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		for _, s := range f.samples {
+			n, err = fmt.Fprintf(w, "%s%s%s %s\n", f.name, s.suffix, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatMetricLabels(labels ...string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", labels[i], metricLabelEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (m *metricSet) addItemChannelStat(prefix string, what string, st slurp.ItemChannelStat, labels ...string) {
+	m.add(prefix+"_items_total", "counter", "Number of items sent to the "+what+".", float64(st.Count), labels...)
+	m.add(prefix+"_item_rate", "gauge", "Recent items per second sent to the "+what+".", st.Rate, labels...)
+	m.add(prefix+"_channel_length", "gauge", "Number of items buffered for the "+what+".", float64(st.Length), labels...)
+	m.add(prefix+"_channel_capacity", "gauge", "Size of the item buffer for the "+what+".", float64(st.Capacity), labels...)
+	m.add(prefix+"_in_blocked_seconds_total", "counter", "Time spent waiting for items to arrive for the "+what+".", st.InBlocked.Seconds(), labels...)
+	m.add(prefix+"_out_blocked_seconds_total", "counter", "Time spent waiting for the "+what+" items to be taken.", st.OutBlocked.Seconds(), labels...)
+}
+
+func (m *metricSet) addDataLoaderStat(k string, st *slurp.DataLoaderStat) {
+	const (
+		calls    = "slurpd_data_loader_calls_total"
+		results  = "slurpd_data_loader_results_total"
+		duration = "slurpd_data_loader_duration_seconds"
+	)
+	m.add(calls, "counter", "Number of calls made to the data loader.", float64(st.Called.Count), "loader", k)
+	m.add(results, "counter", "Number of data loader calls by the type of result returned.", float64(st.ReturnEmptyKey.Count), "loader", k, "result", "empty_key")
+	m.add(results, "counter", "Number of data loader calls by the type of result returned.", float64(st.ReturnNilData.Count), "loader", k, "result", "nil_data")
+	m.add(results, "counter", "Number of data loader calls by the type of result returned.", float64(st.ReturnData.Count), "loader", k, "result", "data")
+	help := "Duration of data loader calls. Quantiles cover the recent stat window."
+	p := st.Called.Percentile
+	if st.Window != nil {
+		p = st.Window.Called.Percentile
+	}
+	for _, q := range []struct {
+		quantile string
+		value    float64
+	}{
+		{"0.5", p.P50.Seconds()},
+		{"0.9", p.P90.Seconds()},
+		{"0.99", p.P99.Seconds()},
+		{"0.999", p.P999.Seconds()},
+	} {
+		m.add(duration, "summary", help, q.value, "loader", k, "quantile", q.quantile)
+	}
+	m.addSample(duration, "_sum", "summary", help, st.Called.DurationTotal.Seconds(), "loader", k)
+	m.addSample(duration, "_count", "summary", help, float64(st.Called.Count), "loader", k)
+}
+
+// Metrics collects the current metrics for the daemon.
+func (s *Slurpd) metrics() *metricSet {
+	m := newMetricSet()
+	producerItems, producerRate := s.producerItemStat()
+	for k := range s.producers.snapshot() {
+		m.add("slurpd_producer_items_total", "counter", "Number of items produced for slurp jobs.", float64(producerItems[k]), "producer", k)
+		m.add("slurpd_producer_item_rate", "gauge", "Recent items per second produced for running slurp jobs.", producerRate[k], "producer", k)
+	}
+	for k, v := range s.dataLoaders.snapshot() {
+		if w, ok := v.value.(*slurp.DataLoaderStatWrapper); ok {
+			m.addDataLoaderStat(k, w.Stat())
+		}
+	}
+	queued, running, completed, cancelled := s.jobCount()
+	m.add("slurpd_jobs", "gauge", "Number of slurp jobs by state.", float64(queued), "state", "queued")
+	m.add("slurpd_jobs", "gauge", "Number of slurp jobs by state.", float64(running), "state", "running")
+	m.add("slurpd_jobs", "gauge", "Number of slurp jobs by state.", float64(completed), "state", "completed")
+	m.add("slurpd_jobs", "gauge", "Number of slurp jobs by state.", float64(cancelled), "state", "cancelled")
+	for k, v := range s.runningJobs() {
+		m.addItemChannelStat("slurpd_job", "job", v.slurper.SlurpStat(), "job", k, "producer", v.producer)
+		rb := v.slurper.RequestBlocked()
+		for i, st := range v.slurper.RequestStat() {
+			m.add(
+				"slurpd_analysis_request_blocked_seconds_total",
+				"counter",
+				"Time the job has spent waiting for the analysis request to take items.",
+				rb[i].Seconds(),
+				"job", k,
+				"analyst", v.analysts[i],
+				"request", strconv.Itoa(i),
+			)
+			m.addItemChannelStat(
+				"slurpd_analysis_request",
+				"analysis request",
+				st,
+				"job", k,
+				"analyst", v.analysts[i],
+				"request", strconv.Itoa(i),
+			)
+		}
+	}
+	return m
+}
+
+// MetricsHandlerFunc returns a http.HandlerFunc that serves the daemon
+// metrics in the Prometheus text exposition format. Like the rest of the
+// HTTP API the metrics need the viewer role.
+func MetricsHandlerFunc(s *Slurpd) http.HandlerFunc {
+	return s.authorizeRole("/metrics", RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.metrics().WriteTo(w)
+	})
+}
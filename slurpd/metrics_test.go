@@ -0,0 +1,36 @@
+package slurpd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetricSetWriteTo(t *testing.T) {
+	m := newMetricSet()
+	m.add("b_total", "counter", "B help.", 2, "k", "y")
+	m.add("b_total", "counter", "B help.", 1, "k", "x\"\n\\")
+	m.add("a", "gauge", "A help.", 0.5)
+	m.addSample("c_seconds", "_sum", "summary", "C help.", 3, "k", "x")
+	m.add("c_seconds", "summary", "C help.", 1, "k", "x", "quantile", "0.5")
+	m.addSample("c_seconds", "_count", "summary", "C help.", 4, "k", "x")
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP a A help.
+# TYPE a gauge
+a 0.5
+# HELP b_total B help.
+# TYPE b_total counter
+b_total{k="x\"\n\\"} 1
+b_total{k="y"} 2
+# HELP c_seconds C help.
+# TYPE c_seconds summary
+c_seconds{k="x",quantile="0.5"} 1
+c_seconds_count{k="x"} 4
+c_seconds_sum{k="x"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected metrics output.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,301 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// HTTPHandlerSpec can be implemented by an HTTPHandler to describe what it
+// takes and returns in the OpenAPI document served at /openapi.json.
+type HTTPHandlerSpec interface {
+	// Params describes the path and query parameters. Path parameters that
+	// are not described are documented as strings.
+	Params() []HTTPParam
+	// Request returns a value of the type sent as the request body, or nil
+	// when there is no body.
+	Request() interface{}
+	// Response returns a value of the type sent as the response body, or
+	// nil when the response has no content.
+	Response() interface{}
+}
+
+// HTTPParam describes a path or query parameter. In is "path" or "query"
+// and Type is a JSON schema type such as "string" or "integer".
+type HTTPParam struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// openAPIVersion is the version of OpenAPI that the document follows.
+const openAPIVersion = "3.0.3"
+
+var pathParamRegexp = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// OpenAPI returns an OpenAPI 3 document describing the handlers. Handlers
+// that do not implement HTTPHandlerSpec are listed without a request or
+// response body.
+func OpenAPI(handlers []HTTPHandler) map[string]interface{} {
+	b := &openAPIBuilder{
+		schemas: make(map[string]interface{}),
+		types:   make(map[reflect.Type]string),
+	}
+	paths := make(map[string]map[string]interface{})
+	for _, h := range handlers {
+		path := pathParamRegexp.ReplaceAllString(h.Path(), "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(h.Method())] = b.operation(h)
+	}
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "Slurpd HTTP API",
+			"version": "1",
+		},
+		// Relative to the document so that it works where ever the API is
+		// mounted.
+		"servers": []interface{}{
+			map[string]interface{}{"url": "."},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+		},
+	}
+}
+
+// openAPIBuilder works out schemas for Go types. Named types are put in
+// the components of the document and referred to.
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+	types   map[reflect.Type]string
+}
+
+func (b *openAPIBuilder) operation(h HTTPHandler) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary": h.Description(),
+	}
+	if h.Readme() != "" {
+		op["description"] = h.Readme()
+	}
+	var (
+		params     []HTTPParam
+		hasSpec    bool
+		request    interface{}
+		response   interface{}
+		responses  = make(map[string]interface{})
+		parameters = make([]interface{}, 0)
+	)
+	if spec, ok := h.(HTTPHandlerSpec); ok {
+		hasSpec = true
+		params = spec.Params()
+		request = spec.Request()
+		response = spec.Response()
+	}
+	described := make(map[string]bool)
+	for _, p := range params {
+		described[p.In+" "+p.Name] = true
+	}
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(h.Path(), -1) {
+		if !described["path "+m[1]] {
+			params = append(params, HTTPParam{Name: m[1], In: "path", Type: "string"})
+		}
+	}
+	for _, p := range params {
+		v := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.Required || p.In == "path",
+			"schema":   map[string]interface{}{"type": p.Type},
+		}
+		if p.Description != "" {
+			v["description"] = p.Description
+		}
+		parameters = append(parameters, v)
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+	if request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  b.content(request),
+		}
+	}
+	switch {
+	case response != nil:
+		responses["200"] = map[string]interface{}{
+			"description": "OK",
+			"content":     b.content(response),
+		}
+	case hasSpec:
+		responses["204"] = map[string]interface{}{
+			"description": "No Content",
+		}
+	default:
+		responses["200"] = map[string]interface{}{
+			"description": "OK",
+		}
+	}
+	responses["default"] = map[string]interface{}{
+		"description": "Error",
+		"content":     b.content(ErrorDTO{}),
+	}
+	op["responses"] = responses
+	// The role needed when authentication is turned on.
+	op["x-role"] = handlerRole(h).String()
+	return op
+}
+
+func (b *openAPIBuilder) content(v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": b.schema(reflect.TypeOf(v)),
+		},
+	}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	paramsType   = reflect.TypeOf(slurp.Params{})
+	marshalType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schema returns the schema for t, or a reference to it.
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Duration in nanoseconds."}
+	case paramsType:
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	}
+	if t.Implements(marshalType) || reflect.PtrTo(t).Implements(marshalType) {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if t.Name() == "" {
+			return b.build(t)
+		}
+	default:
+		return b.build(t)
+	}
+	name, ok := b.types[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := b.schemas[name]; taken {
+			name = strings.Replace(t.String(), ".", "", -1)
+		}
+		b.types[t] = name
+		// Reserve the name first in case the type refers to itself.
+		b.schemas[name] = nil
+		b.schemas[name] = b.build(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// build works out the schema for t without using a reference.
+func (b *openAPIBuilder) build(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		b.properties(t, props)
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return map[string]interface{}{}
+}
+
+// properties adds the JSON fields of struct t to props.
+func (b *openAPIBuilder) properties(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.properties(ft, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+	}
+}
+
+type httpHandlerOpenAPI struct{}
+
+func (h *httpHandlerOpenAPI) Method() string {
+	return "GET"
+}
+
+func (h *httpHandlerOpenAPI) Path() string {
+	return "/openapi.json"
+}
+
+func (h *httpHandlerOpenAPI) Description() string {
+	return "Describes the available api as an OpenAPI 3 document."
+}
+
+func (h *httpHandlerOpenAPI) Readme() string {
+	return `Handlers added to HTTPHandlerList describe their parameters, request
+and response by implementing HTTPHandlerSpec.`
+}
+
+func (h *httpHandlerOpenAPI) Params() []HTTPParam {
+	return nil
+}
+
+func (h *httpHandlerOpenAPI) Request() interface{} {
+	return nil
+}
+
+func (h *httpHandlerOpenAPI) Response() interface{} {
+	return map[string]interface{}{}
+}
+
+func (h *httpHandlerOpenAPI) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSONResponse(w, OpenAPI(HTTPHandlerList))
+	}
+}
@@ -0,0 +1,155 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// plainHandler is an HTTPHandler that does not implement HTTPHandlerSpec.
+type plainHandler struct{}
+
+func (h *plainHandler) Method() string {
+	return "GET"
+}
+
+func (h *plainHandler) Path() string {
+	return "/plain/{thing:[a-z]+}"
+}
+
+func (h *plainHandler) Description() string {
+	return "Plain."
+}
+
+func (h *plainHandler) Readme() string {
+	return ""
+}
+
+func (h *plainHandler) HandlerFunc(s *Slurpd) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {}
+}
+
+// collectRefs finds every $ref in a decoded JSON document.
+func collectRefs(v interface{}, refs map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if k == "$ref" {
+				refs[e.(string)] = true
+			}
+			collectRefs(e, refs)
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectRefs(e, refs)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	handlers := append([]HTTPHandler{&plainHandler{}}, HTTPHandlerList...)
+	data, err := json.Marshal(OpenAPI(handlers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]map[string]interface{}
+		}
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("Expecting openapi %q, got %q.", openAPIVersion, doc.OpenAPI)
+	}
+	for _, h := range HTTPHandlerList {
+		if _, ok := doc.Paths[h.Path()][strings.ToLower(h.Method())]; !ok {
+			t.Errorf("Expecting an operation for %s %s.", h.Method(), h.Path())
+		}
+	}
+
+	var raw interface{}
+	json.Unmarshal(data, &raw)
+	refs := make(map[string]bool)
+	collectRefs(raw, refs)
+	for ref := range refs {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("Expecting schema for %q.", ref)
+		}
+	}
+
+	plain := doc.Paths["/plain/{thing}"]["get"]
+	if _, ok := plain["requestBody"]; ok {
+		t.Errorf("Expecting no request body for a handler without a spec.")
+	}
+	params, _ := json.Marshal(plain["parameters"])
+	if want := `[{"in":"path","name":"thing","required":true,"schema":{"type":"string"}}]`; string(params) != want {
+		t.Errorf("Expecting parameters %s, got %s.", want, params)
+	}
+
+	request := doc.Paths["/analysis-request"]["post"]
+	body, _ := json.Marshal(request["requestBody"])
+	if !strings.Contains(string(body), `"$ref":"#/components/schemas/JobRequestDTO"`) {
+		t.Errorf("Expecting a JobRequestDTO request body, got %s.", body)
+	}
+	responses := request["responses"].(map[string]interface{})
+	if _, ok := responses["200"]; !ok {
+		t.Errorf("Expecting a 200 response.")
+	}
+	responses = doc.Paths["/schedules/{name}"]["delete"]["responses"].(map[string]interface{})
+	if _, ok := responses["204"]; !ok {
+		t.Errorf("Expecting a 204 response for delete.")
+	}
+
+	results := doc.Paths["/jobs/{id}/results"]["get"]["parameters"].([]interface{})
+	names := make([]string, len(results))
+	for i, v := range results {
+		names[i] = v.(map[string]interface{})["name"].(string)
+	}
+	if want := []string{"id", "offset", "limit", "format"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expecting parameters %q, got %q.", want, names)
+	}
+
+	props := doc.Components.Schemas["JobRequestDTO"]["properties"].(map[string]interface{})
+	if _, ok := props["pointInTimeAnalysis"]; !ok {
+		t.Errorf("Expecting JobRequestDTO to use JSON field names, got %v.", props)
+	}
+	props = doc.Components.Schemas["APIError"]["properties"].(map[string]interface{})
+	if _, ok := props["status"]; ok {
+		t.Errorf("Expecting fields without JSON to be left out.")
+	}
+	details, _ := json.Marshal(props["details"])
+	if want := `{"items":{"$ref":"#/components/schemas/APIError"},"type":"array"}`; string(details) != want {
+		t.Errorf("Expecting details %s, got %s.", want, details)
+	}
+	started, _ := json.Marshal(doc.Components.Schemas["JobStatusDTO"]["properties"].(map[string]interface{})["started"])
+	if want := `{"format":"date-time","type":"string"}`; string(started) != want {
+		t.Errorf("Expecting started %s, got %s.", want, started)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	router := ConfigureRouter(NewSlurpd(), mux.NewRouter())
+	r := httptest.NewRequest("GET", "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expecting status 200, got %d.", w.Code)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != openAPIVersion {
+		t.Errorf("Expecting an OpenAPI document, got %v.", doc["openapi"])
+	}
+}
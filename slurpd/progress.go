@@ -0,0 +1,75 @@
+package slurpd
+
+import "time"
+
+// ProgressDTO provides how far through its time range a slurp is.
+//
+// Velocity is the number of seconds of data that are being slurped for
+// every second of wall clock time.
+type ProgressDTO struct {
+	Percent   float64       `json:"percent"`
+	Velocity  float64       `json:"velocity"`
+	Remaining time.Duration `json:"remaining"`
+	ETA       *time.Time    `json:"eta,omitempty"`
+}
+
+// slurpVelocity works out the data seconds per wall second for a slurp that
+// started at from (data time) and started (wall time) and has now reached at.
+func slurpVelocity(from time.Time, at *time.Time, started time.Time, now time.Time) float64 {
+	if at == nil || !at.After(from) {
+		return 0
+	}
+	wall := now.Sub(started)
+	if wall <= 0 {
+		return 0
+	}
+	return at.Sub(from).Seconds() / wall.Seconds()
+}
+
+// newProgressDTO works out the progress through from/until when the slurp
+// has reached at and is moving at velocity. When at is before from the ETA
+// includes the time it takes the slurp to reach from.
+func newProgressDTO(from time.Time, until time.Time, at *time.Time, velocity float64, now time.Time) ProgressDTO {
+	p := ProgressDTO{
+		Velocity:  velocity,
+		Remaining: until.Sub(from),
+	}
+	togo := p.Remaining
+	if at != nil && at.Before(from) {
+		togo = until.Sub(*at)
+	}
+	if at != nil && at.After(from) {
+		pos := *at
+		if pos.After(until) {
+			pos = until
+		}
+		p.Remaining = until.Sub(pos)
+		togo = p.Remaining
+		if span := until.Sub(from); span > 0 {
+			p.Percent = 100 * float64(pos.Sub(from)) / float64(span)
+		} else {
+			p.Percent = 100
+		}
+	}
+	if p.Remaining <= 0 {
+		p.Remaining = 0
+		p.Percent = 100
+		p.ETA = &now
+	} else if velocity > 0 {
+		eta := now.Add(time.Duration(float64(togo) / velocity))
+		p.ETA = &eta
+	}
+	return p
+}
+
+// requestAt is how far a request with the range from/until has got when the
+// request has taken an item at and the slurp has reached slurpAt. Requests
+// are only sent the items in their range, so the position of the slurp is
+// used before the request has taken an item and once the slurp has passed
+// the end of the range.
+func requestAt(until time.Time, at *time.Time, slurpAt *time.Time) *time.Time {
+	if at == nil || (slurpAt != nil && !slurpAt.Before(until)) {
+		return slurpAt
+	}
+	return at
+}
@@ -0,0 +1,69 @@
+package slurpd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	from := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	started := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := started.Add(time.Minute)
+	at := from.Add(6 * time.Hour)
+
+	v := slurpVelocity(from, &at, started, now)
+	if v != 360 {
+		t.Errorf("Expecting a velocity of 360, got %v.", v)
+	}
+	p := newProgressDTO(from, until, &at, v, now)
+	if p.Percent != 25 {
+		t.Errorf("Expecting 25%% complete, got %v.", p.Percent)
+	}
+	if p.Remaining != 18*time.Hour {
+		t.Errorf("Expecting 18h remaining, got %s.", p.Remaining)
+	}
+	if want := now.Add(3 * time.Minute); p.ETA == nil || !p.ETA.Equal(want) {
+		t.Errorf("Expecting an ETA of %s, got %v.", want, p.ETA)
+	}
+
+	// A later range that has not been reached yet.
+	p = newProgressDTO(until, until.Add(6*time.Hour), &at, v, now)
+	if p.Percent != 0 {
+		t.Errorf("Expecting 0%% complete, got %v.", p.Percent)
+	}
+	if p.Remaining != 6*time.Hour {
+		t.Errorf("Expecting 6h remaining, got %s.", p.Remaining)
+	}
+	if want := now.Add(4 * time.Minute); p.ETA == nil || !p.ETA.Equal(want) {
+		t.Errorf("Expecting an ETA of %s, got %v.", want, p.ETA)
+	}
+
+	// An earlier range that has been passed.
+	p = newProgressDTO(from, at.Add(-time.Hour), &at, v, now)
+	if p.Percent != 100 || p.Remaining != 0 {
+		t.Errorf("Expecting 100%% complete with nothing remaining, got %v and %s.", p.Percent, p.Remaining)
+	}
+
+	// Nothing slurped yet.
+	p = newProgressDTO(from, until, nil, slurpVelocity(from, nil, started, now), now)
+	if p.Percent != 0 || p.Velocity != 0 || p.ETA != nil {
+		t.Errorf("Expecting no progress, got %+v.", p)
+	}
+}
+
+func TestRequestAt(t *testing.T) {
+	until := time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)
+	at := until.Add(-time.Hour)
+	before := until.Add(-2 * time.Hour)
+	after := until.Add(time.Hour)
+	if got := requestAt(until, &before, &at); got != &before {
+		t.Errorf("Expecting the position of the request, got %v.", got)
+	}
+	if got := requestAt(until, nil, &at); got != &at {
+		t.Errorf("Expecting the position of the slurp before the request has an item, got %v.", got)
+	}
+	if got := requestAt(until, &before, &after); got != &after {
+		t.Errorf("Expecting the position of the slurp once it has passed the range, got %v.", got)
+	}
+}
@@ -0,0 +1,281 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// queueFileJob is a job as kept in the job queue file.
+type queueFileJob struct {
+	Job         string             `json:"job"`
+	Queued      time.Time          `json:"queued"`
+	Identity    *Identity          `json:"identity,omitempty"`
+	Request     *JobRequestDTO     `json:"request"`
+	Checkpoints []slurp.Checkpoint `json:"checkpoints,omitempty"`
+}
+
+// MaxConcurrentJobs sets the number of jobs that can run at the same time.
+// Zero means no limit.
+func (s *Slurpd) MaxConcurrentJobs(n int) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	s.maxJobs = n
+	s.schedule()
+}
+
+// ProducerConcurrency sets the number of jobs using the producer at k that
+// can run at the same time. Zero means no limit.
+func (s *Slurpd) ProducerConcurrency(k string, n int) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	setLimit(s.producerLimit, k, n)
+	s.schedule()
+}
+
+// DataLoaderConcurrency sets the number of jobs using the data loader at k
+// that can run at the same time. Zero means no limit.
+func (s *Slurpd) DataLoaderConcurrency(k string, n int) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	setLimit(s.dataLoaderLimit, k, n)
+	s.schedule()
+}
+
+func setLimit(m map[string]int, k string, n int) {
+	if n > 0 {
+		m[k] = n
+	} else {
+		delete(m, k)
+	}
+}
+
+// JobQueueFile sets the file used to keep submitted jobs that have not yet
+// finished. Jobs already in the file are queued again, so producers, data
+// loaders and analysts must be registered first. Jobs that were running
+// resume from their last checkpoint, or start from scratch without one.
+func (s *Slurpd) JobQueueFile(path string) error {
+	var jobs []queueFileJob
+	f, err := os.Open(path)
+	if err == nil {
+		err = json.NewDecoder(f).Decode(&jobs)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	s.queueFile = path
+	for _, v := range jobs {
+		p, ar, err := s.analysisRequests(v.Request)
+		if err != nil {
+			log.Printf("Unable to restore job %q: %s.\n", v.Job, err)
+			continue
+		}
+		job := s.newJob(v.Job, p, ar...)
+		job.queued = v.Queued
+		job.priority = v.Request.Priority
+		job.request = v.Request
+		job.identity = v.Identity
+		s.resumeJob(v.Job, job, v.Checkpoints)
+		s.addJob(v.Job, job)
+	}
+	s.saveJobQueue()
+	s.schedule()
+	return nil
+}
+
+// queuedJobs returns the keys of the queued jobs, highest priority first and
+// then in the order that they were queued. The caller must hold jobMutex.
+func (s *Slurpd) queuedJobs() []string {
+	r := make([]string, 0)
+	for k, v := range s.slurperMap {
+		if v.state == jobQueued {
+			r = append(r, k)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		a, b := s.slurperMap[r[i]], s.slurperMap[r[j]]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	})
+	return r
+}
+
+// schedule starts as many queued jobs as the concurrency limits allow. A job
+// that is held back by a producer or data loader limit does not hold back
+// the jobs behind it. Nothing is started once slurpd is draining. The caller
+// must hold jobMutex.
+func (s *Slurpd) schedule() {
+	if s.draining {
+		return
+	}
+	running := 0
+	producers := make(map[string]int)
+	loaders := make(map[string]int)
+	for _, v := range s.slurperMap {
+		if v.state != jobRunning {
+			continue
+		}
+		running++
+		producers[v.producer]++
+		for _, l := range v.loaders {
+			loaders[l]++
+		}
+	}
+	for _, k := range s.queuedJobs() {
+		if s.maxJobs > 0 && running >= s.maxJobs {
+			return
+		}
+		job := s.slurperMap[k]
+		if n, ok := s.producerLimit[job.producer]; ok && producers[job.producer] >= n {
+			continue
+		}
+		blocked := false
+		for _, l := range job.loaders {
+			if n, ok := s.dataLoaderLimit[l]; ok && loaders[l] >= n {
+				blocked = true
+				break
+			}
+		}
+		if blocked {
+			continue
+		}
+		running++
+		producers[job.producer]++
+		for _, l := range job.loaders {
+			loaders[l]++
+		}
+		job.state = jobRunning
+		job.started = s.clock.Now()
+		s.publishJob(k, job)
+		s.auditJob(k, job)
+		go s.runJob(k, job)
+	}
+}
+
+// saveJobQueue records the submitted jobs that have not yet finished, or
+// that were interrupted by Drain, so that they can be written to the job
+// queue file. The caller must hold jobMutex and release it with unlockJobs,
+// which writes the file.
+func (s *Slurpd) saveJobQueue() {
+	if s.queueFile == "" {
+		return
+	}
+	jobs := make([]queueFileJob, 0)
+	for k, v := range s.slurperMap {
+		if v.request == nil || (v.finished != nil && !v.interrupted) {
+			continue
+		}
+		jobs = append(jobs, queueFileJob{
+			Job:         k,
+			Queued:      v.queued,
+			Identity:    v.identity,
+			Request:     v.request,
+			Checkpoints: v.checkpoints,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return s.slurperMap[jobs[i].Job].seq < s.slurperMap[jobs[j].Job].seq
+	})
+	s.queueSeq++
+	s.queueJobs = jobs
+}
+
+// unlockJobs releases jobMutex and then writes the job queue file if it has
+// changed, along with any job audit entries, so that other jobs are not held
+// up while they are written.
+func (s *Slurpd) unlockJobs() {
+	path, jobs, seq := s.queueFile, s.queueJobs, s.queueSeq
+	audit := s.auditPending
+	s.queueJobs, s.auditPending = nil, nil
+	if audit != nil {
+		// Taken before jobMutex is released so that entries are written in
+		// the order that they happened.
+		s.auditMutex.Lock()
+	}
+	s.jobMutex.Unlock()
+	if audit != nil {
+		for _, e := range audit {
+			s.audit(e)
+		}
+		s.auditMutex.Unlock()
+	}
+	if jobs != nil {
+		s.writeJobQueue(path, jobs, seq)
+	}
+}
+
+// writeJobQueue writes version seq of the job queue to path, unless a later
+// version has already been written.
+func (s *Slurpd) writeJobQueue(path string, jobs []queueFileJob, seq int64) {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	if seq <= s.queueSaved {
+		return
+	}
+	s.queueSaved = seq
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("Unable to save job queue: %s.\n", err)
+		return
+	}
+	err = json.NewEncoder(f).Encode(jobs)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		log.Printf("Unable to save job queue: %s.\n", err)
+	}
+}
+
+// jobStatus returns the state of every job that we know about.
+func (s *Slurpd) jobStatus() JobMapDTO {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	r := make(JobMapDTO, len(s.slurperMap))
+	for i, k := range s.queuedJobs() {
+		v := s.slurperMap[k]
+		r[k] = JobStatusDTO{
+			State:    v.state,
+			Priority: v.priority,
+			Producer: v.producer,
+			Identity: v.identity,
+			Position: i + 1,
+			Queued:   v.queued,
+		}
+	}
+	for k, v := range s.slurperMap {
+		if v.state == jobQueued {
+			continue
+		}
+		var started *time.Time
+		if !v.started.IsZero() {
+			t := v.started
+			started = &t
+		}
+		r[k] = JobStatusDTO{
+			State:    v.state,
+			Priority: v.priority,
+			Producer: v.producer,
+			Identity: v.identity,
+			Queued:   v.queued,
+			Started:  started,
+			Finished: v.finished,
+		}
+	}
+	return r
+}
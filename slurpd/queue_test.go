@@ -0,0 +1,362 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+type testAnalyst struct {
+	dataLoaders []slurp.DataLoader
+}
+
+func (a *testAnalyst) Name() string {
+	return "Test Analyst"
+}
+
+func (a *testAnalyst) Description() string {
+	return "Analyst used for testing."
+}
+
+func (a *testAnalyst) DataLoaders() []slurp.DataLoader {
+	return a.dataLoaders
+}
+
+func (a *testAnalyst) AnalysisRequest(pointInTime time.Time) *slurp.AnalysisRequest {
+	return a.AnalysisRangeRequest(a.RangeForAnalysisRequest(pointInTime))
+}
+
+func (a *testAnalyst) AnalysisRangeRequest(from time.Time, until time.Time) *slurp.AnalysisRequest {
+	return &slurp.AnalysisRequest{
+		Analyst:     a,
+		TimeFrom:    from,
+		TimeUntil:   until,
+		DataLoader:  a.dataLoaders,
+		SlurperFunc: func(items <-chan *slurp.Item) {},
+	}
+}
+
+func (a *testAnalyst) RangeForAnalysisRequest(pointInTime time.Time) (time.Time, time.Time) {
+	return pointInTime, pointInTime.Add(time.Hour)
+}
+
+func (a *testAnalyst) RangeForAnalysisRangeRequest(from time.Time, until time.Time) (time.Time, time.Time) {
+	return from, until
+}
+
+// testParamAnalyst is a testAnalyst that takes parameters.
+type testParamAnalyst struct {
+	testAnalyst
+}
+
+func (a *testParamAnalyst) ParamSchema() slurp.ParamSchema {
+	return slurp.ParamSchema{
+		{Name: "threshold", Type: slurp.ParamInt, Required: true},
+		{Name: "window", Type: slurp.ParamDuration, Default: "1h"},
+	}
+}
+
+// gateProducer tells us when a production run starts and then waits to be
+// released.
+type gateProducer struct {
+	started chan time.Time
+	release chan struct{}
+}
+
+func newGateProducer() *gateProducer {
+	return &gateProducer{
+		started: make(chan time.Time, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (p *gateProducer) Name() string {
+	return "Gate Producer"
+}
+
+func (p *gateProducer) Description() string {
+	return "Producer used for testing."
+}
+
+func (p *gateProducer) Produce(from time.Time, until time.Time) slurp.ProductionRun {
+	return slurp.ProductionRunFunc(func(ch chan<- *slurp.Item) {
+		p.started <- from
+		<-p.release
+	})
+}
+
+func (p *gateProducer) expectStart(t *testing.T, want time.Time) {
+	select {
+	case got := <-p.started:
+		if !got.Equal(want) {
+			t.Errorf("Expecting job for %s to start, got %s.", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expecting job for %s to start.", want)
+	}
+}
+
+func (p *gateProducer) expectNoStart(t *testing.T) {
+	select {
+	case got := <-p.started:
+		t.Errorf("Expecting no job to start, got %s.", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func newTestSlurpd(p *gateProducer) *Slurpd {
+	s := NewSlurpd()
+	l := slurp.NewDataLoaderStatWrapper(slurp.DataLoaderFunc(func(*slurp.Item) (string, interface{}) {
+		return "", nil
+	}))
+	s.RegisterDataLoader("l", l)
+	s.RegisterAnalyst("a", &testAnalyst{})
+	s.RegisterAnalyst("al", &testAnalyst{dataLoaders: []slurp.DataLoader{l}})
+	s.RegisterAnalyst("ap", &testParamAnalyst{})
+	s.RegisterProducer("p", p)
+	return s
+}
+
+func testJobRequest(analyst string, at time.Time, priority int) *JobRequestDTO {
+	return &JobRequestDTO{
+		Producer: "p",
+		Priority: priority,
+		PointInTimeAnalysis: []PointInTimeAnalysisDTO{
+			{Analyst: analyst, Time: at},
+		},
+	}
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+	for _, r := range []*JobRequestDTO{
+		testJobRequest("a", t1, 0),
+		testJobRequest("a", t2, 0),
+		testJobRequest("a", t3, 5),
+	} {
+		if _, err := s.SubmitJob(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.expectStart(t, t1)
+	p.expectNoStart(t)
+	if queued, running, _, _ := s.jobCount(); queued != 2 || running != 1 {
+		t.Errorf("Expecting 2 queued and 1 running job, got %d and %d.", queued, running)
+	}
+	p.release <- struct{}{}
+	p.expectStart(t, t3)
+	p.release <- struct{}{}
+	p.expectStart(t, t2)
+	p.release <- struct{}{}
+}
+
+func TestJobQueueDataLoaderConcurrency(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.DataLoaderConcurrency("l", 1)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+	for _, r := range []*JobRequestDTO{
+		testJobRequest("al", t1, 0),
+		testJobRequest("al", t2, 0),
+	} {
+		if _, err := s.SubmitJob(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.expectStart(t, t1)
+	p.expectNoStart(t)
+	// Jobs that do not use the loader are not held back.
+	if _, err := s.SubmitJob(testJobRequest("a", t3, 0)); err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t3)
+	p.release <- struct{}{}
+	p.release <- struct{}{}
+	p.expectStart(t, t2)
+	p.release <- struct{}{}
+}
+
+func TestJobQueueFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	if err := s.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	k1, err := s.SubmitJob(testJobRequest("a", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := s.SubmitJob(testJobRequest("a", t2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+
+	// A restart picks up both the running and the queued job.
+	p2 := newGateProducer()
+	s2 := newTestSlurpd(p2)
+	s2.MaxConcurrentJobs(1)
+	if err := s2.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	p2.expectStart(t, t1)
+	jobs := s2.jobStatus()
+	if jobs[k1].State != jobRunning {
+		t.Errorf("Expecting job %q to be %q, got %q.", k1, jobRunning, jobs[k1].State)
+	}
+	if jobs[k2].State != jobQueued || jobs[k2].Position != 1 {
+		t.Errorf("Expecting job %q to be first in the queue, got %+v.", k2, jobs[k2])
+	}
+
+	// Finished jobs are removed from the file.
+	p.release <- struct{}{}
+	p.expectStart(t, t2)
+	p.release <- struct{}{}
+	job, _ := s.job(k2)
+	<-job.done
+	s3 := newTestSlurpd(newGateProducer())
+	if err := s3.JobQueueFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s3.jobStatus()); n != 0 {
+		t.Errorf("Expecting no jobs to be restored, got %d.", n)
+	}
+	p2.release <- struct{}{}
+	p2.expectStart(t, t2)
+	p2.release <- struct{}{}
+	job, _ = s2.job(k2)
+	<-job.done
+}
+
+func readQueueFile(t *testing.T, path string) []queueFileJob {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var jobs []queueFileJob
+	if err := json.NewDecoder(f).Decode(&jobs); err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestWriteJobQueueKeepsLatest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	s := NewSlurpd()
+	s.writeJobQueue(path, []queueFileJob{{Job: "b"}}, 2)
+	s.writeJobQueue(path, []queueFileJob{{Job: "a"}}, 1)
+	if jobs := readQueueFile(t, path); len(jobs) != 1 || jobs[0].Job != "b" {
+		t.Errorf("Expecting an earlier version of the queue not to overwrite a later one, got %+v.", jobs)
+	}
+}
+
+func TestSubmitJobParams(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	req := testJobRequest("ap", t1, 0)
+	if _, err := s.SubmitJob(req); err == nil {
+		t.Errorf("Expecting a missing required parameter to be rejected.")
+	}
+	req = testJobRequest("a", t1, 0)
+	req.PointInTimeAnalysis[0].Params = slurp.Params{"threshold": 1.0}
+	if _, err := s.SubmitJob(req); err == nil {
+		t.Errorf("Expecting parameters to be rejected by an analyst that takes none.")
+	}
+
+	req = testJobRequest("ap", t1, 0)
+	req.PointInTimeAnalysis[0].Params = slurp.Params{"threshold": 3.0}
+	k, err := s.SubmitJob(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+	job, _ := s.job(k)
+	got := job.slurper.Requests[0].Params
+	if got.Int("threshold") != 3 || got.Duration("window") != time.Hour {
+		t.Errorf("Unexpected analysis request params %v.", got)
+	}
+	p.release <- struct{}{}
+	<-job.done
+}
+
+func TestCancelJob(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	s.MaxConcurrentJobs(1)
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	k1, err := s.SubmitJob(testJobRequest("a", t1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := s.SubmitJob(testJobRequest("a", t2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.expectStart(t, t1)
+
+	// A queued job is cancelled straight away.
+	if err := s.CancelJob(k2); err != nil {
+		t.Fatal(err)
+	}
+	job2, _ := s.job(k2)
+	<-job2.done
+	if jobs := s.jobStatus(); jobs[k2].State != jobCancelled || jobs[k2].Started != nil {
+		t.Errorf("Expecting job %q to be cancelled without starting, got %+v.", k2, jobs[k2])
+	}
+
+	// A running job finishes without waiting for its producer.
+	router := ConfigureRouter(s, mux.NewRouter())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/jobs/"+k1+"/cancel", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expecting status %d, got %d %s.", http.StatusOK, w.Code, w.Body)
+	}
+	job1, _ := s.job(k1)
+	select {
+	case <-job1.done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expecting job %q to finish once cancelled.", k1)
+	}
+	if jobs := s.jobStatus(); jobs[k1].State != jobCancelled {
+		t.Errorf("Expecting job %q to be cancelled, got %+v.", k1, jobs[k1])
+	}
+	p.expectNoStart(t)
+	if _, _, completed, cancelled := s.jobCount(); completed != 0 || cancelled != 2 {
+		t.Errorf("Expecting 0 completed and 2 cancelled jobs, got %d and %d.", completed, cancelled)
+	}
+
+	for path, want := range map[string]int{
+		"/jobs/" + k1 + "/cancel": http.StatusConflict,
+		"/jobs/x/cancel":          http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: Expecting status %d, got %d.", path, want, w.Code)
+		}
+	}
+	p.release <- struct{}{}
+}
@@ -0,0 +1,96 @@
+package slurpd
+
+import (
+	"sync"
+
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// registryItem is a component in a registry along with the config it was
+// created from, if any, and the data loaders used by an analyst.
+type registryItem struct {
+	value   interface{}
+	config  ComponentConfig
+	loaders []slurp.DataLoader
+}
+
+// registry is a concurrency safe map of components. Jobs keep the
+// components that they were created with, so components can be replaced or
+// removed while jobs are running. When both the analyst and the data loader
+// registries are locked the analyst one is locked first.
+type registry struct {
+	mutex sync.RWMutex
+	items map[string]registryItem
+}
+
+func newRegistry() *registry {
+	return &registry{
+		items: make(map[string]registryItem),
+	}
+}
+
+// get returns the component at k.
+func (r *registry) get(k string) (interface{}, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	v, ok := r.items[k]
+	return v.value, ok
+}
+
+// item returns the component at k along with its config.
+func (r *registry) item(k string) (registryItem, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	v, ok := r.items[k]
+	return v, ok
+}
+
+// set puts the component at k, replacing any that is already there.
+func (r *registry) set(k string, v interface{}, c ComponentConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.items[k] = registryItem{value: v, config: c}
+}
+
+// add puts the component at k unless there is one already there.
+func (r *registry) add(k string, v interface{}, c ComponentConfig) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.items[k]; ok {
+		return false
+	}
+	r.items[k] = registryItem{value: v, config: c}
+	return true
+}
+
+// remove removes the component at k.
+func (r *registry) remove(k string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.items[k]
+	delete(r.items, k)
+	return ok
+}
+
+// key returns the key of the component v, or an empty string.
+func (r *registry) key(v interface{}) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for k, item := range r.items {
+		if item.value == v {
+			return k
+		}
+	}
+	return ""
+}
+
+// snapshot returns a copy of the registry contents.
+func (r *registry) snapshot() map[string]registryItem {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	m := make(map[string]registryItem, len(r.items))
+	for k, v := range r.items {
+		m[k] = v
+	}
+	return m
+}
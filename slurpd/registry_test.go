@@ -0,0 +1,155 @@
+package slurpd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// emptyProducer has a field so that each instance has its own address.
+type emptyProducer struct {
+	_ int
+}
+
+func (p *emptyProducer) Name() string {
+	return "Empty Producer"
+}
+
+func (p *emptyProducer) Description() string {
+	return "Producer that produces nothing."
+}
+
+func (p *emptyProducer) Produce(from time.Time, until time.Time) slurp.ProductionRun {
+	return slurp.ProductionRunFunc(func(ch chan<- *slurp.Item) {})
+}
+
+func init() {
+	RegisterProducerFactory("empty", &ProducerFactory{
+		New: func(p slurp.Params) (slurp.Producer, error) {
+			return &emptyProducer{}, nil
+		},
+	})
+}
+
+func TestRegistryReplace(t *testing.T) {
+	s := NewSlurpd()
+	if err := s.CreateProducer("p", ComponentConfig{Factory: "empty"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateProducer("p", ComponentConfig{Factory: "empty"}, false); err == nil {
+		t.Errorf("Expecting an error when the producer is already registered.")
+	}
+	old, _ := s.Producer("p")
+	if err := s.CreateProducer("p", ComponentConfig{Factory: "empty", Concurrency: 2}, true); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.Producer("p"); p == old {
+		t.Errorf("Expecting the producer to be replaced.")
+	}
+	if s.producerLimit["p"] != 2 {
+		t.Errorf("Expecting a producer concurrency of 2, got %d.", s.producerLimit["p"])
+	}
+
+	if err := s.CreateDataLoader("l", ComponentConfig{Factory: "test"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateAnalyst("a", ComponentConfig{Factory: "test", Params: slurp.Params{"threshold": 1}, DataLoaders: []string{"l"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.UnregisterDataLoader("l"); ok || err == nil {
+		t.Errorf("Expecting a data loader used by an analyst to not be removed.")
+	}
+	if !s.UnregisterAnalyst("a") {
+		t.Errorf("Expecting analyst to be removed.")
+	}
+	if ok, err := s.UnregisterDataLoader("l"); !ok || err != nil {
+		t.Errorf("Expecting data loader to be removed, got %v.", err)
+	}
+	if !s.UnregisterProducer("p") || s.UnregisterProducer("p") {
+		t.Errorf("Expecting producer to be removed once.")
+	}
+}
+
+func TestUnregisterDataLoaderInUse(t *testing.T) {
+	s := newTestSlurpd(newGateProducer())
+	if ok, err := s.UnregisterDataLoader("l"); ok || err == nil {
+		t.Errorf("Expecting a data loader used by a registered analyst to not be removed.")
+	}
+	if _, ok := s.DataLoader("l"); !ok {
+		t.Errorf("Expecting the data loader to still be registered.")
+	}
+	if !s.UnregisterAnalyst("al") {
+		t.Errorf("Expecting analyst to be removed.")
+	}
+	if ok, err := s.UnregisterDataLoader("l"); !ok || err != nil {
+		t.Errorf("Expecting data loader to be removed, got %v.", err)
+	}
+}
+
+// TestConcurrentAPI is mostly of use with go test -race.
+func TestConcurrentAPI(t *testing.T) {
+	s := NewSlurpd()
+	s.RegisterAnalyst("a", &testAnalyst{})
+	s.RegisterProducer("p", &emptyProducer{})
+	router := ConfigureRouter(s, mux.NewRouter())
+	call := func(method string, path string, body string) int {
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				f(i)
+			}
+		}()
+	}
+	run(func(i int) {
+		call("PUT", "/producers/p2", `{"factory": "empty"}`)
+		call("DELETE", "/producers/p2", "")
+	})
+	run(func(i int) {
+		call("PUT", "/data-loaders/l", `{"factory": "test", "concurrency": 1}`)
+		call("PUT", "/analysts/a2", `{"factory": "test", "params": {"threshold": 1}, "dataLoaders": ["l"]}`)
+		call("DELETE", "/analysts/a2", "")
+		call("DELETE", "/data-loaders/l", "")
+	})
+	run(func(i int) {
+		s.RegisterAnalyst("a", &testAnalyst{})
+		s.RegisterProducer("p", &emptyProducer{})
+	})
+	run(func(i int) {
+		if code := call("POST", "/analysis-request", `{"producer": "p", "pointInTimeAnalysis": [{"analyst": "a", "time": "2015-06-01T00:00:00Z"}]}`); code != http.StatusOK {
+			t.Errorf("Expecting analysis request to be accepted, got %d.", code)
+		}
+		call("POST", "/analysis-request", `{"producer": "p2", "pointInTimeAnalysis": [{"analyst": "a2", "time": "2015-06-01T00:00:00Z"}]}`)
+	})
+	run(func(i int) {
+		for _, path := range []string{"/analysts", "/data-loaders", "/producers", "/slurpers", "/jobs"} {
+			if code := call("GET", path, ""); code != http.StatusOK {
+				t.Errorf("Expecting %s to respond with 200, got %d.", path, code)
+			}
+		}
+		s.metrics()
+	})
+	wg.Wait()
+
+	for i := 0; i < 1000; i++ {
+		if queued, running, _, _ := s.jobCount(); queued+running == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("Expecting all jobs to finish.")
+}
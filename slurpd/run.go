@@ -0,0 +1,96 @@
+package slurpd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/williambailey/go-slurp/slurp"
+)
+
+// RunJob validates a job request and runs it straight away, outside of the
+// job queue and without it being listed as a job. Results are written to rs
+// rather than the result store. When progress is not nil it is called every
+// interval while the job runs and once more when it has finished.
+//
+// Cancelling ctx stops the job taking items from its producer. The job key
+// is returned along with ctx.Err() when the job was cancelled, or the first
+// error from rs.
+func (s *Slurpd) RunJob(ctx context.Context, req *JobRequestDTO, rs slurp.ResultSink, interval time.Duration, progress func(SlurperDTO)) (string, error) {
+	p, ar, err := s.analysisRequests(req)
+	if err != nil {
+		return "", err
+	}
+	k := uuid.New()
+	job := s.newJob(k, p, ar...)
+	defer job.cancel()
+
+	var (
+		errMutex sync.Mutex
+		sinkErr  error
+	)
+	for i, r := range ar {
+		ak := job.analysts[i]
+		r.Results = slurp.ResultSinkFunc(func(result *slurp.AnalysisResult) error {
+			result.Job = k
+			result.Analyst = ak
+			err := rs.WriteResult(result)
+			if err != nil {
+				errMutex.Lock()
+				if sinkErr == nil {
+					sinkErr = err
+				}
+				errMutex.Unlock()
+			}
+			return err
+		})
+	}
+
+	span := s.tracer.StartSpan("slurpd.RunJob", nil)
+	defer span.End()
+	span.SetAttribute("job", k)
+	span.SetAttribute("producer", job.producer)
+	job.state = jobRunning
+	job.started = s.clock.Now()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var tick <-chan time.Time
+		if progress != nil && interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				job.cancel()
+				return
+			case <-tick:
+				progress(s.slurperDTO(job, s.clock.Now()))
+			case <-done:
+				return
+			}
+		}
+	}()
+	s.slurpJob(job, span)
+	close(done)
+	wg.Wait()
+
+	if f, ok := rs.(slurp.ResultFlusher); ok {
+		if err := f.Flush(); err != nil && sinkErr == nil {
+			sinkErr = err
+		}
+	}
+	if progress != nil {
+		progress(s.slurperDTO(job, s.clock.Now()))
+	}
+	if err := ctx.Err(); err != nil {
+		return k, err
+	}
+	return k, sinkErr
+}
@@ -0,0 +1,108 @@
+package slurpd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp"
+	"github.com/williambailey/go-slurp/slurp/slurptest"
+)
+
+// countAnalyst is a testAnalyst that emits the number of items it was sent.
+type countAnalyst struct {
+	testAnalyst
+}
+
+func (a *countAnalyst) AnalysisRangeRequest(from time.Time, until time.Time) *slurp.AnalysisRequest {
+	r := a.testAnalyst.AnalysisRangeRequest(from, until)
+	r.Analyst = a
+	r.SlurperFunc = func(items <-chan *slurp.Item) {
+		n := 0
+		for range items {
+			n++
+		}
+		r.Emit(until, map[string]interface{}{"items": n})
+	}
+	return r
+}
+
+func TestRunJob(t *testing.T) {
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	items := make([]slurptest.RecordedItem, 10)
+	for i := range items {
+		items[i] = slurptest.RecordedItem{At: t1.Add(time.Duration(i) * time.Minute)}
+	}
+	s := NewSlurpd()
+	s.RegisterAnalyst("c", &countAnalyst{})
+	s.RegisterProducer("f", slurptest.NewFixtureProducer(items...))
+	req := &JobRequestDTO{
+		Producer: "f",
+		RangeAnalysis: []RangeAnalysisDTO{
+			{Analyst: "c", From: t1, Until: t1.Add(5 * time.Minute)},
+		},
+	}
+
+	rs := slurp.NewMemoryResultStore()
+	var last SlurperDTO
+	k, err := s.RunJob(context.Background(), req, rs, time.Hour, func(v SlurperDTO) {
+		last = v
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := rs.Results(k, 0, 10)
+	if len(results) != 1 || results[0].Analyst != "c" || results[0].Data["items"] != 5 {
+		t.Errorf("Expecting a result for 5 items from analyst c, got %v.", results)
+	}
+	if last.Stat.Count != 5 || last.AnalysisRequest[0].Analyst != "c" {
+		t.Errorf("Expecting the final progress to cover 5 items, got %+v.", last)
+	}
+	if len(s.jobStatus()) != 0 {
+		t.Errorf("Expecting the job not to be listed.")
+	}
+
+	// Problems with the request and with writing results are returned.
+	if err := s.ValidateJobRequest(req); err != nil {
+		t.Errorf("Expecting the request to be valid, got %v.", err)
+	}
+	if _, ok := s.ValidateJobRequest(&JobRequestDTO{Producer: "x"}).(ValidationError); !ok {
+		t.Errorf("Expecting an invalid request to be listed in a ValidationError.")
+	}
+	if k, err := s.RunJob(context.Background(), &JobRequestDTO{Producer: "x"}, rs, 0, nil); k != "" || err == nil {
+		t.Errorf("Expecting an invalid request to be rejected, got %q %v.", k, err)
+	}
+	failing := slurp.ResultSinkFunc(func(*slurp.AnalysisResult) error {
+		return errors.New("disk on fire")
+	})
+	if _, err := s.RunJob(context.Background(), req, failing, 0, nil); err == nil || err.Error() != "disk on fire" {
+		t.Errorf("Expecting the result error, got %v.", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.RunJob(ctx, req, rs, 0, nil); err != context.Canceled {
+		t.Errorf("Expecting the job to be cancelled, got %v.", err)
+	}
+}
+
+func TestSlurpAnalysisRequestResults(t *testing.T) {
+	t1 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSlurpd()
+	r := (&countAnalyst{}).AnalysisRangeRequest(t1, t1.Add(time.Hour))
+	var got []*slurp.AnalysisResult
+	r.Results = slurp.ResultSinkFunc(func(result *slurp.AnalysisResult) error {
+		got = append(got, result)
+		return nil
+	})
+	k, err := s.SlurpAnalysisRequest(slurptest.NewFixtureProducer(slurptest.RecordedItem{At: t1}), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Job != k || got[0].Data["items"] != 1 {
+		t.Errorf("Expecting the result to be written to the request's own sink, got %v.", got)
+	}
+	if results, _ := s.resultStore.Results(k, 0, 10); len(results) != 1 {
+		t.Errorf("Expecting the result to be written to the result store, got %v.", results)
+	}
+}
@@ -0,0 +1,209 @@
+package slurpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// schedule is a registered recurring analysis.
+type schedule struct {
+	spec      ScheduleDTO
+	cron      *cronSchedule
+	location  *time.Location
+	paused    bool
+	lastRun   *time.Time
+	lastJob   string
+	lastError string
+	nextRun   time.Time
+}
+
+// dto returns the schedule as a ScheduleDTO.
+func (sc *schedule) dto() ScheduleDTO {
+	r := sc.spec
+	r.Paused = sc.paused
+	r.LastRun = sc.lastRun
+	r.LastJob = sc.lastJob
+	r.LastError = sc.lastError
+	if !sc.paused && !sc.nextRun.IsZero() {
+		next := sc.nextRun
+		r.NextRun = &next
+	}
+	return r
+}
+
+// AddSchedule registers a recurring analysis at k, replacing any schedule
+// already there. Every problem found with spec is listed in a
+// ValidationError.
+func (s *Slurpd) AddSchedule(k string, spec ScheduleDTO) error {
+	var errs ValidationError
+	c, err := parseCron(spec.Cron)
+	if err != nil {
+		errs.add("cron", ErrorCodeInvalid, "%s", err)
+	}
+	loc, err := scheduleLocation(spec.Location)
+	if err != nil {
+		errs.add("location", ErrorCodeInvalid, "%s", err)
+	}
+	now := s.clock.Now().In(loc)
+	if _, err = ParseTimeExpression(spec.Time, now); err != nil {
+		errs.add("time", ErrorCodeInvalid, "%s", err)
+	}
+	if _, ok := s.Producer(spec.Producer); !ok {
+		errs.add("producer", ErrorCodeUnknown, "unknown producer %q", spec.Producer)
+	}
+	if a, ok := s.Analyst(spec.Analyst); !ok {
+		errs.add("analyst", ErrorCodeUnknown, "unknown analyst %q", spec.Analyst)
+	} else if _, err = analysisRequestParams(a, spec.Params); err != nil {
+		errs.addParams("params", err)
+	}
+	if err = errs.err(); err != nil {
+		return err
+	}
+	sc := &schedule{
+		spec:     ScheduleDTO{Cron: spec.Cron, Location: spec.Location, Producer: spec.Producer, Analyst: spec.Analyst, Time: spec.Time, Params: spec.Params, Priority: spec.Priority},
+		cron:     c,
+		location: loc,
+		paused:   spec.Paused,
+		nextRun:  c.Next(now),
+	}
+	s.scheduleMutex.Lock()
+	s.scheduleMap[k] = sc
+	s.scheduleMutex.Unlock()
+	return nil
+}
+
+// scheduleLocation returns the time zone named by the location of a
+// schedule, UTC when it is empty.
+func scheduleLocation(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, fmt.Errorf("unknown location %q", name)
+	}
+	return loc, nil
+}
+
+// RemoveSchedule removes the schedule at k.
+func (s *Slurpd) RemoveSchedule(k string) bool {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+	_, ok := s.scheduleMap[k]
+	delete(s.scheduleMap, k)
+	return ok
+}
+
+// PauseSchedule stops or restarts the schedule at k. When restarted the
+// schedule next runs at the first time after now, missed runs are skipped.
+func (s *Slurpd) PauseSchedule(k string, paused bool) bool {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+	sc, ok := s.scheduleMap[k]
+	if !ok {
+		return false
+	}
+	if sc.paused && !paused {
+		sc.nextRun = sc.cron.Next(s.clock.Now().In(sc.location))
+	}
+	sc.paused = paused
+	return true
+}
+
+// Schedule will try to get the schedule at k.
+func (s *Slurpd) Schedule(k string) (ScheduleDTO, bool) {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+	sc, ok := s.scheduleMap[k]
+	if !ok {
+		return ScheduleDTO{}, false
+	}
+	return sc.dto(), true
+}
+
+// Schedules returns every registered schedule.
+func (s *Slurpd) Schedules() ScheduleMapDTO {
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+	r := make(ScheduleMapDTO, len(s.scheduleMap))
+	for k, sc := range s.scheduleMap {
+		r[k] = sc.dto()
+	}
+	return r
+}
+
+// LoadSchedules registers the schedules in a JSON file holding a
+// ScheduleMapDTO.
+func (s *Slurpd) LoadSchedules(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var m ScheduleMapDTO
+	if err = json.NewDecoder(f).Decode(&m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		if err = s.AddSchedule(k, v); err != nil {
+			return fmt.Errorf("schedule %q: %s", k, err)
+		}
+	}
+	return nil
+}
+
+// StartScheduler checks for due schedules every interval until the returned
+// function is called.
+func (s *Slurpd) StartScheduler(interval time.Duration) func() {
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				s.runSchedules()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+	}
+}
+
+// runSchedules submits a job for every schedule that is due. The time
+// expression of a schedule is worked out relative to the time that the run
+// was due, so a late run still analyses the right time. Only one run is made
+// for a schedule no matter how many runs have been missed.
+func (s *Slurpd) runSchedules() {
+	now := s.clock.Now()
+	s.scheduleMutex.Lock()
+	defer s.scheduleMutex.Unlock()
+	for k, sc := range s.scheduleMap {
+		if sc.paused || sc.nextRun.IsZero() || sc.nextRun.After(now) {
+			continue
+		}
+		due := sc.nextRun
+		sc.lastRun = &due
+		sc.lastJob = ""
+		sc.lastError = ""
+		sc.nextRun = sc.cron.Next(now.In(sc.location))
+		at, err := ParseTimeExpression(sc.spec.Time, due)
+		if err == nil {
+			id := &Identity{Name: k, Method: AuthSchedule, Role: RoleSubmitter}
+			sc.lastJob, err = s.SubmitJobAs(id, &JobRequestDTO{
+				Producer: sc.spec.Producer,
+				Priority: sc.spec.Priority,
+				PointInTimeAnalysis: []PointInTimeAnalysisDTO{
+					{Analyst: sc.spec.Analyst, Time: at, Params: sc.spec.Params},
+				},
+			})
+		}
+		if err != nil {
+			sc.lastError = err.Error()
+			log.Printf("Unable to run schedule %q: %s.\n", k, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package slurpd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/williambailey/go-slurp/slurp/slurptest"
+)
+
+func TestParseTimeExpression(t *testing.T) {
+	now := time.Date(2015, 6, 2, 1, 30, 0, 0, time.UTC)
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"now", now},
+		{"now -1h", now.Add(-time.Hour)},
+		{"today", time.Date(2015, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"yesterday 00:00 UTC", time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"tomorrow 06:15", time.Date(2015, 6, 3, 6, 15, 0, 0, time.UTC)},
+		{"yesterday 00:00 UTC +6h", time.Date(2015, 6, 1, 6, 0, 0, 0, time.UTC)},
+		{"today 00:00 Europe/London", time.Date(2015, 6, 2, 0, 0, 0, 0, london)},
+	}
+	for _, test := range tests {
+		got, err := ParseTimeExpression(test.expr, now)
+		if err != nil {
+			t.Errorf("Expecting %q to parse, got %s.", test.expr, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("Expecting %q to be %s, got %s.", test.expr, test.want, got)
+		}
+	}
+	for _, expr := range []string{"", "later", "now 00:00", "today 25:00", "today Nowhere/Town", "today -1x"} {
+		if _, err := ParseTimeExpression(expr, now); err == nil {
+			t.Errorf("Expecting %q to be invalid.", expr)
+		}
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	p := newGateProducer()
+	s := newTestSlurpd(p)
+	clock := slurptest.NewClock(time.Date(2015, 6, 1, 1, 0, 0, 0, time.UTC))
+	s.SlurpClock(clock)
+	err := s.AddSchedule("nightly", ScheduleDTO{
+		Cron:     "0 2 * * *",
+		Producer: "p",
+		Analyst:  "a",
+		Time:     "yesterday 00:00 UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddSchedule("bad", ScheduleDTO{Cron: "0 2 * * *", Producer: "p", Analyst: "x", Time: "now"}); err == nil {
+		t.Errorf("Expecting an unknown analyst to be rejected.")
+	}
+
+	s.runSchedules()
+	p.expectNoStart(t)
+
+	// Run late, the time is still worked out from when the run was due.
+	clock.Set(time.Date(2015, 6, 1, 2, 5, 0, 0, time.UTC))
+	s.runSchedules()
+	p.expectStart(t, time.Date(2015, 5, 31, 0, 0, 0, 0, time.UTC))
+	p.release <- struct{}{}
+	sc, _ := s.Schedule("nightly")
+	if sc.LastRun == nil || !sc.LastRun.Equal(time.Date(2015, 6, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected last run %v.", sc.LastRun)
+	}
+	if sc.LastJob == "" {
+		t.Errorf("Expecting a last job.")
+	}
+	if sc.NextRun == nil || !sc.NextRun.Equal(time.Date(2015, 6, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected next run %v.", sc.NextRun)
+	}
+
+	// Paused schedules skip missed runs when resumed.
+	s.PauseSchedule("nightly", true)
+	clock.Set(time.Date(2015, 6, 3, 3, 0, 0, 0, time.UTC))
+	s.runSchedules()
+	p.expectNoStart(t)
+	s.PauseSchedule("nightly", false)
+	s.runSchedules()
+	p.expectNoStart(t)
+	sc, _ = s.Schedule("nightly")
+	if sc.NextRun == nil || !sc.NextRun.Equal(time.Date(2015, 6, 4, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected next run %v.", sc.NextRun)
+	}
+}
+
+func TestScheduleLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	s := newTestSlurpd(newGateProducer())
+	s.SlurpClock(slurptest.NewClock(time.Date(2015, 6, 1, 5, 0, 0, 0, time.UTC)))
+	err = s.AddSchedule("nightly", ScheduleDTO{
+		Cron:     "0 2 * * *",
+		Location: "America/New_York",
+		Producer: "p",
+		Analyst:  "a",
+		Time:     "yesterday 00:00 UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, _ := s.Schedule("nightly")
+	if want := time.Date(2015, 6, 1, 2, 0, 0, 0, ny); sc.NextRun == nil || !sc.NextRun.Equal(want) || sc.Location != "America/New_York" {
+		t.Errorf("Expecting the next run at %s, got %v.", want, sc.NextRun)
+	}
+	if err = s.AddSchedule("bad", ScheduleDTO{Cron: "0 2 * * *", Location: "Nowhere/Town", Producer: "p", Analyst: "a", Time: "now"}); err == nil {
+		t.Errorf("Expecting an unknown location to be rejected.")
+	}
+}
@@ -1,121 +1,297 @@
 package slurpd
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/williambailey/go-slurp/slurp"
 )
 
+// Job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobCancelled = "cancelled"
+)
+
 type slurperMapItem struct {
-	started time.Time
-	slurper *slurp.AnalysisRequestSlurper
+	state     string
+	priority  int
+	seq       int64
+	queued    time.Time
+	started   time.Time
+	finished  *time.Time
+	producer  string
+	analysts  []string
+	loaders   []string
+	request   *JobRequestDTO
+	identity  *Identity
+	source    slurp.Producer
+	slurper   *slurp.AnalysisRequestSlurper
+	ctx       context.Context
+	cancel    context.CancelFunc
+	cancelled bool
+	// interrupted is set for a job that was cancelled by Drain and is kept
+	// in the job queue file.
+	interrupted bool
+	checkpoints []slurp.Checkpoint
+	done        chan struct{}
 }
 
 // Slurpd is our slurp daemon/http handler.
 type Slurpd struct {
-	analystMap    map[string]slurp.Analyst
-	dataLoaderMap map[string]slurp.DataLoader
-	producerMap   map[string]slurp.Producer
-	slurperMap    map[string]slurperMapItem
-	slurpBuffer   int
+	analysts        *registry
+	dataLoaders     *registry
+	producers       *registry
+	slurperMap      map[string]*slurperMapItem
+	jobHistory      int
+	maxJobs         int
+	producerLimit   map[string]int
+	dataLoaderLimit map[string]int
+	queueFile       string
+	queueMutex      sync.Mutex
+	queueSeq        int64
+	queueSaved      int64
+	queueJobs       []queueFileJob
+	checkpointEvery time.Duration
+	resultStore     slurp.ResultStore
+	slurpBuffer     int
+	rateWindow      int
+	clock           slurp.Clock
+	tracer          slurp.Tracer
+	traceLoadData   int
+	jobMutex        sync.Mutex
+	jobSeq          int64
+	jobCompleted    int64
+	jobCancelled    int64
+	producerItems   map[string]int64
+	scheduleMutex   sync.Mutex
+	scheduleMap     map[string]*schedule
+	events          *eventHub
+	authMutex       sync.RWMutex
+	authenticators  []Authenticator
+	anonymousRole   Role
+	auditLog        *AuditLog
+	auditMutex      sync.Mutex
+	auditPending    []*AuditEntryDTO
+	draining        bool
+	drained         chan struct{}
+	drainOnce       sync.Once
 }
 
 // NewSlurpd returns a pointer to a new Slurpd instance.
 func NewSlurpd() *Slurpd {
 	return &Slurpd{
-		analystMap:    make(map[string]slurp.Analyst),
-		dataLoaderMap: make(map[string]slurp.DataLoader),
-		producerMap:   make(map[string]slurp.Producer),
-		slurperMap:    make(map[string]slurperMapItem),
-		slurpBuffer:   0,
+		analysts:        newRegistry(),
+		dataLoaders:     newRegistry(),
+		producers:       newRegistry(),
+		slurperMap:      make(map[string]*slurperMapItem),
+		jobHistory:      100,
+		producerLimit:   make(map[string]int),
+		dataLoaderLimit: make(map[string]int),
+		resultStore:     slurp.NewMemoryResultStore(),
+		slurpBuffer:     0,
+		clock:           slurp.SystemClock,
+		tracer:          slurp.NopTracer,
+		producerItems:   make(map[string]int64),
+		scheduleMap:     make(map[string]*schedule),
+		events:          newEventHub(),
+		drained:         make(chan struct{}),
 	}
 }
 
 func (s *Slurpd) analystKey(a slurp.Analyst) string {
-	for k, v := range s.analystMap {
-		if a == v {
-			return k
-		}
-	}
-	return ""
+	return s.analysts.key(a)
 }
 
 func (s *Slurpd) dataLoaderKey(d slurp.DataLoader) string {
-	for k, v := range s.dataLoaderMap {
-		if d == v {
-			return k
-		}
-	}
-	return ""
+	return s.dataLoaders.key(d)
 }
 
 func (s *Slurpd) producerKey(p slurp.Producer) string {
-	for k, v := range s.producerMap {
-		if p == v {
-			return k
+	return s.producers.key(p)
+}
+
+// checkAnalyst panics if a can not be registered.
+func checkAnalyst(k string, a slurp.Analyst) {
+	if _, ok := a.(slurp.Describer); !ok {
+		log.Panicf("Expecting analyst %q to be a slurp.Describer.\n", k)
+	}
+	if pa, ok := a.(slurp.ParamAnalyst); ok {
+		if err := pa.ParamSchema().Check(); err != nil {
+			log.Panicf("Invalid parameters for analyst %q: %s.\n", k, err)
 		}
 	}
-	return ""
 }
 
-func (s *Slurpd) slurperKey(rs *slurp.AnalysisRequestSlurper) string {
-	for k, v := range s.slurperMap {
-		if rs == v.slurper {
-			return k
-		}
+// checkDataLoader panics if l can not be registered.
+func checkDataLoader(k string, l slurp.DataLoader) {
+	if _, ok := l.(slurp.Describer); !ok {
+		log.Panicf("Expecting data loader %q to be a slurp.Describer.\n", k)
+	}
+	if _, ok := l.(*slurp.DataLoaderStatWrapper); !ok {
+		log.Panicf("Expecting data loader %q to be a slurp.DataLoaderStatWrapper.\n", k)
+	}
+}
+
+// checkProducer panics if p can not be registered.
+func checkProducer(k string, p slurp.Producer) {
+	if _, ok := p.(slurp.Describer); !ok {
+		log.Panicf("Expecting producer %q to be a slurp.Describer.\n", k)
 	}
-	return ""
 }
 
-// RegisterAnalyst registers an analyst to a key.
+// RegisterAnalyst registers an analyst to a key, replacing any analyst
+// already registered to it. Jobs keep the analyst that they were created
+// with.
 // Will panic if the analyst is not a slurp.Describer
+// Will panic if the analyst is a slurp.ParamAnalyst with an invalid schema
 func (s *Slurpd) RegisterAnalyst(k string, a slurp.Analyst) {
-	if _, ok := a.(slurp.Describer); !ok {
-		log.Panicf("Expecting analyst %q to be a slurp.Describer.\n", k)
+	checkAnalyst(k, a)
+	s.putAnalyst(k, a, ComponentConfig{}, true)
+}
+
+// putAnalyst puts the analyst a at k, keeping any analyst already there
+// unless replace is set. The data loaders that a uses, when it is a
+// slurp.DataLoaderAnalyst, are recorded so that they can not be removed from
+// under it. An analyst made from config is only
+// added if the data loaders that it names are still registered.
+func (s *Slurpd) putAnalyst(k string, a slurp.Analyst, c ComponentConfig, replace bool) (bool, error) {
+	loaders := analystDataLoaders(a)
+	s.analysts.mutex.Lock()
+	defer s.analysts.mutex.Unlock()
+	s.dataLoaders.mutex.RLock()
+	defer s.dataLoaders.mutex.RUnlock()
+	for _, lk := range c.DataLoaders {
+		if _, ok := s.dataLoaders.items[lk]; !ok {
+			return false, fmt.Errorf("data loader %q is not registered", lk)
+		}
 	}
-	s.analystMap[k] = a
+	if _, ok := s.analysts.items[k]; ok && !replace {
+		return false, nil
+	}
+	s.analysts.items[k] = registryItem{value: a, config: c, loaders: loaders}
+	return true, nil
+}
+
+// analystDataLoaders returns the data loaders used by the analysis requests
+// of a, if it tells us what they are.
+func analystDataLoaders(a slurp.Analyst) []slurp.DataLoader {
+	if da, ok := a.(slurp.DataLoaderAnalyst); ok {
+		return da.DataLoaders()
+	}
+	return nil
+}
+
+// UnregisterAnalyst removes the analyst registered to k.
+func (s *Slurpd) UnregisterAnalyst(k string) bool {
+	return s.analysts.remove(k)
 }
 
 // Analyst will try to get the instance at k
 func (s *Slurpd) Analyst(k string) (slurp.Analyst, bool) {
-	v, ok := s.analystMap[k]
-	return v, ok
+	v, ok := s.analysts.get(k)
+	if !ok {
+		return nil, false
+	}
+	return v.(slurp.Analyst), true
 }
 
-// RegisterDataLoader registers a loader to a key.
+// RegisterDataLoader registers a loader to a key, replacing any loader
+// already registered to it. Analysts keep the loaders that they were
+// created with.
 // Will panic if the loader is not a slurp.Describer
 // Will panic if the loader is not a slurp.DataLoaderStatWrapper
 func (s *Slurpd) RegisterDataLoader(k string, l slurp.DataLoader) {
-	if _, ok := l.(slurp.Describer); !ok {
-		log.Panicf("Expecting data loader %q to be a slurp.Describer.\n", k)
+	checkDataLoader(k, l)
+	s.dataLoaders.set(k, l, ComponentConfig{})
+}
+
+// UnregisterDataLoader removes the loader registered to k. A loader that is
+// used by a registered analyst, one made from config or a
+// slurp.DataLoaderAnalyst, can not be removed.
+func (s *Slurpd) UnregisterDataLoader(k string) (bool, error) {
+	s.analysts.mutex.RLock()
+	s.dataLoaders.mutex.Lock()
+	item, ok := s.dataLoaders.items[k]
+	var err error
+	if ok {
+		for ak, v := range s.analysts.items {
+			if usesDataLoader(v, k, item.value) {
+				err = fmt.Errorf("data loader %q is used by analyst %q", k, ak)
+				break
+			}
+		}
+		if err == nil {
+			delete(s.dataLoaders.items, k)
+		}
 	}
-	if _, ok := l.(*slurp.DataLoaderStatWrapper); !ok {
-		log.Panicf("Expecting data loader %q to be a slurp.DataLoaderStatWrapper.\n", k)
+	s.dataLoaders.mutex.Unlock()
+	s.analysts.mutex.RUnlock()
+	if !ok || err != nil {
+		return false, err
 	}
-	s.dataLoaderMap[k] = l
+	s.DataLoaderConcurrency(k, 0)
+	return true, nil
+}
+
+// usesDataLoader tells us if the analyst in item uses the data loader l that
+// is registered to k.
+func usesDataLoader(item registryItem, k string, l interface{}) bool {
+	for _, lk := range item.config.DataLoaders {
+		if lk == k {
+			return true
+		}
+	}
+	for _, v := range item.loaders {
+		if v == l {
+			return true
+		}
+	}
+	return false
 }
 
 // DataLoader will try to get the instance at k
 func (s *Slurpd) DataLoader(k string) (slurp.DataLoader, bool) {
-	v, ok := s.dataLoaderMap[k]
-	return v, ok
+	v, ok := s.dataLoaders.get(k)
+	if !ok {
+		return nil, false
+	}
+	return v.(slurp.DataLoader), true
 }
 
-// RegisterProducer registers a producer to a key.
+// RegisterProducer registers a producer to a key, replacing any producer
+// already registered to it. Jobs keep the producer that they were created
+// with.
 // Will panic if the producer is not a slurp.Describer
 func (s *Slurpd) RegisterProducer(k string, p slurp.Producer) {
-	if _, ok := p.(slurp.Describer); !ok {
-		log.Panicf("Expecting producer %q to be a slurp.Describer.\n", k)
+	checkProducer(k, p)
+	s.producers.set(k, p, ComponentConfig{})
+}
+
+// UnregisterProducer removes the producer registered to k.
+func (s *Slurpd) UnregisterProducer(k string) bool {
+	if !s.producers.remove(k) {
+		return false
 	}
-	s.producerMap[k] = p
+	s.ProducerConcurrency(k, 0)
+	return true
 }
 
 // Producer will try to get the instance at k
 func (s *Slurpd) Producer(k string) (slurp.Producer, bool) {
-	v, ok := s.producerMap[k]
-	return v, ok
+	v, ok := s.producers.get(k)
+	if !ok {
+		return nil, false
+	}
+	return v.(slurp.Producer), true
 }
 
 // SlurpBuffer sets the default size of the buffer to use for slurping.
@@ -123,25 +299,502 @@ func (s *Slurpd) SlurpBuffer(size int) {
 	s.slurpBuffer = size
 }
 
-// SlurpAnalysisRequest performs a slurp for the requests using data provided
-// by the producer.
-func (s *Slurpd) SlurpAnalysisRequest(producer slurp.Producer, analysisRequest ...*slurp.AnalysisRequest) {
+// SlurpRateWindow sets the number of recent items used to work out the
+// rates reported for slurps. Zero uses slurp.DefaultRateWindow.
+func (s *Slurpd) SlurpRateWindow(n int) {
+	s.rateWindow = n
+}
+
+// SlurpClock sets the clock used for slurp stats and progress.
+func (s *Slurpd) SlurpClock(c slurp.Clock) {
+	s.clock = c
+}
+
+// JobHistory sets the number of finished jobs that are kept.
+func (s *Slurpd) JobHistory(n int) {
+	s.jobHistory = n
+}
+
+// ResultStore sets where analysis results are written to and read from.
+func (s *Slurpd) ResultStore(rs slurp.ResultStore) {
+	s.resultStore = rs
+}
+
+// SlurpTracer sets the tracer used for slurps. The data loading of every nth
+// item is traced when loadDataEvery is greater than zero.
+func (s *Slurpd) SlurpTracer(t slurp.Tracer, loadDataEvery int) {
+	s.tracer = t
+	s.traceLoadData = loadDataEvery
+}
+
+// SlurpAnalysisRequest queues a slurp for the requests using data provided
+// by the producer. It returns the job key once the slurp has finished, or an
+// error when the slurp can not be started. Like SubmitJob it returns an error
+// when slurpd is draining. Results are written to the result store and then
+// to the Results of the request, if it has any.
+func (s *Slurpd) SlurpAnalysisRequest(producer slurp.Producer, analysisRequest ...*slurp.AnalysisRequest) (string, error) {
+	if err := checkSlurp(producer, analysisRequest); err != nil {
+		return "", err
+	}
+	k := uuid.New()
+	job := s.newJob(k, producer, analysisRequest...)
+	if err := s.queueJob(k, job); err != nil {
+		return "", err
+	}
+	<-job.done
+	return k, nil
+}
+
+// StartSlurpAnalysisRequest is the same as SlurpAnalysisRequest except that
+// the job key is returned as soon as the slurp has been queued.
+func (s *Slurpd) StartSlurpAnalysisRequest(producer slurp.Producer, analysisRequest ...*slurp.AnalysisRequest) (string, error) {
+	if err := checkSlurp(producer, analysisRequest); err != nil {
+		return "", err
+	}
+	k := uuid.New()
+	if err := s.queueJob(k, s.newJob(k, producer, analysisRequest...)); err != nil {
+		return "", err
+	}
+	return k, nil
+}
+
+// checkSlurp tells us if a slurp can be made for the requests.
+func checkSlurp(producer slurp.Producer, analysisRequest []*slurp.AnalysisRequest) error {
+	if producer == nil {
+		return fmt.Errorf("a producer is required")
+	}
+	if len(analysisRequest) == 0 {
+		return fmt.Errorf("at least one analysis request is required")
+	}
+	for i, r := range analysisRequest {
+		if r == nil {
+			return fmt.Errorf("analysis request %d is nil", i)
+		}
+	}
+	return nil
+}
+
+// SubmitJob validates and queues a job request. Jobs submitted this way are
+// kept in the job queue file, if there is one, until they have finished.
+// Jobs are not accepted once slurpd is draining.
+func (s *Slurpd) SubmitJob(req *JobRequestDTO) (string, error) {
+	return s.SubmitJobAs(nil, req)
+}
+
+// SubmitJobAs is the same as SubmitJob except that the job is recorded as
+// being submitted by id.
+func (s *Slurpd) SubmitJobAs(id *Identity, req *JobRequestDTO) (string, error) {
+	p, ar, err := s.analysisRequests(req)
+	if err != nil {
+		s.audit(&AuditEntryDTO{Action: AuditJobSubmit, Identity: id, Request: req, Error: err.Error()})
+		return "", err
+	}
+	k := uuid.New()
+	job := s.newJob(k, p, ar...)
+	job.priority = req.Priority
+	job.request = req
+	job.identity = id
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	if s.draining {
+		err := drainingError()
+		s.auditLocked(&AuditEntryDTO{Action: AuditJobSubmit, Identity: id, Request: req, Error: err.Error()})
+		return "", err
+	}
+	s.auditLocked(&AuditEntryDTO{Action: AuditJobSubmit, Identity: id, Job: k, Request: req})
+	s.addJob(k, job)
+	s.schedule()
+	return k, nil
+}
+
+// ValidateJobRequest checks a job request without queueing it. Every problem
+// found with the request is listed in a ValidationError.
+func (s *Slurpd) ValidateJobRequest(req *JobRequestDTO) error {
+	_, _, err := s.analysisRequests(req)
+	return err
+}
+
+// analysisRequests works out the producer and analysis requests for a job
+// request. Every problem found with the request is listed in a
+// ValidationError.
+func (s *Slurpd) analysisRequests(req *JobRequestDTO) (slurp.Producer, []*slurp.AnalysisRequest, error) {
+	var errs ValidationError
+	p, ok := s.Producer(req.Producer)
+	if !ok {
+		errs.add("producer", ErrorCodeUnknown, "unknown producer %q", req.Producer)
+	}
+	if len(req.PointInTimeAnalysis) < 1 && len(req.RangeAnalysis) < 1 {
+		errs.add("pointInTimeAnalysis", ErrorCodeRequired, "at least one point in time or range analysis is required")
+	}
+	ar := make([]*slurp.AnalysisRequest, 0, len(req.PointInTimeAnalysis)+len(req.RangeAnalysis))
+	for i, a := range req.PointInTimeAnalysis {
+		field := fmt.Sprintf("pointInTimeAnalysis[%d]", i)
+		an, ok := s.Analyst(a.Analyst)
+		if !ok {
+			errs.add(field+".analyst", ErrorCodeUnknown, "unknown analyst %q", a.Analyst)
+			continue
+		}
+		params, err := analysisRequestParams(an, a.Params)
+		if err != nil {
+			errs.addParams(field+".params", err)
+			continue
+		}
+		r := an.AnalysisRequest(a.Time)
+		r.Params = params
+		ar = append(ar, r)
+	}
+	for i, a := range req.RangeAnalysis {
+		field := fmt.Sprintf("rangeAnalysis[%d]", i)
+		if a.Until.Before(a.From) {
+			errs.add(field+".until", ErrorCodeInvalid, "must not be before from")
+		}
+		an, ok := s.Analyst(a.Analyst)
+		if !ok {
+			errs.add(field+".analyst", ErrorCodeUnknown, "unknown analyst %q", a.Analyst)
+			continue
+		}
+		params, err := analysisRequestParams(an, a.Params)
+		if err != nil {
+			errs.addParams(field+".params", err)
+			continue
+		}
+		r := an.AnalysisRangeRequest(a.From, a.Until)
+		r.Params = params
+		ar = append(ar, r)
+	}
+	if err := errs.err(); err != nil {
+		return nil, nil, err
+	}
+	return p, ar, nil
+}
+
+// analysisRequestParams checks the parameters for an analysis request
+// against the schema of the analyst. Analysts that are not a
+// slurp.ParamAnalyst take no parameters.
+func analysisRequestParams(a slurp.Analyst, p slurp.Params) (slurp.Params, error) {
+	var schema slurp.ParamSchema
+	if pa, ok := a.(slurp.ParamAnalyst); ok {
+		schema = pa.ParamSchema()
+	}
+	return schema.Validate(p)
+}
+
+// newJob creates a queued job for the analysis requests. Results from the
+// requests are sent to the result store of the daemon.
+func (s *Slurpd) newJob(k string, producer slurp.Producer, analysisRequest ...*slurp.AnalysisRequest) *slurperMapItem {
 	// TODO: Better duplication and range checking. I.e. If we have a large
 	//       range with a big time range that is not going to be analysed
 	//       then it will most likely be better to split up the request
 	//       in to many AnalysisRequestSlurper instances with the smaller
 	//       time ranges that we then run concurrently.
-	k := uuid.New()
-	sl := slurp.NewAnalysisRequestSlurper(analysisRequest...)
-	s.slurperMap[k] = slurperMapItem{
-		started: time.Now(),
-		slurper: sl,
+	analysts := make([]string, len(analysisRequest))
+	loaders := make([]string, 0)
+	seen := make(map[string]bool)
+	for i, r := range analysisRequest {
+		ak := s.analystKey(r.Analyst)
+		analysts[i] = ak
+		sink := r.Results
+		r.Results = slurp.ResultSinkFunc(func(result *slurp.AnalysisResult) error {
+			result.Job = k
+			result.Analyst = ak
+			err := s.resultStore.WriteResult(result)
+			if err == nil && sink != nil {
+				err = sink.WriteResult(result)
+			}
+			if err != nil {
+				s.publishJobError(k, err)
+			}
+			return err
+		})
+		for _, l := range r.DataLoader {
+			lk := s.dataLoaderKey(l)
+			if lk != "" && !seen[lk] {
+				seen[lk] = true
+				loaders = append(loaders, lk)
+			}
+		}
 	}
-	defer delete(s.slurperMap, k)
-	ch := make(chan *slurp.Item, s.slurpBuffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &slurperMapItem{
+		state:    jobQueued,
+		queued:   s.clock.Now(),
+		producer: s.producerKey(producer),
+		analysts: analysts,
+		loaders:  loaders,
+		source:   producer,
+		slurper:  slurp.NewAnalysisRequestSlurper(analysisRequest...),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// queueJob adds a job to the queue and starts it if there is room. Jobs are
+// not accepted once slurpd is draining.
+func (s *Slurpd) queueJob(k string, job *slurperMapItem) error {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	if s.draining {
+		job.cancel()
+		return drainingError()
+	}
+	s.addJob(k, job)
+	s.schedule()
+	return nil
+}
+
+// addJob adds a job to the queue. The caller must hold jobMutex.
+func (s *Slurpd) addJob(k string, job *slurperMapItem) {
+	s.jobSeq++
+	job.seq = s.jobSeq
+	s.slurperMap[k] = job
+	if job.request != nil {
+		s.saveJobQueue()
+	}
+	s.publishJob(k, job)
+	s.auditJob(k, job)
+}
+
+// runJob performs the slurp for a job.
+func (s *Slurpd) runJob(k string, job *slurperMapItem) {
+	span := s.tracer.StartSpan("slurpd.Job", nil)
+	defer span.End()
+	span.SetAttribute("job", k)
+	span.SetAttribute("producer", job.producer)
+	stopCheckpoints := s.startCheckpoints(k, job)
+	defer func() {
+		stopCheckpoints()
+		if f, ok := s.resultStore.(slurp.ResultFlusher); ok {
+			if err := f.Flush(); err != nil {
+				log.Printf("Unable to flush results for job %q: %s.\n", k, err)
+				s.publishJobError(k, err)
+			}
+		}
+		s.jobMutex.Lock()
+		interrupted := job.interrupted
+		s.unlockJobs()
+		if interrupted {
+			s.saveCheckpoint(k, job)
+		}
+		s.jobMutex.Lock()
+		s.producerItems[job.producer] += job.slurper.SlurpStat().Count
+		s.finishJob(k, job)
+		s.unlockJobs()
+		close(job.done)
+	}()
+	s.slurpJob(job, span)
+}
+
+// slurpJob sends the items from the producer of a job through its slurper
+// until the production run ends or the job is cancelled.
+func (s *Slurpd) slurpJob(job *slurperMapItem, span slurp.Span) {
+	sl := job.slurper
+	sl.Clock = s.clock
+	sl.RateWindow = s.rateWindow
+	sl.Tracer = s.tracer
+	sl.TraceParent = span
+	sl.TraceLoadData = s.traceLoadData
+	produced := make(chan *slurp.Item)
 	go func() {
-		producer.Produce(slurp.AnalysisRequestTimeRange(analysisRequest...)).SendItems(ch)
-		close(ch)
+		from, until := sl.TimeRange()
+		pSpan := s.tracer.StartSpan("slurp.ProductionRun", span)
+		pSpan.SetAttribute("producer", job.producer)
+		pSpan.SetAttribute("from", from)
+		pSpan.SetAttribute("until", until)
+		run := job.source.Produce(from, until)
+		if cr, ok := run.(slurp.ContextProductionRun); ok {
+			cr.SendItemsContext(job.ctx, produced)
+		} else {
+			run.SendItems(produced)
+		}
+		close(produced)
+		pSpan.End()
 	}()
+	ch := make(chan *slurp.Item, s.slurpBuffer)
+	go forwardItems(job.ctx, produced, ch)
 	sl.Slurp(ch)
 }
+
+// forwardItems sends items from in to out until in is closed or ctx is
+// done and then closes out. Once ctx is done anything else sent to in is
+// thrown away so that the production run can finish.
+func forwardItems(ctx context.Context, in <-chan *slurp.Item, out chan<- *slurp.Item) {
+	defer close(out)
+	for {
+		select {
+		case i, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- i:
+				continue
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+		go func() {
+			for range in {
+			}
+		}()
+		return
+	}
+}
+
+// finishJob marks a job as completed, or cancelled if it was cancelled, and
+// starts any jobs that were waiting for it. The caller must hold jobMutex.
+func (s *Slurpd) finishJob(k string, job *slurperMapItem) {
+	finished := s.clock.Now()
+	if job.cancelled {
+		job.state = jobCancelled
+		s.jobCancelled++
+	} else {
+		job.state = jobCompleted
+		s.jobCompleted++
+	}
+	job.finished = &finished
+	job.cancel()
+	s.pruneJobs()
+	if job.request != nil {
+		s.saveJobQueue()
+	}
+	s.publishJob(k, job)
+	s.auditJob(k, job)
+	s.schedule()
+}
+
+// CancelJob cancels job k. A queued job is not run. A running job stops
+// taking items from its producer and finishes once the items that it has
+// already taken have been analysed. Results that have been written are
+// kept.
+func (s *Slurpd) CancelJob(k string) error {
+	return s.CancelJobAs(nil, k)
+}
+
+// CancelJobAs is the same as CancelJob except that an id below the admin
+// role can only cancel the jobs that it submitted.
+func (s *Slurpd) CancelJobAs(id *Identity, k string) error {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	err := s.checkCancelJob(id, k)
+	e := &AuditEntryDTO{Action: AuditJobCancel, Identity: id, Job: k}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.auditLocked(e)
+	if err != nil {
+		return err
+	}
+	job := s.slurperMap[k]
+	if job.cancelled {
+		return nil
+	}
+	job.cancelled = true
+	job.cancel()
+	if job.state == jobQueued {
+		s.finishJob(k, job)
+		close(job.done)
+	}
+	return nil
+}
+
+// checkCancelJob tells us why id can not cancel job k, if it can not. The
+// caller must hold jobMutex.
+func (s *Slurpd) checkCancelJob(id *Identity, k string) error {
+	job, ok := s.slurperMap[k]
+	if !ok {
+		return unknownError("job", k)
+	}
+	if id != nil && id.Role < RoleAdmin && !job.identity.same(id) {
+		return NewAPIError(http.StatusForbidden, ErrorCodeForbidden, "job %q was not submitted by %s", k, id)
+	}
+	if job.finished != nil {
+		return NewAPIError(http.StatusConflict, ErrorCodeConflict, "job %q has already %s", k, job.state)
+	}
+	return nil
+}
+
+// pruneJobs removes the oldest finished jobs so that we only keep
+// jobHistory of them. The caller must hold jobMutex.
+func (s *Slurpd) pruneJobs() {
+	finished := make([]string, 0)
+	for k, v := range s.slurperMap {
+		if v.finished != nil && !v.interrupted {
+			finished = append(finished, k)
+		}
+	}
+	if len(finished) <= s.jobHistory {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return s.slurperMap[finished[i]].finished.Before(*s.slurperMap[finished[j]].finished)
+	})
+	for _, k := range finished[:len(finished)-s.jobHistory] {
+		delete(s.slurperMap, k)
+	}
+}
+
+// job returns the job at k.
+func (s *Slurpd) job(k string) (*slurperMapItem, bool) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	v, ok := s.slurperMap[k]
+	return v, ok
+}
+
+// jobFinished tells us if the job has finished.
+func (s *Slurpd) jobFinished(job *slurperMapItem) bool {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	return job.finished != nil
+}
+
+// runningJobs returns the jobs that are currently running.
+func (s *Slurpd) runningJobs() map[string]*slurperMapItem {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	r := make(map[string]*slurperMapItem)
+	for k, v := range s.slurperMap {
+		if v.state == jobRunning {
+			r[k] = v
+		}
+	}
+	return r
+}
+
+// jobCount returns the number of queued, running, completed and cancelled
+// jobs.
+func (s *Slurpd) jobCount() (queued int, running int, completed int64, cancelled int64) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	for _, v := range s.slurperMap {
+		switch v.state {
+		case jobQueued:
+			queued++
+		case jobRunning:
+			running++
+		}
+	}
+	return queued, running, s.jobCompleted, s.jobCancelled
+}
+
+// producerItemStat returns the number of items sent by each producer and
+// the current rate for each producer.
+func (s *Slurpd) producerItemStat() (map[string]int64, map[string]float64) {
+	s.jobMutex.Lock()
+	defer s.unlockJobs()
+	items := make(map[string]int64, len(s.producerItems))
+	for k, v := range s.producerItems {
+		items[k] = v
+	}
+	rate := make(map[string]float64)
+	for _, v := range s.slurperMap {
+		if v.state != jobRunning {
+			continue
+		}
+		st := v.slurper.SlurpStat()
+		items[v.producer] += st.Count
+		rate[v.producer] += st.Rate
+	}
+	return items, rate
+}
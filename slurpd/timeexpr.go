@@ -0,0 +1,73 @@
+package slurpd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseTimeExpression works out the time described by expr relative to now.
+//
+// An expression starts with "now", "today", "yesterday" or "tomorrow". The
+// day can be followed by a time of day ("00:00"). Either can be followed by
+// a location ("UTC", "Europe/London") and an offset ("-6h"). Days and times
+// of day are worked out in the location, which defaults to UTC. For example
+// "yesterday 00:00 UTC" or "now -1h".
+func ParseTimeExpression(expr string, now time.Time) (time.Time, error) {
+	f := strings.Fields(expr)
+	if len(f) == 0 {
+		return time.Time{}, fmt.Errorf("empty time expression")
+	}
+	var (
+		loc    = time.UTC
+		offset time.Duration
+		clock  string
+	)
+	for _, v := range f[1:] {
+		switch {
+		case strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-"):
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid offset %q in time expression %q", v, expr)
+			}
+			offset += d
+		case strings.Contains(v, ":"):
+			if clock != "" {
+				return time.Time{}, fmt.Errorf("more than one time of day in time expression %q", expr)
+			}
+			clock = v
+		default:
+			l, err := time.LoadLocation(v)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("unknown location %q in time expression %q", v, expr)
+			}
+			loc = l
+		}
+	}
+	now = now.In(loc)
+	var days int
+	switch f[0] {
+	case "now":
+		if clock != "" {
+			return time.Time{}, fmt.Errorf("unexpected time of day in time expression %q", expr)
+		}
+		return now.Add(offset), nil
+	case "today":
+	case "yesterday":
+		days = -1
+	case "tomorrow":
+		days = 1
+	default:
+		return time.Time{}, fmt.Errorf("expecting time expression %q to start with now, today, yesterday or tomorrow", expr)
+	}
+	var hour, minute int
+	if clock != "" {
+		c, err := time.Parse("15:04", clock)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time of day %q in time expression %q", clock, expr)
+		}
+		hour, minute = c.Hour(), c.Minute()
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day()+days, hour, minute, 0, 0, loc)
+	return t.Add(offset), nil
+}